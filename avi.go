@@ -1,9 +1,9 @@
 package rescene
 
 import (
-	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 
 	"golang.org/x/image/riff"
 )
@@ -22,7 +22,7 @@ func dumpRIFF(r *riff.Reader, indent string) error {
 			if err != nil {
 				return err
 			}
-			fmt.Printf("%sLIST(%s)\n", indent, listType)
+			log.Printf("%sLIST(%s)\n", indent, listType)
 			if err := dumpRIFF(list, indent+".\t"); err != nil {
 				return err
 			}
@@ -32,7 +32,7 @@ func dumpRIFF(r *riff.Reader, indent string) error {
 		if err != nil {
 			return err
 		}
-		fmt.Printf("%s%s %q\n", indent, chunkID, b)
+		log.Printf("%s%s %q\n", indent, chunkID, b)
 	}
 }
 
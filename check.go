@@ -0,0 +1,213 @@
+package rescene
+
+import (
+	"fmt"
+)
+
+// VolumeIssueKind is the kind of a finding of CheckVolumes.
+type VolumeIssueKind int
+
+const (
+	// IssueFirstVolume is a first volume flag missing from the first
+	// volume or set on another one.
+	IssueFirstVolume VolumeIssueKind = iota
+	// IssueVolumeGap is a volume missing from the set, before Volume.
+	IssueVolumeGap
+	// IssueVolumeDuplicate is a second volume at the place of Volume.
+	IssueVolumeDuplicate
+	// IssueSplitChain is a file split over volumes whose parts do not
+	// follow each other.
+	IssueSplitChain
+	// IssueMissingEndArc is a volume of RAR 3.x or later without an end of
+	// archive block.
+	IssueMissingEndArc
+	// IssuePackSize is a stored file whose parts do not add up to its
+	// unpacked size.
+	IssuePackSize
+)
+
+func (k VolumeIssueKind) String() string {
+	switch k {
+	case IssueFirstVolume:
+		return "first volume"
+	case IssueVolumeGap:
+		return "volume gap"
+	case IssueVolumeDuplicate:
+		return "duplicate volume"
+	case IssueSplitChain:
+		return "split chain"
+	case IssueMissingEndArc:
+		return "missing end of archive"
+	case IssuePackSize:
+		return "pack size"
+	default:
+		return fmt.Sprintf("issue %d", int(k))
+	}
+}
+
+// VolumeIssue is a single finding of the volume set checker. File is empty
+// when the issue is about the volume itself.
+type VolumeIssue struct {
+	Kind   VolumeIssueKind
+	Volume string
+	File   string
+	Detail string
+}
+
+func (i *VolumeIssue) Error() string {
+	s := i.Kind.String() + ": " + i.Volume
+	if i.File != "" {
+		s += ": " + i.File
+	}
+	if i.Detail != "" {
+		s += ": " + i.Detail
+	}
+	return s
+}
+
+// CheckVolumes checks every archive set of the SRR, see ArchiveSet.CheckVolumes.
+func (f *SrrFile) CheckVolumes() []*VolumeIssue {
+	issues := make([]*VolumeIssue, 0)
+	for _, set := range f.ArchiveSets() {
+		issues = append(issues, set.CheckVolumes()...)
+	}
+	return issues
+}
+
+// missingVolumes describes the volumes from index from up to to, excluded,
+// missing before the volume path, naming the first one.
+func missingVolumes(path string, from, to int) string {
+	detail := fmt.Sprintf("%d volume(s) missing before", to-from)
+	if root, scheme, _, ok := ParseVolumeName(path); ok {
+		if name := scheme.VolumeName(root, from); name != "" {
+			detail += ", from " + name
+		}
+	}
+	return detail
+}
+
+// CheckVolumes walks the file headers of the set in volume order and reports
+// missing volumes, broken split chains, volumes without an end of archive
+// block and stored files whose parts do not add up to the unpacked size.
+// RAR 1.5 to 2.x sets, see Check, write no end of archive block.
+func (s *ArchiveSet) CheckVolumes() []*VolumeIssue {
+	issues := make([]*VolumeIssue, 0)
+	if len(s.Volumes) == 0 {
+		return issues
+	}
+	if err := s.Check(); err != nil {
+		issues = append(issues, &VolumeIssue{
+			Kind:   IssueFirstVolume,
+			Volume: s.Volumes[0].Path,
+			Detail: err.Error(),
+		})
+	}
+
+	prev := -1
+	for i, v := range s.Volumes {
+		n := volumeNumber(v.Path)
+		switch {
+		case n < 0:
+		case i == 0:
+			if n > 0 {
+				issues = append(issues, &VolumeIssue{
+					Kind:   IssueVolumeGap,
+					Volume: v.Path,
+					Detail: missingVolumes(v.Path, 0, n),
+				})
+			}
+		case n == prev:
+			issues = append(issues, &VolumeIssue{
+				Kind:   IssueVolumeDuplicate,
+				Volume: v.Path,
+			})
+		case n > prev+1:
+			issues = append(issues, &VolumeIssue{
+				Kind:   IssueVolumeGap,
+				Volume: v.Path,
+				Detail: missingVolumes(v.Path, prev+1, n),
+			})
+		}
+		prev = n
+	}
+
+	old := s.isOld()
+	var open *FileHeadBlock
+	openVolume := ""
+	packed := 0
+	for _, v := range s.Volumes {
+		for i, h := range v.FileHeads {
+			name := h.GetFileName()
+			if h.Flag(LHD_SPLIT_BEFORE) {
+				switch {
+				case open == nil:
+					issues = append(issues, &VolumeIssue{
+						Kind:   IssueSplitChain,
+						Volume: v.Path,
+						File:   name,
+						Detail: "continues from a missing volume",
+					})
+					packed = 0
+				case i != 0 || open.GetFileName() != name:
+					issues = append(issues, &VolumeIssue{
+						Kind:   IssueSplitChain,
+						Volume: v.Path,
+						File:   name,
+						Detail: fmt.Sprintf("does not continue %s from %s", open.GetFileName(), openVolume),
+					})
+					packed = 0
+				}
+			} else {
+				if open != nil {
+					issues = append(issues, &VolumeIssue{
+						Kind:   IssueSplitChain,
+						Volume: openVolume,
+						File:   open.GetFileName(),
+						Detail: "next part not found in " + v.Path,
+					})
+				}
+				packed = 0
+			}
+			packed += h.GetPackSize()
+
+			if h.Flag(LHD_SPLIT_AFTER) {
+				if i != len(v.FileHeads)-1 {
+					issues = append(issues, &VolumeIssue{
+						Kind:   IssueSplitChain,
+						Volume: v.Path,
+						File:   name,
+						Detail: "split file is not the last one of the volume",
+					})
+				}
+				open = h
+				openVolume = v.Path
+				continue
+			}
+			if !h.IsCompressed() && packed != h.GetUnpackSize() {
+				issues = append(issues, &VolumeIssue{
+					Kind:   IssuePackSize,
+					Volume: v.Path,
+					File:   name,
+					Detail: fmt.Sprintf("packed %d bytes, unpacked size %d", packed, h.GetUnpackSize()),
+				})
+			}
+			open = nil
+			packed = 0
+		}
+		if !v.HasEndArc && !old {
+			issues = append(issues, &VolumeIssue{
+				Kind:   IssueMissingEndArc,
+				Volume: v.Path,
+			})
+		}
+	}
+	if open != nil {
+		issues = append(issues, &VolumeIssue{
+			Kind:   IssueSplitChain,
+			Volume: openVolume,
+			File:   open.GetFileName(),
+			Detail: "continues into a missing volume",
+		})
+	}
+	return issues
+}
@@ -0,0 +1,101 @@
+package rescene
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckVolumes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{"movie.mkv": testData(3500, 1)}
+	volumes := rarSplit(t, dir, "movie", 1000, files, "movie.mkv")
+	last, err := ioutil.ReadFile(filepath.Join(dir, volumes[3]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "noend", volumes[3]), last[:len(last)-7])
+	dup, err := ioutil.ReadFile(filepath.Join(dir, volumes[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "Movie.R00"), dup)
+
+	type issue struct {
+		kind   VolumeIssueKind
+		volume string
+		detail string // not checked when empty
+	}
+	tests := []struct {
+		name    string
+		volumes []string
+		want    []issue
+	}{
+		{"complete", volumes, nil},
+		{"missing first", volumes[1:], []issue{
+			{IssueFirstVolume, "movie.r00", ""},
+			{IssueVolumeGap, "movie.r00", "1 volume(s) missing before, from movie.rar"},
+			{IssueSplitChain, "movie.r00", "continues from a missing volume"},
+			{IssuePackSize, "movie.r02", "packed 2500 bytes, unpacked size 3500"},
+		}},
+		{"missing middle", []string{volumes[0], volumes[1], volumes[3]}, []issue{
+			{IssueVolumeGap, "movie.r02", "1 volume(s) missing before, from movie.r01"},
+			{IssuePackSize, "movie.r02", "packed 2500 bytes, unpacked size 3500"},
+		}},
+		{"missing last", volumes[:3], []issue{
+			{IssueSplitChain, "movie.r01", "continues into a missing volume"},
+		}},
+		{"missing end", []string{volumes[0], volumes[1], volumes[2], filepath.Join("noend", volumes[3])}, []issue{
+			{IssueMissingEndArc, "movie.r02", ""},
+		}},
+		{"duplicate", []string{volumes[0], "Movie.R00", volumes[1], volumes[2], volumes[3]}, []issue{
+			{IssueVolumeDuplicate, "movie.r00", ""},
+			{IssuePackSize, "movie.r02", "packed 4500 bytes, unpacked size 3500"},
+		}},
+	}
+	for _, tt := range tests {
+		f := srrOf(t, dir, tt.volumes, CreateOptions{})
+		issues := f.CheckVolumes()
+		if len(issues) != len(tt.want) {
+			t.Errorf("%s: got %d issues %v, want %d", tt.name, len(issues), issues, len(tt.want))
+			continue
+		}
+		for i, w := range tt.want {
+			got := issues[i]
+			if got.Kind != w.kind || got.Volume != w.volume ||
+				(w.detail != "" && got.Detail != w.detail) {
+				t.Errorf("%s: issue %d is %v, want %s: %s: %s", tt.name, i, got, w.kind, w.volume, w.detail)
+			}
+		}
+	}
+}
+
+func TestCheckVolumesOld(t *testing.T) {
+	dir := t.TempDir()
+	data := testData(1500, 1)
+	parts := []struct {
+		name  string
+		flags RarHeaderFlag
+		chunk []byte
+	}{
+		{"old.rar", LHD_SPLIT_AFTER, data[:1000]},
+		{"old.r00", LHD_SPLIT_BEFORE, data[1000:]},
+	}
+	volumes := make([]string, 0)
+	for _, p := range parts {
+		// RAR 2.x: unpack version 20, no first volume flag, no end block
+		h := rarCompressedHead("file.bin", data, 0x30, 20, p.flags)
+		binary.LittleEndian.PutUint32(h[7:], uint32(len(p.chunk)))
+		binary.LittleEndian.PutUint16(h, uint16(crc32.ChecksumIEEE(h[2:])))
+		v := append(rarMainHead(MHD_VOLUME), h...)
+		v = append(v, p.chunk...)
+		writeTestFile(t, filepath.Join(dir, p.name), v)
+		volumes = append(volumes, p.name)
+	}
+	f := srrOf(t, dir, volumes, CreateOptions{})
+	if issues := f.CheckVolumes(); len(issues) != 0 {
+		t.Errorf("got issues %v", issues)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rescene/rescene"
+)
+
+func runCreate(c *command, args []string) error {
+	fs := newFlagSet(c)
+	asJSON := fs.Bool("json", false, "print JSON")
+	appName := fs.String("app", "rescene", "creating application name")
+	output := fs.String("o", "", "SRR file to write")
+	var stored, hashed stringList
+	fs.Var(&stored, "s", "file to store in the SRR (repeatable)")
+	fs.Var(&hashed, "hash", "file to compute an OSO hash for (repeatable)")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	if *output == "" {
+		fs.Usage()
+		return errUsage
+	}
+
+	opts := rescene.CreateOptions{AppName: *appName}
+	for _, v := range stored {
+		opts.StoredFiles = append(opts.StoredFiles, &rescene.CreateEntry{Name: filepath.Base(v), Path: v})
+	}
+	for _, v := range hashed {
+		opts.HashedFiles = append(opts.HashedFiles, &rescene.CreateEntry{Name: filepath.Base(v), Path: v})
+	}
+
+	out, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err = rescene.CreateSrr(out, fs.Args(), opts); err != nil {
+		out.Close()
+		os.Remove(*output)
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+
+	s, err := readSrr(*output)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printModel(s.ExportJSON(rescene.ExportOptions{}))
+	}
+	fmt.Printf("%s: %d volume(s), %d stored file(s)\n", *output, len(s.RarFiles), len(s.StoredFiles))
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rescene/rescene"
+)
+
+func runExtract(c *command, args []string) error {
+	fs := newFlagSet(c)
+	asJSON := fs.Bool("json", false, "print JSON")
+	outDir := fs.String("o", ".", "output directory")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	s, err := readSrr(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	written := make([]storedFileInfo, 0)
+	for _, v := range s.StoredFiles {
+		if !matchStored(v, fs.Args()[1:]) {
+			continue
+		}
+		name := path.Clean("/" + strings.ReplaceAll(v.Path, "\\", "/"))[1:]
+		dst := filepath.Join(*outDir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(dst, v.Data, 0644); err != nil {
+			return err
+		}
+		written = append(written, storedFileInfo{dst, len(v.Data)})
+	}
+	if *asJSON {
+		return printJSON(written)
+	}
+	for _, v := range written {
+		fmt.Printf("%s\n", v.Path)
+	}
+	return nil
+}
+
+// matchStored reports whether a stored file matches one of the patterns,
+// tried against the full stored path and the base name.
+func matchStored(v *rescene.StoredFile, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, v.Path); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, path.Base(v.Path)); ok {
+			return true
+		}
+	}
+	return false
+}
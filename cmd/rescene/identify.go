@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/rescene/rescene"
+	"github.com/rescene/rescene/store"
+)
+
+type identifyInfo struct {
+	Path    string          `json:"path"`
+	Size    uint64          `json:"size"`
+	CRC     string          `json:"crc"`
+	OSOHash string          `json:"oso_hash"`
+	Matches []identifyMatch `json:"matches"`
+}
+
+type identifyMatch struct {
+	Release string `json:"release"`
+	Role    string `json:"role"`
+	Name    string `json:"name"`
+}
+
+func runIdentify(c *command, args []string) error {
+	fs := newFlagSet(c)
+	asJSON := fs.Bool("json", false, "print JSON")
+	db := fs.String("db", "", "store database file to search")
+	var srrs stringList
+	fs.Var(&srrs, "srr", "SRR file to search (repeatable)")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	if *db == "" && len(srrs) == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	var st *store.Store
+	if *db != "" {
+		var err error
+		if st, err = store.Open(*db); err != nil {
+			return err
+		}
+		defer st.Close()
+	}
+	parsed := make(map[string]*rescene.SrrFile)
+	for _, p := range srrs {
+		s, err := readSrr(p)
+		if err != nil {
+			return err
+		}
+		parsed[store.ReleaseName(p)] = s
+	}
+
+	infos := make([]identifyInfo, 0)
+	for _, p := range fs.Args() {
+		h, err := rescene.HashFile(p)
+		if err != nil {
+			return err
+		}
+		matches := h.MatchReleases(parsed)
+		if st != nil {
+			more, err := st.Match(h)
+			if err != nil {
+				return err
+			}
+			matches = append(matches, more...)
+		}
+		info := identifyInfo{
+			Path:    p,
+			Size:    h.Size,
+			CRC:     fmt.Sprintf("%08X", h.CRC),
+			OSOHash: fmt.Sprintf("%016x", h.OSOHash),
+			Matches: make([]identifyMatch, 0, len(matches)),
+		}
+		for _, m := range matches {
+			info.Matches = append(info.Matches, identifyMatch{m.Release, m.Role, m.Name})
+		}
+		infos = append(infos, info)
+	}
+	if *asJSON {
+		return printJSON(infos)
+	}
+	for _, i := range infos {
+		fmt.Printf("%s %s %s %d\n", i.Path, i.CRC, i.OSOHash, i.Size)
+		for _, m := range i.Matches {
+			fmt.Printf("\t%s: %s %s\n", m.Release, m.Role, m.Name)
+		}
+	}
+	return nil
+}
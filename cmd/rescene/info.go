@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rescene/rescene"
+	"golang.org/x/text/message"
+)
+
+type srrInfo struct {
+	ApplicationName string
+	Compressed      bool
+	StoredFiles     []storedFileInfo
+	ArchiveSets     []archiveSetInfo
+	PackedFiles     []packedFileInfo
+	OSOHashes       []osoHashInfo
+	SFVComments     []string
+	Issues          []string
+}
+
+type storedFileInfo struct {
+	Path string
+	Size int
+}
+
+type archiveSetInfo struct {
+	Root       string
+	Volumes    []volumeInfo
+	Files      []packedFileInfo
+	Comment    string
+	Properties string
+}
+
+type volumeInfo struct {
+	Path string `json:"path"`
+	Size int    `json:"size"`
+	CRC  string `json:"crc,omitempty"`
+}
+
+type packedFileInfo struct {
+	Path      string
+	Size      uint64
+	CRC       string
+	Encrypted bool
+}
+
+type osoHashInfo struct {
+	Path string
+	Size uint64
+	Hash string
+}
+
+type srsBlockInfo struct {
+	Type string
+	Size int
+}
+
+func newSrrInfo(s *rescene.SrrFile) *srrInfo {
+	info := &srrInfo{
+		ApplicationName: s.ApplicationName,
+		Compressed:      s.RarCompressed,
+		StoredFiles:     make([]storedFileInfo, 0),
+		ArchiveSets:     make([]archiveSetInfo, 0),
+		PackedFiles:     make([]packedFileInfo, 0),
+		OSOHashes:       make([]osoHashInfo, 0),
+		SFVComments:     s.SFVComments,
+		Issues:          make([]string, 0),
+	}
+	for _, v := range s.StoredFiles {
+		info.StoredFiles = append(info.StoredFiles, storedFileInfo{v.Path, len(v.Data)})
+	}
+	for _, set := range s.ArchiveSets() {
+		a := archiveSetInfo{
+			Root:    set.Root,
+			Volumes: make([]volumeInfo, 0),
+			Files:   make([]packedFileInfo, 0),
+		}
+		if len(set.Volumes) > 0 {
+			a.Properties = set.Volumes[0].Properties.String()
+		}
+		for _, v := range set.Volumes {
+			vi := volumeInfo{Path: v.Path, Size: v.Size}
+			if v.CRC != 0 {
+				vi.CRC = fmt.Sprintf("%08X", v.CRC)
+			}
+			a.Volumes = append(a.Volumes, vi)
+			if v.Comment != nil && a.Comment == "" {
+				if _, err := v.Comment.Unpack(); err != nil {
+					a.Comment = fmt.Sprintf("(%d bytes: %v)", len(v.Comment.Data), err)
+				} else {
+					a.Comment = v.Comment.Text
+				}
+			}
+		}
+		for _, p := range set.PackedFiles {
+			a.Files = append(a.Files, packedFileInfo{p.Path, p.Size, fmt.Sprintf("%08X", p.CRC), p.Properties.Encrypted})
+		}
+		info.ArchiveSets = append(info.ArchiveSets, a)
+	}
+	for _, p := range s.PackedFiles {
+		info.PackedFiles = append(info.PackedFiles, packedFileInfo{p.Path, p.Size, fmt.Sprintf("%08X", p.CRC), p.Properties.Encrypted})
+	}
+	for _, h := range s.OSOHashes {
+		info.OSOHashes = append(info.OSOHashes, osoHashInfo{h.Path, h.Size, fmt.Sprintf("%016x", h.Hash)})
+	}
+	for _, i := range s.CheckVolumes() {
+		info.Issues = append(info.Issues, i.Error())
+	}
+	return info
+}
+
+func srsBlocks(s *rescene.SrsFile) []srsBlockInfo {
+	blocks := make([]srsBlockInfo, 0, len(s.Blocks))
+	for _, b := range s.Blocks {
+		switch b := b.(type) {
+		case *rescene.ID3v2Block:
+			blocks = append(blocks, srsBlockInfo{"id3v2", b.Size})
+		case *rescene.ID3v1Block:
+			blocks = append(blocks, srsBlockInfo{"id3v1", b.Size})
+		case *rescene.SrsBlock:
+			blocks = append(blocks, srsBlockInfo{strings.TrimSpace(string(b.Head[:])), b.Size})
+		case rescene.Lyrics200Block:
+			blocks = append(blocks, srsBlockInfo{"lyrics3v2", b.Size})
+		case *rescene.ApeBlock:
+			blocks = append(blocks, srsBlockInfo{"ape", b.Size})
+		case *rescene.MpegBlock:
+			blocks = append(blocks, srsBlockInfo{"mpeg", b.Size})
+		case rescene.MkvBlock:
+			blocks = append(blocks, srsBlockInfo{"mkv", b.Size})
+		case rescene.AviBlock:
+			blocks = append(blocks, srsBlockInfo{"avi", b.Size})
+		default:
+			blocks = append(blocks, srsBlockInfo{fmt.Sprintf("%T", b), 0})
+		}
+	}
+	return blocks
+}
+
+func runInfo(c *command, args []string) error {
+	fs := newFlagSet(c)
+	asJSON := fs.Bool("json", false, "print the JSON model")
+	asYAML := fs.Bool("yaml", false, "print the YAML model")
+	withData := fs.Bool("data", false, "include stored file data in the JSON or YAML model")
+	withBlocks := fs.Bool("blocks", false, "list the raw SRR blocks")
+	withHex := fs.Bool("hex", false, "with -blocks, dump the bytes of each block")
+	nested := fs.Bool("nested", false, "parse the stored SRS and SRR files")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	filename := fs.Arg(0)
+
+	if strings.ToLower(filepath.Ext(filename)) == ".srs" {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		s := &rescene.SrsFile{}
+		if err = s.Unmarshal(b); err != nil {
+			return err
+		}
+		switch {
+		case *asJSON:
+			return printModel(s.ExportJSON())
+		case *asYAML:
+			return printModel(s.ExportYAML())
+		}
+		blocks := srsBlocks(s)
+		fmt.Printf("Blocks:\n")
+		for _, b := range blocks {
+			fmt.Printf("\t%-10s %d\n", b.Type, b.Size)
+		}
+		return nil
+	}
+
+	s, err := readSrr(filename)
+	if err != nil {
+		return err
+	}
+	if *nested {
+		if err = s.ParseNested(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: nested file: %s\n", err)
+		}
+	}
+	opts := rescene.ExportOptions{StoredData: *withData, Blocks: *withBlocks}
+	switch {
+	case *asJSON:
+		return printModel(s.ExportJSON(opts))
+	case *asYAML:
+		return printModel(s.ExportYAML(opts))
+	case *withBlocks:
+		return printBlocks(s, *withHex)
+	}
+	info := newSrrInfo(s)
+
+	fmt.Printf("Creating Application:\n\t%s\n\n", info.ApplicationName)
+	if info.Compressed {
+		fmt.Printf("SRR for compressed RARs.\n\n")
+	}
+	if len(info.StoredFiles) > 0 {
+		p := message.NewPrinter(message.MatchLanguage("en"))
+		p.Printf("Stored files:\n")
+		for i, v := range info.StoredFiles {
+			p.Printf("\t%9d  %s\n", v.Size, v.Path)
+			printNested(p, s.StoredFiles[i], "\t\t\t   ")
+		}
+		fmt.Printf("\n")
+	}
+	for _, a := range info.ArchiveSets {
+		fmt.Printf("RAR files (%s):\n", a.Root)
+		for _, v := range a.Volumes {
+			fmt.Printf("\t%s %s %d\n", v.Path, v.CRC, v.Size)
+		}
+		if a.Properties != "" {
+			fmt.Printf("\t(%s)\n", a.Properties)
+		}
+		fmt.Printf("\n")
+		if a.Comment != "" {
+			fmt.Printf("Comment:\n")
+			for _, line := range strings.Split(strings.TrimRight(a.Comment, "\r\n"), "\n") {
+				fmt.Printf("\t%s\n", strings.TrimRight(line, "\r"))
+			}
+			fmt.Printf("\n")
+		}
+	}
+	if len(info.PackedFiles) > 0 {
+		fmt.Printf("Archived files:\n")
+		for _, v := range info.PackedFiles {
+			if v.Encrypted {
+				fmt.Printf("\t%s %s %d (encrypted)\n", v.Path, v.CRC, v.Size)
+			} else {
+				fmt.Printf("\t%s %s %d\n", v.Path, v.CRC, v.Size)
+			}
+		}
+		fmt.Printf("\n")
+	}
+	if len(info.OSOHashes) > 0 {
+		fmt.Printf("ISDb hashes:\n")
+		for _, v := range info.OSOHashes {
+			fmt.Printf("\t%s %s %d\n", v.Path, v.Hash, v.Size)
+		}
+		fmt.Printf("\n")
+	}
+	if len(info.SFVComments) > 0 {
+		fmt.Printf("SFV comments:\n")
+		for _, v := range info.SFVComments {
+			fmt.Printf("\t%s\n", v)
+		}
+		fmt.Printf("\n")
+	}
+	if len(info.Issues) > 0 {
+		fmt.Printf("Volume issues:\n")
+		for _, v := range info.Issues {
+			fmt.Printf("\t%s\n", v)
+		}
+		fmt.Printf("\n")
+	}
+	return nil
+}
+
+// printNested prints the content of a stored file parsed by ParseNested:
+// the blocks of an SRS, the volumes and stored files of an SRR.
+func printNested(p *message.Printer, sf *rescene.StoredFile, indent string) {
+	if sf.Srs != nil {
+		for _, b := range srsBlocks(sf.Srs) {
+			p.Printf("%s%-10s %d\n", indent, b.Type, b.Size)
+		}
+	}
+	if sf.Srr != nil {
+		for _, v := range sf.Srr.RarFiles {
+			p.Printf("%s%s %d\n", indent, v.Path, v.Size)
+		}
+		for _, v := range sf.Srr.StoredFiles {
+			p.Printf("%s%9d  %s\n", indent, len(v.Data), v.Path)
+			printNested(p, v, indent+"\t")
+		}
+	}
+}
+
+// printBlocks prints the SRR blocks as a tree, RAR headers being nested
+// under the volume they belong to.
+func printBlocks(s *rescene.SrrFile, withHex bool) error {
+	for _, b := range s.Blocks {
+		indent := ""
+		if _, ok := b.Header.(*rescene.SrrRarSubBlockHeadBlock); !ok && b.Volume != nil {
+			indent = "\t"
+		}
+		fields, err := json.Marshal(b.Header)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s%08x  0x%02X  %6d  %s\n", indent, b.Offset, byte(b.Type), len(b.Raw), fields)
+		if withHex {
+			for _, line := range strings.SplitAfter(hex.Dump(b.Raw), "\n") {
+				if line != "" {
+					fmt.Printf("%s\t%s", indent, line)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Command rescene inspects, creates and rebuilds from SRR and SRS files.
+//
+// Exit codes:
+//
+//	0  success
+//	1  error (unreadable input, I/O failure, unsupported operation)
+//	2  usage error
+//	3  verification failed (missing volume, size or CRC mismatch)
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rescene/rescene"
+)
+
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitMismatch = 3
+)
+
+// errMismatch is returned by commands whose check did not pass.
+var errMismatch = errors.New("verification failed")
+
+// errUsage is returned for bad command lines; the message is already printed.
+var errUsage = errors.New("usage")
+
+type command struct {
+	name  string
+	usage string
+	run   func(c *command, args []string) error
+}
+
+var commands = []*command{
+	{"info", "info [--json|--yaml] [--data] [--blocks [--hex]] [--nested] <file.srr|file.srs>", runInfo},
+	{"extract", "extract [--json] [-o dir] <file.srr> [name...]", runExtract},
+	{"verify", "verify [--json] [-d dir] <file.srr>", runVerify},
+	{"rebuild", "rebuild [--json] [-i dir|file] [-o dir] [-rar exe]... [-rar-dir dir]... <file.srr|file.srs>", runRebuild},
+	{"create", "create [--json] [-app name] [-s file]... [-hash file]... -o <file.srr> <volume.rar>...", runCreate},
+	{"scan", "scan [--json] [-app name] [-o dir] <dir>...", runScan},
+	{"sfv", "sfv [--json] [-check dir] <file.srr>", runSfv},
+	{"nfo", "nfo [-png file [-scale n] [-font file]] <file.srr> [name]", runNfo},
+	{"index", "index [--json] [-db file] <dir>...", runIndex},
+	{"search", "search [--json] [-db file] -crc crc|-oso hash|-size n|-name pattern", runSearch},
+	{"identify", "identify [--json] [-db file] [-srr file]... <file>...", runIdentify},
+	{"serve", "serve [-addr host:port] [-root dir] [-db file [-index]]", runServe},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: rescene <command> [options]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "\t%s\n", c.usage)
+	}
+}
+
+func newFlagSet(c *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: rescene %s\n", c.usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func parseFlags(fs *flag.FlagSet, args []string, nargs int) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() < nargs {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func readSrr(path string) (*rescene.SrrFile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &rescene.SrrFile{}
+	if err = s.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printModel prints the output of an ExportJSON or ExportYAML call, JSON
+// being indented.
+func printModel(b []byte, err error) error {
+	if err != nil {
+		return err
+	}
+	if json.Valid(b) {
+		var buf bytes.Buffer
+		if err = json.Indent(&buf, b, "", "  "); err != nil {
+			return err
+		}
+		b = buf.Bytes()
+	}
+	if _, err = os.Stdout.Write(b); err != nil {
+		return err
+	}
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		_, err = os.Stdout.Write([]byte("\n"))
+	}
+	return err
+}
+
+// warnFailed prints, sorted by path, the entries a scan left out.
+func warnFailed(failed map[string]error) {
+	paths := make([]string, 0, len(failed))
+	for p := range failed {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", p, failed[p])
+	}
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func main() {
+	log.SetOutput(ioutil.Discard)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+	name := os.Args[1]
+	if name == "-h" || name == "--help" || name == "help" {
+		usage()
+		os.Exit(exitOK)
+	}
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		err := c.run(c, os.Args[2:])
+		switch {
+		case err == nil:
+			os.Exit(exitOK)
+		case err == errUsage:
+			os.Exit(exitUsage)
+		case err == errMismatch:
+			os.Exit(exitMismatch)
+		default:
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(exitError)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", name)
+	usage()
+	os.Exit(exitUsage)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rescene/rescene"
+)
+
+// TestMain runs the command itself when the tests start it through
+// runCommand.
+func TestMain(m *testing.M) {
+	if os.Getenv("RESCENE_TEST_COMMAND") == "1" {
+		main()
+	}
+	os.Exit(m.Run())
+}
+
+// runCommand runs rescene with args in dir and returns its output and exit
+// code.
+func runCommand(t *testing.T, dir string, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "RESCENE_TEST_COMMAND=1")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return stdout.String(), 0
+	case errors.As(err, &exit):
+		return stdout.String(), exit.ExitCode()
+	}
+	t.Fatal(err)
+	return "", 0
+}
+
+func rarBlock(t rescene.RarHeaderType, flags rescene.RarHeaderFlag, body []byte) []byte {
+	b := make([]byte, 7, 7+len(body))
+	b[2] = byte(t)
+	binary.LittleEndian.PutUint16(b[3:], uint16(flags))
+	binary.LittleEndian.PutUint16(b[5:], uint16(7+len(body)))
+	b = append(b, body...)
+	binary.LittleEndian.PutUint16(b, uint16(crc32.ChecksumIEEE(b[2:])))
+	return b
+}
+
+// storedRar returns a single volume storing one file.
+func storedRar(name string, data []byte) []byte {
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, uint32(len(data)))
+	binary.Write(&body, binary.LittleEndian, uint32(len(data)))
+	body.WriteByte(2)
+	binary.Write(&body, binary.LittleEndian, crc32.ChecksumIEEE(data))
+	binary.Write(&body, binary.LittleEndian, uint32(0x5a000000))
+	body.WriteByte(29)
+	body.WriteByte(0x30)
+	binary.Write(&body, binary.LittleEndian, uint16(len(name)))
+	binary.Write(&body, binary.LittleEndian, uint32(0x20))
+	body.WriteString(name)
+	v := []byte{0x52, 0x61, 0x72, 0x21, 0x1A, 0x07, 0x00}
+	v = append(v, rarBlock(rescene.MainHead, 0, make([]byte, 6))...)
+	v = append(v, rarBlock(rescene.FileHead, rescene.HAS_DATA, body.Bytes())...)
+	v = append(v, data...)
+	return append(v, rarBlock(rescene.EndArcHead, 0, nil)...)
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// release writes a release of one volume with its SFV and NFO under dir,
+// the packed file under dir/in, and returns the volume.
+func release(t *testing.T, dir string) []byte {
+	t.Helper()
+	data := bytes.Repeat([]byte("movie data "), 100)
+	volume := storedRar("movie.mkv", data)
+	writeFile(t, filepath.Join(dir, "rel", "movie.rar"), volume)
+	writeFile(t, filepath.Join(dir, "rel", "movie.sfv"), []byte(fmt.Sprintf("movie.rar %08x\r\n", crc32.ChecksumIEEE(volume))))
+	writeFile(t, filepath.Join(dir, "rel", "movie.nfo"), []byte("nfo\r\n"))
+	writeFile(t, filepath.Join(dir, "in", "movie.mkv"), data)
+	return volume
+}
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	volume := release(t, dir)
+	if out, code := runCommand(t, dir, "create", "-s", "rel/movie.sfv", "-s", "rel/movie.nfo", "-o", "movie.srr", "rel/movie.rar"); code != exitOK {
+		t.Fatalf("create: exit %d: %s", code, out)
+	}
+	writeFile(t, filepath.Join(dir, "bad", "movie.rar"), append([]byte{0}, volume[1:]...))
+	writeFile(t, filepath.Join(dir, "bad.srr"), []byte("not an SRR"))
+
+	tests := []struct {
+		args []string
+		code int
+		want string // part of the output
+	}{
+		{nil, exitUsage, ""},
+		{[]string{"help"}, exitOK, ""},
+		{[]string{"nope"}, exitUsage, ""},
+		{[]string{"info"}, exitUsage, ""},
+		{[]string{"info", "-nope", "movie.srr"}, exitUsage, ""},
+		{[]string{"info", "missing.srr"}, exitError, ""},
+		{[]string{"info", "--json", "bad.srr"}, exitError, ""},
+		{[]string{"info", "--json", "movie.srr"}, exitOK, `"type": "srr"`},
+		{[]string{"info", "--yaml", "movie.srr"}, exitOK, `type: "srr"`},
+		{[]string{"sfv", "movie.srr"}, exitOK, fmt.Sprintf("movie.rar %08x", crc32.ChecksumIEEE(volume))},
+		{[]string{"verify", "-d", "rel", "movie.srr"}, exitOK, "OK       movie.rar"},
+		{[]string{"verify", "--json", "-d", "rel", "movie.srr"}, exitOK, `"ok": true`},
+		{[]string{"verify", "-d", "bad", "movie.srr"}, exitMismatch, "CRC      movie.rar"},
+		{[]string{"verify", "--json", "-d", "in", "movie.srr"}, exitMismatch, `"missing": true`},
+		{[]string{"sfv", "-check", "bad", "movie.srr"}, exitMismatch, ""},
+		{[]string{"extract", "--json", "-o", "out", "movie.srr", "*.nfo"}, exitOK, `"Size": 5`},
+		{[]string{"rebuild", "--json", "-i", "in", "-o", "rebuilt", "movie.srr"}, exitOK, `"ok": true`},
+	}
+	for _, tt := range tests {
+		out, code := runCommand(t, dir, tt.args...)
+		if code != tt.code || !strings.Contains(out, tt.want) {
+			t.Errorf("%q: exit %d, want %d with %q: %s", tt.args, code, tt.code, tt.want, out)
+		}
+	}
+
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "out", "movie.nfo")); err != nil || string(b) != "nfo\r\n" {
+		t.Errorf("extracted %q, %v", b, err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "rebuilt", "movie.rar")); err != nil || !bytes.Equal(b, volume) {
+		t.Errorf("rebuilt volume differs: %v", err)
+	}
+	out, _ := runCommand(t, dir, "verify", "--json", "-d", "rel", "movie.srr")
+	var results []struct {
+		Path         string `json:"path"`
+		Size         int64  `json:"size"`
+		ExpectedSize int64  `json:"expected_size"`
+		CRC          string `json:"crc"`
+		ExpectedCRC  string `json:"expected_crc"`
+		OK           bool   `json:"ok"`
+	}
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatal(err)
+	}
+	crc := fmt.Sprintf("%08X", crc32.ChecksumIEEE(volume))
+	if len(results) != 1 || results[0].Path != "movie.rar" || results[0].Size != int64(len(volume)) ||
+		results[0].CRC != crc || results[0].ExpectedCRC != crc || !results[0].OK {
+		t.Errorf("verify --json: %s", out)
+	}
+}
+
+func TestIdentifyCommand(t *testing.T) {
+	dir := t.TempDir()
+	release(t, dir)
+	if err := os.Mkdir(filepath.Join(dir, "srrs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if out, code := runCommand(t, dir, "create", "-s", "rel/movie.sfv", "-hash", "in/movie.mkv", "-o", "srrs/movie.srr", "rel/movie.rar"); code != exitOK {
+		t.Fatalf("create: exit %d: %s", code, out)
+	}
+	if out, code := runCommand(t, dir, "index", "-db", "srr.db", "srrs"); code != exitOK {
+		t.Fatalf("index: exit %d: %s", code, out)
+	}
+	out, code := runCommand(t, dir, "identify", "--json", "-srr", "srrs/movie.srr", "-db", "srr.db", "in/movie.mkv", "rel/movie.rar")
+	if code != exitOK {
+		t.Fatalf("identify: exit %d: %s", code, out)
+	}
+	var infos []identifyInfo
+	if err := json.Unmarshal([]byte(out), &infos); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		// the SRR given, then the store
+		{"packed_file", "oso_hash", "packed_file", "oso_hash"},
+		{"rar_volume", "rar_volume"},
+	}
+	if len(infos) != len(want) {
+		t.Fatalf("identify: %s", out)
+	}
+	for i, info := range infos {
+		roles := make([]string, 0)
+		for _, m := range info.Matches {
+			if m.Release != "movie" {
+				t.Errorf("%s: release %q", info.Path, m.Release)
+			}
+			roles = append(roles, m.Role)
+		}
+		if fmt.Sprint(roles) != fmt.Sprint(want[i]) {
+			t.Errorf("%s: roles %v, want %v", info.Path, roles, want[i])
+		}
+	}
+	if _, code := runCommand(t, dir, "identify", "in/movie.mkv"); code != exitUsage {
+		t.Errorf("no source: exit %d", code)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/rescene/rescene"
+)
+
+func runNfo(c *command, args []string) error {
+	fs := newFlagSet(c)
+	pngFile := fs.String("png", "", "write the NFO as a PNG image to this file")
+	scale := fs.Int("scale", 1, "PNG pixels per font pixel")
+	fontFile := fs.String("font", "", "8x16 code page 437 bitmap font (4096 bytes) to draw with")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	s, err := readSrr(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var nfo *rescene.StoredFile
+	for _, v := range s.StoredFiles {
+		if len(fs.Args()) > 1 {
+			if matchStored(v, fs.Args()[1:]) {
+				nfo = v
+				break
+			}
+		} else if strings.EqualFold(path.Ext(v.Path), ".nfo") {
+			nfo = v
+			break
+		}
+	}
+	if nfo == nil {
+		return rescene.ErrNotFound
+	}
+
+	if *pngFile == "" {
+		text, err := rescene.NfoText(nfo)
+		if err != nil {
+			return err
+		}
+		fmt.Print(text)
+		return nil
+	}
+	opts := rescene.NfoOptions{Scale: *scale}
+	if *fontFile != "" {
+		if opts.Font, err = ioutil.ReadFile(*fontFile); err != nil {
+			return err
+		}
+	}
+	f, err := os.Create(*pngFile)
+	if err != nil {
+		return err
+	}
+	if err = rescene.WriteNfoPNG(f, nfo, opts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rescene/rescene"
+)
+
+func runRebuild(c *command, args []string) error {
+	fs := newFlagSet(c)
+	asJSON := fs.Bool("json", false, "print JSON")
+	inDir := fs.String("i", ".", "directory with the extracted files, or main file of an SRS")
+	outDir := fs.String("o", ".", "output directory")
+	tmpDir := fs.String("tmp", "", "temporary directory for compressed archives")
+	var rarDirs, rarExes stringList
+	fs.Var(&rarDirs, "rar-dir", "directory of RAR builds for compressed archives (repeatable)")
+	fs.Var(&rarExes, "rar", "RAR build for compressed archives (repeatable)")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	if strings.ToLower(filepath.Ext(fs.Arg(0))) == ".srs" {
+		return rebuildSample(fs.Arg(0), *inDir, *outDir, *asJSON)
+	}
+	s, err := readSrr(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	opts := rescene.ReconstructOptions{
+		InputDir:  *inDir,
+		OutputDir: *outDir,
+		TempDir:   *tmpDir,
+	}
+	if len(rarDirs) > 0 || len(rarExes) > 0 {
+		opts.Registry = &rescene.RarRegistry{}
+		for _, v := range rarDirs {
+			failed, err := opts.Registry.Scan(v)
+			if err != nil {
+				return err
+			}
+			warnFailed(failed)
+		}
+		for _, v := range rarExes {
+			if err = opts.Registry.Add(0, v); err != nil {
+				return fmt.Errorf("%s: %w", v, err)
+			}
+		}
+	}
+	results, err := s.Reconstruct(opts)
+	if err != nil {
+		return err
+	}
+	return printVolumeResults(results, *asJSON)
+}
+
+// rebuildSample rebuilds the sample of an SRS from the main file in, or
+// from the first file of in with the extension of the sample that holds
+// its data when in is a directory.
+func rebuildSample(path, in, outDir string, asJSON bool) error {
+	srs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(in)
+	if err != nil {
+		return err
+	}
+	candidates := []string{in}
+	if fi.IsDir() {
+		file, _, err := rescene.SampleInfo(srs)
+		if err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(in)
+		if err != nil {
+			return err
+		}
+		candidates = candidates[:0]
+		ext := filepath.Ext(file.SampleName)
+		for _, e := range entries {
+			if e.Type().IsRegular() && strings.EqualFold(filepath.Ext(e.Name()), ext) && e.Name() != file.SampleName {
+				candidates = append(candidates, filepath.Join(in, e.Name()))
+			}
+		}
+	}
+	for _, c := range candidates {
+		result, err := rescene.ReconstructSample(srs, c, outDir)
+		if err == rescene.ErrBadData && len(candidates) > 1 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return printVolumeResults([]*rescene.VolumeResult{result}, asJSON)
+	}
+	return fmt.Errorf("%s: no main file holding the sample data", in)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rescene/rescene"
+)
+
+type scanInfo struct {
+	Name        string   `json:"name"`
+	Dir         string   `json:"dir"`
+	Volumes     []string `json:"volumes"`
+	StoredFiles []string `json:"stored_files"`
+	Warnings    []string `json:"warnings"`
+	Srr         string   `json:"srr,omitempty"`
+}
+
+func entryNames(entries []*rescene.CreateEntry) []string {
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name
+	}
+	return names
+}
+
+func runScan(c *command, args []string) error {
+	fs := newFlagSet(c)
+	asJSON := fs.Bool("json", false, "print JSON")
+	appName := fs.String("app", "rescene", "creating application name")
+	output := fs.String("o", "", "directory to write an SRR per release to")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	infos := make([]scanInfo, 0)
+	for _, root := range fs.Args() {
+		releases, failed, err := rescene.ScanReleases(root)
+		if err != nil {
+			return err
+		}
+		warnFailed(failed)
+		for _, r := range releases {
+			info := scanInfo{
+				Name:        r.Name,
+				Dir:         r.Dir,
+				Volumes:     entryNames(r.Volumes),
+				StoredFiles: entryNames(r.StoredFiles),
+				Warnings:    make([]string, len(r.Warnings)),
+			}
+			for i, w := range r.Warnings {
+				info.Warnings[i] = w.Error()
+			}
+			if *output != "" {
+				info.Srr = filepath.Join(*output, r.Name+".srr")
+				if err = writeScannedSrr(info.Srr, r, *appName); err != nil {
+					return err
+				}
+			}
+			infos = append(infos, info)
+		}
+	}
+
+	if *asJSON {
+		return printJSON(infos)
+	}
+	for _, i := range infos {
+		fmt.Printf("%s (%s): %d volume(s), %d stored\n", i.Name, i.Dir, len(i.Volumes), len(i.StoredFiles))
+		for _, w := range i.Warnings {
+			fmt.Printf("\t%s\n", w)
+		}
+		if i.Srr != "" {
+			fmt.Printf("\t-> %s\n", i.Srr)
+		}
+	}
+	return nil
+}
+
+func writeScannedSrr(path string, r *rescene.ScannedRelease, appName string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = r.CreateSrr(out, appName); err != nil {
+		out.Close()
+		os.Remove(path)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/rescene/rescene/server"
+	"github.com/rescene/rescene/store"
+)
+
+func runServe(c *command, args []string) error {
+	fs := newFlagSet(c)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	root := fs.String("root", ".", "directory of the SRR and SRS files served")
+	db := fs.String("db", "", "store database file for the release and search routes")
+	index := fs.Bool("index", false, "with -db, index the root before serving")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	var st *store.Store
+	if *db != "" {
+		var err error
+		if st, err = store.Open(*db); err != nil {
+			return err
+		}
+		defer st.Close()
+		if *index {
+			result, err := st.Index(*root)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "%d added, %d updated, %d removed, %d unchanged\n",
+				result.Added, result.Updated, result.Removed, result.Unchanged)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Serving %s on http://%s\n", *root, *addr)
+	return http.ListenAndServe(*addr, server.New(*root, st))
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+)
+
+func runSfv(c *command, args []string) error {
+	fs := newFlagSet(c)
+	asJSON := fs.Bool("json", false, "print JSON")
+	check := fs.String("check", "", "check the volumes found in this directory")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	s, err := readSrr(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *check != "" {
+		results, err := s.Verify(*check)
+		if err != nil {
+			return err
+		}
+		return printVolumeResults(results, *asJSON)
+	}
+
+	if *asJSON {
+		entries := make([]volumeInfo, 0)
+		for _, v := range s.RarFiles {
+			if v.CRC != 0 {
+				entries = append(entries, volumeInfo{Path: v.Path, Size: v.Size, CRC: fmt.Sprintf("%08X", v.CRC)})
+			}
+		}
+		return printJSON(entries)
+	}
+	fmt.Print(s.SFV())
+	return nil
+}
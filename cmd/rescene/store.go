@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rescene/rescene/store"
+)
+
+func runIndex(c *command, args []string) error {
+	fs := newFlagSet(c)
+	asJSON := fs.Bool("json", false, "print JSON")
+	db := fs.String("db", "rescene.db", "store database file")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	s, err := store.Open(*db)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	result := &store.IndexResult{Errors: map[string]error{}, Duplicates: map[string][]string{}}
+	for _, root := range fs.Args() {
+		r, err := s.Index(root)
+		if err != nil {
+			return err
+		}
+		result.Added += r.Added
+		result.Updated += r.Updated
+		result.Removed += r.Removed
+		result.Unchanged += r.Unchanged
+		for k, v := range r.Errors {
+			result.Errors[k] = v
+		}
+		for k, v := range r.Duplicates {
+			result.Duplicates[k] = v
+		}
+	}
+	errs := make(map[string]string, len(result.Errors))
+	paths := make([]string, 0, len(result.Errors))
+	for k, v := range result.Errors {
+		errs[k] = v.Error()
+		paths = append(paths, k)
+	}
+	if *asJSON {
+		return printJSON(struct {
+			Added      int                 `json:"added"`
+			Updated    int                 `json:"updated"`
+			Removed    int                 `json:"removed"`
+			Unchanged  int                 `json:"unchanged"`
+			Errors     map[string]string   `json:"errors"`
+			Duplicates map[string][]string `json:"duplicates"`
+		}{result.Added, result.Updated, result.Removed, result.Unchanged, errs, result.Duplicates})
+	}
+	fmt.Printf("%d added, %d updated, %d removed, %d unchanged\n", result.Added, result.Updated, result.Removed, result.Unchanged)
+	sort.Strings(paths)
+	for _, p := range paths {
+		fmt.Printf("Error: %s: %s\n", p, errs[p])
+	}
+	names := make([]string, 0, len(result.Duplicates))
+	for name := range result.Duplicates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("Duplicate: %s: %s\n", name, strings.Join(result.Duplicates[name], ", "))
+	}
+	return nil
+}
+
+func runSearch(c *command, args []string) error {
+	fs := newFlagSet(c)
+	asJSON := fs.Bool("json", false, "print JSON")
+	db := fs.String("db", "rescene.db", "store database file")
+	crc := fs.String("crc", "", "CRC32 of a packed file or a volume")
+	oso := fs.String("oso", "", "OSO hash")
+	size := fs.Uint64("size", 0, "size of a packed file")
+	name := fs.String("name", "", "file or release name pattern")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	s, err := store.Open(*db)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	var releases []*store.Release
+	switch {
+	case *crc != "":
+		var v uint64
+		if v, err = strconv.ParseUint(*crc, 16, 32); err == nil {
+			releases, err = s.ByCRC(uint32(v))
+		}
+	case *oso != "":
+		var v uint64
+		if v, err = strconv.ParseUint(*oso, 16, 64); err == nil {
+			releases, err = s.ByOSOHash(v)
+		}
+	case *size != 0:
+		releases, err = s.BySize(*size)
+	case *name != "":
+		releases, err = s.ByName(*name)
+	default:
+		fs.Usage()
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(releases)
+	}
+	for _, r := range releases {
+		fmt.Printf("%s\t%s\n", r.Name, r.Path)
+	}
+	return nil
+}
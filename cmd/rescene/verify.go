@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/rescene/rescene"
+)
+
+func printVolumeResults(results []*rescene.VolumeResult, asJSON bool) error {
+	ok := true
+	for _, r := range results {
+		ok = ok && r.OK()
+	}
+	if asJSON {
+		if err := printJSON(results); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range results {
+			switch {
+			case r.Missing:
+				fmt.Printf("MISSING  %s\n", r.Path)
+			case r.OK():
+				fmt.Printf("OK       %s %08X\n", r.Path, r.CRC)
+			case r.Size != r.ExpectedSize:
+				fmt.Printf("SIZE     %s %d (expected %d)\n", r.Path, r.Size, r.ExpectedSize)
+			default:
+				fmt.Printf("CRC      %s %08X (expected %08X)\n", r.Path, r.CRC, r.ExpectedCRC)
+			}
+		}
+	}
+	if !ok {
+		return errMismatch
+	}
+	return nil
+}
+
+func runVerify(c *command, args []string) error {
+	fs := newFlagSet(c)
+	asJSON := fs.Bool("json", false, "print JSON")
+	dir := fs.String("d", ".", "release directory")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	s, err := readSrr(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	results, err := s.Verify(*dir)
+	if err != nil {
+		return err
+	}
+	return printVolumeResults(results, *asJSON)
+}
@@ -0,0 +1,473 @@
+package rescene
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RarExecutable is a local RAR build. Command is the command line running
+// it, such as {"/opt/rar380/rar"} or {"wine", "rar380.exe"}. Version is
+// major*100+minor, 380 for RAR 3.80.
+type RarExecutable struct {
+	Command []string
+	Version int
+}
+
+// RarRegistry lists the RAR builds ReconstructCompressed may recompress
+// files with. Nothing is downloaded: only the builds added here are used.
+type RarRegistry struct {
+	Executables []*RarExecutable
+}
+
+var reRarBanner = regexp.MustCompile(`RAR ([0-9]+)\.([0-9]+)`)
+
+// Add registers a RAR build. A zero version is read from the banner the
+// build prints when run without arguments.
+func (r *RarRegistry) Add(version int, command ...string) error {
+	if len(command) == 0 {
+		return ErrBadData
+	}
+	if strings.ContainsRune(command[0], filepath.Separator) {
+		// the build runs from a temporary directory
+		abs, err := filepath.Abs(command[0])
+		if err != nil {
+			return err
+		}
+		command = append([]string{abs}, command[1:]...)
+	}
+	if version == 0 {
+		var err error
+		if version, err = RarExecutableVersion(command...); err != nil {
+			return err
+		}
+	}
+	r.Executables = append(r.Executables, &RarExecutable{
+		Command: command,
+		Version: version,
+	})
+	return nil
+}
+
+// reRarName matches the names Scan takes for RAR builds: rar, or rar
+// followed by a version such as rar380 or rar-5.00, with or without .exe.
+var reRarName = regexp.MustCompile(`(?i)^rar([-_. ]?[0-9][0-9.]*)?(\.exe)?$`)
+
+// Scan registers the RAR builds found in dir, the executable files named
+// like reRarName. The builds that do not run or print no RAR banner are
+// left out and returned by path; the error is that of reading dir.
+func (r *RarRegistry) Scan(dir string) (map[string]error, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	failed := make(map[string]error)
+	for _, e := range entries {
+		if e.IsDir() || e.Mode()&0111 == 0 || !reRarName.MatchString(e.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if err := r.Add(0, path); err != nil {
+			failed[path] = err
+		}
+	}
+	return failed, nil
+}
+
+// RarExecutableVersion runs a RAR build without arguments and reads its
+// version from the banner. A build that prints no banner returns ErrNoRar,
+// or a RarError when it failed to run.
+func RarExecutableVersion(command ...string) (int, error) {
+	out, err := exec.Command(command[0], command[1:]...).CombinedOutput()
+	m := reRarBanner.FindSubmatch(out)
+	if m == nil {
+		if err != nil {
+			return 0, &RarError{Command: command, Output: string(bytes.TrimSpace(out)), Err: err}
+		}
+		return 0, ErrNoRar
+	}
+	major, _ := strconv.Atoi(string(m[1]))
+	minor, _ := strconv.Atoi(string(m[2]))
+	return major*100 + minor, nil
+}
+
+// Candidates returns the builds able to write the packed data of the given
+// file headers, newest first. The highest unpack version, the highest
+// method and the largest dictionary of the compressed files rule builds
+// out; stored files need no build.
+func (r *RarRegistry) Candidates(heads []*FileHeadBlock) []*RarExecutable {
+	var unpackVersion, method uint8
+	dictSize := 0
+	for _, h := range heads {
+		if !h.IsCompressed() {
+			continue
+		}
+		if h.UnpackVersion > unpackVersion {
+			unpackVersion = h.UnpackVersion
+		}
+		if h.Method > method {
+			method = h.Method
+		}
+		if d := h.GetDictSize(); d > dictSize {
+			dictSize = d
+		}
+	}
+	c := make([]*RarExecutable, 0)
+	if method == 0 || method > 0x35 {
+		return c
+	}
+	low, high := 0, 0
+	switch {
+	case unpackVersion < 20:
+		low, high = 150, 200
+	case unpackVersion < 29:
+		low, high = 200, 290
+	default:
+		low, high = 290, 1<<30
+	}
+	for _, e := range r.Executables {
+		if e.Version >= low && e.Version < high && dictSize <= e.maxDictSize() {
+			c = append(c, e)
+		}
+	}
+	sort.SliceStable(c, func(i, j int) bool {
+		return c[i].Version > c[j].Version
+	})
+	return c
+}
+
+// maxDictSize is the largest dictionary, in KB, the build writes.
+func (e *RarExecutable) maxDictSize() int {
+	switch {
+	case e.Version < 200:
+		return 64
+	case e.Version < 290:
+		return 1024
+	}
+	return 4096
+}
+
+// args returns the command line adding files to an archive with the given
+// method, dictionary size in KB and solid setting. -cfg- keeps the switches
+// of a rar.ini or of the RAR environment variable out of the archive.
+func (e *RarExecutable) args(method uint8, dictSize int, solid bool, archive string, files []string) []string {
+	args := append([]string{}, e.Command[1:]...)
+	args = append(args, "a", "-cfg-", "-y", "-m"+strconv.Itoa(int(method)-0x30))
+	if e.Version >= 500 {
+		args = append(args, "-ma4", "-md"+strconv.Itoa(dictSize)+"k")
+	} else {
+		args = append(args, "-md"+strconv.Itoa(dictSize))
+	}
+	if solid {
+		args = append(args, "-s")
+	} else {
+		args = append(args, "-s-")
+	}
+	args = append(args, archive)
+	return append(args, files...)
+}
+
+// findPackedFile is openPackedFile returning the path instead.
+func findPackedFile(dir, name string) (string, error) {
+	r, err := openPackedFile(dir, name)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	return filepath.Abs(r.Name())
+}
+
+func packedName(name string) string {
+	return strings.ReplaceAll(name, "\\", "/")
+}
+
+// rarSet is what recompressing an archive set needs from its headers.
+type rarSet struct {
+	all   []*FileHeadBlock // every file header of the set
+	heads []*FileHeadBlock // the headers starting a file with data
+	sizes map[string]int   // the packed size by packed file name
+	solid bool
+}
+
+// rarSet reads the file headers of an archive set.
+func (f *SrrFile) rarSet(set *ArchiveSet) *rarSet {
+	s := &rarSet{sizes: make(map[string]int)}
+	for _, v := range set.Volumes {
+		for _, h := range v.FileHeads {
+			s.all = append(s.all, h)
+			s.sizes[packedName(h.GetFileName())] += h.GetPackSize()
+			if !h.Flag(LHD_SPLIT_BEFORE) && h.GetPackSize() > 0 {
+				s.heads = append(s.heads, h)
+			}
+			s.solid = s.solid || h.Flag(LHD_SOLID)
+		}
+	}
+	for _, b := range f.Blocks {
+		if h, ok := b.Header.(*MainHeadBlock); ok && b.Volume != nil && set.Volumes[0] == b.Volume {
+			s.solid = s.solid || h.Flag(MHD_SOLID)
+		}
+	}
+	return s
+}
+
+// recompress runs exe on the extracted files of an archive set and stores
+// the packed data of each file in workDir. It returns the path of that data
+// by packed file name. Stored files of a set that is not solid are used as
+// they are.
+func (s *rarSet) recompress(exe *RarExecutable, inputDir, workDir string) (map[string]string, error) {
+	packed := make(map[string]string)
+
+	// a solid archive is compressed in one go, other files one by one
+	groups := make([][]*FileHeadBlock, 0)
+	if s.solid {
+		groups = append(groups, s.heads)
+	} else {
+		for _, h := range s.heads {
+			if h.IsCompressed() {
+				groups = append(groups, []*FileHeadBlock{h})
+				continue
+			}
+			path, err := findPackedFile(inputDir, packedName(h.GetFileName()))
+			if err != nil {
+				return nil, err
+			}
+			packed[packedName(h.GetFileName())] = path
+		}
+	}
+	for run, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		dir := filepath.Join(workDir, strconv.Itoa(run+1))
+		src := filepath.Join(dir, "src")
+		names := make([]string, 0, len(group))
+		method, dictSize := group[0].Method, group[0].GetDictSize()
+		for _, h := range group {
+			name := packedName(h.GetFileName())
+			path, err := findPackedFile(inputDir, name)
+			if err != nil {
+				return nil, err
+			}
+			link := filepath.Join(src, filepath.FromSlash(name))
+			if err = os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+				return nil, err
+			}
+			if err = os.Symlink(path, link); err != nil {
+				return nil, err
+			}
+			names = append(names, filepath.FromSlash(name))
+			if h.Method > method {
+				method = h.Method
+			}
+			if d := h.GetDictSize(); d > dictSize {
+				dictSize = d
+			}
+		}
+		archive := filepath.Join(dir, "out.rar")
+		args := exe.args(method, dictSize, s.solid, archive, names)
+		cmd := exec.Command(exe.Command[0], args...)
+		cmd.Dir = src
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return nil, &RarError{Command: exe.Command, Output: string(bytes.TrimSpace(out)), Err: err}
+		}
+		err := readPackedData(archive, func(h *FileHeadBlock, r io.Reader) error {
+			name := packedName(h.GetFileName())
+			path := filepath.Join(dir, "packed"+strconv.Itoa(len(packed)))
+			out, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			n, err := io.Copy(out, r)
+			out.Close()
+			if err != nil {
+				return err
+			}
+			if int(n) != s.sizes[name] {
+				// another build or other settings
+				return ErrCRC
+			}
+			packed[name] = path
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return packed, nil
+}
+
+// readPackedData calls fn with the packed data of every file of a single
+// volume RAR archive.
+func readPackedData(path string, fn func(h *FileHeadBlock, r io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for {
+		b := make([]byte, 7)
+		if _, err := io.ReadFull(file, b); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return ErrBadFile
+		}
+		header := &RarHeader{}
+		if err := header.Parse(b); err != nil {
+			return err
+		}
+		if header.Size < 7 {
+			return ErrBadFile
+		}
+		b = append(b, make([]byte, header.GetSize()-7)...)
+		if _, err := io.ReadFull(file, b[7:]); err != nil {
+			return ErrBadFile
+		}
+		skip := 0
+		switch header.Type {
+		case FileHead:
+			block := &FileHeadBlock{RarHeader: *header}
+			if err := block.Parse(b); err != nil {
+				return err
+			}
+			pos, err := file.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+			if err = fn(block, io.LimitReader(file, int64(block.GetPackSize()))); err != nil {
+				return err
+			}
+			if _, err = file.Seek(pos+int64(block.GetPackSize()), io.SeekStart); err != nil {
+				return err
+			}
+		case NewSubHead:
+			block := &NewSubHeadBlock{RarHeader: *header}
+			if err := block.Parse(b); err != nil {
+				return err
+			}
+			skip = block.GetPackSize()
+		case ProtectHead:
+			block := &ProtectHeadBlock{RarHeader: *header}
+			if err := block.Parse(b); err != nil {
+				return err
+			}
+			skip = int(block.PackedSize)
+		case EndArcHead:
+			return nil
+		}
+		if _, err := file.Seek(int64(skip), io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+}
+
+// ReconstructCompressed rebuilds the volumes of a compressed archive. The
+// extracted files of each archive set are compressed again with each RAR
+// build of the registry able to write the settings found in the headers of
+// the set, newest first, until the rebuilt volumes of the set match the
+// sizes and SFV CRCs of the SRR.
+func (f *SrrFile) ReconstructCompressed(opts ReconstructOptions) ([]*VolumeResult, error) {
+	if opts.Registry == nil {
+		return nil, ErrNoRar
+	}
+	sets := f.ArchiveSets()
+	heads := 0
+	for _, v := range f.RarFiles {
+		heads += len(v.FileHeads)
+	}
+	if heads == 0 {
+		return nil, ErrNoData
+	}
+	tmp, err := ioutil.TempDir(opts.TempDir, "rescene")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	results := make([]*VolumeResult, 0)
+	err = nil
+	for i, set := range sets {
+		r, setErr := f.reconstructSet(opts, set, filepath.Join(tmp, strconv.Itoa(i)))
+		results = append(results, r...)
+		if setErr != nil && err == nil {
+			err = setErr
+		}
+	}
+	return results, err
+}
+
+// reconstructSet rebuilds the volumes of one archive set.
+func (f *SrrFile) reconstructSet(opts ReconstructOptions, set *ArchiveSet, workDir string) ([]*VolumeResult, error) {
+	volumes := make(map[*RarFile]bool)
+	for _, v := range set.Volumes {
+		volumes[v] = true
+	}
+	s := f.rarSet(set)
+	compressed := false
+	for _, h := range s.all {
+		compressed = compressed || h.IsCompressed()
+	}
+	if !compressed {
+		return f.writeVolumes(opts, volumes, func(name string) (*os.File, error) {
+			return openPackedFile(opts.InputDir, name)
+		})
+	}
+	candidates := opts.Registry.Candidates(s.all)
+	if len(candidates) == 0 {
+		return nil, ErrNoRar
+	}
+
+	var results []*VolumeResult
+	err := ErrNoRar
+	for i, exe := range candidates {
+		var packed map[string]string
+		packed, err = s.recompress(exe, opts.InputDir, filepath.Join(workDir, strconv.Itoa(i)))
+		if err != nil {
+			continue
+		}
+		results, err = f.writeVolumes(opts, volumes, func(name string) (*os.File, error) {
+			path, ok := packed[packedName(name)]
+			if !ok {
+				return nil, ErrNotFound
+			}
+			return os.Open(path)
+		})
+		if err != nil {
+			continue
+		}
+		ok := true
+		for _, r := range results {
+			ok = ok && r.OK()
+		}
+		if ok {
+			return results, nil
+		}
+		err = ErrCRC
+	}
+	return results, err
+}
+
+// RarError is returned when a RAR build fails.
+type RarError struct {
+	Command []string
+	Output  string
+	Err     error
+}
+
+func (e *RarError) Error() string {
+	s := "rescene : " + strings.Join(e.Command, " ") + ": " + e.Err.Error()
+	if e.Output != "" {
+		s += ": " + e.Output
+	}
+	return s
+}
+
+func (e *RarError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,241 @@
+package rescene
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// rarPacked stands for the packed data a RAR build writes: the method is
+// mixed in so that other settings give other data.
+func rarPacked(data []byte, method uint8) []byte {
+	p := make([]byte, len(data))
+	for i, c := range data {
+		p[i] = c ^ method
+	}
+	return p
+}
+
+// rarCompressedHead is rarFileHead with another method and unpack version.
+func rarCompressedHead(name string, data []byte, method, unpackVersion uint8, flags RarHeaderFlag) []byte {
+	b := rarFileHead(FileHead, flags, name, len(data), len(data), crc32.ChecksumIEEE(data), nil)
+	b[24], b[25] = unpackVersion, method
+	binary.LittleEndian.PutUint16(b, uint16(crc32.ChecksumIEEE(b[2:])))
+	return b
+}
+
+// TestHelperRar is not a test: it runs as a RAR 3.80 build for the tests
+// of ReconstructCompressed.
+func TestHelperRar(t *testing.T) {
+	if os.Getenv("RESCENE_HELPER_RAR") != "1" {
+		return
+	}
+	args := os.Args
+	for i, a := range args {
+		if a == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	if len(args) == 0 {
+		fmt.Println("RAR 3.80   Copyright (c) 1993-2008 Alexander Roshal")
+		os.Exit(0)
+	}
+	var method uint8
+	cfg := true
+	files := make([]string, 0)
+	for _, a := range args[1:] {
+		switch {
+		case a == "-cfg-":
+			cfg = false
+		case strings.HasPrefix(a, "-m") && !strings.HasPrefix(a, "-md"):
+			m, _ := strconv.Atoi(a[2:])
+			method = 0x30 + uint8(m)
+		case !strings.HasPrefix(a, "-"):
+			files = append(files, a)
+		}
+	}
+	if cfg {
+		fmt.Println("the switches of rar.ini apply")
+		os.Exit(1)
+	}
+	archive := rarMainHead(0)
+	for _, name := range files[1:] {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			os.Exit(1)
+		}
+		archive = append(archive, rarCompressedHead(name, data, method, 29, 0)...)
+		archive = append(archive, rarPacked(data, method)...)
+	}
+	archive = append(archive, rarEndArc(0)...)
+	if ioutil.WriteFile(files[0], archive, 0644) != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestReconstructCompressedSets(t *testing.T) {
+	os.Setenv("RESCENE_HELPER_RAR", "1")
+	defer os.Unsetenv("RESCENE_HELPER_RAR")
+	reg := &RarRegistry{}
+	if err := reg.Add(0, os.Args[0], "-test.run=TestHelperRar", "--"); err != nil {
+		t.Fatal(err)
+	}
+	if len(reg.Executables) != 1 || reg.Executables[0].Version != 380 {
+		t.Fatalf("registered %+v", reg.Executables)
+	}
+
+	// the same file in two sets packed with other methods
+	dir := t.TempDir()
+	data := testData(2000, 1)
+	writeTestFile(t, filepath.Join(dir, "in", "file.bin"), data)
+	volumes := map[string][]byte{}
+	for name, method := range map[string]uint8{"a.rar": 0x33, "b.rar": 0x35} {
+		v := rarMainHead(0)
+		v = append(v, rarCompressedHead("file.bin", data, method, 29, 0)...)
+		v = append(v, rarPacked(data, method)...)
+		v = append(v, rarEndArc(0)...)
+		volumes[name] = v
+		writeTestFile(t, filepath.Join(dir, "rel", name), v)
+	}
+
+	f := srrOf(t, filepath.Join(dir, "rel"), []string{"a.rar", "b.rar"}, CreateOptions{})
+	results, err := f.Reconstruct(ReconstructOptions{
+		InputDir:  filepath.Join(dir, "in"),
+		OutputDir: filepath.Join(dir, "out"),
+		Registry:  reg,
+		TempDir:   dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d volumes, want 2", len(results))
+	}
+	for name, want := range volumes {
+		got, err := ioutil.ReadFile(filepath.Join(dir, "out", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("rebuilt %s differs", name)
+		}
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	reg := &RarRegistry{}
+	for _, v := range []int{150, 200, 250, 290, 380, 500} {
+		reg.Executables = append(reg.Executables, &RarExecutable{Command: []string{"rar"}, Version: v})
+	}
+	head := func(method, unpackVersion uint8, dict RarHeaderFlag) *FileHeadBlock {
+		h := &FileHeadBlock{}
+		h.Method, h.UnpackVersion = method, unpackVersion
+		h.Flags = dict
+		return h
+	}
+	tests := []struct {
+		name  string
+		heads []*FileHeadBlock
+		want  []int
+	}{
+		{"RAR 1.5", []*FileHeadBlock{head(0x33, 15, 0)}, []int{150}},
+		{"RAR 2.x", []*FileHeadBlock{head(0x33, 20, 0)}, []int{250, 200}},
+		{"RAR 3.x", []*FileHeadBlock{head(0x35, 29, 0)}, []int{500, 380, 290}},
+		{"highest unpack version", []*FileHeadBlock{head(0x33, 20, 0), head(0x33, 29, 0)}, []int{500, 380, 290}},
+		{"stored files ignored", []*FileHeadBlock{head(0x30, 29, 0), head(0x33, 20, 0)}, []int{250, 200}},
+		// 4096 KB rules RAR 2.x out
+		{"dictionary", []*FileHeadBlock{head(0x33, 20, 0), head(0x33, 20, 0x00c0)}, []int{}},
+		{"unknown method", []*FileHeadBlock{head(0x36, 29, 0)}, []int{}},
+		{"stored only", []*FileHeadBlock{head(0x30, 29, 0)}, []int{}},
+	}
+	for _, tt := range tests {
+		got := make([]int, 0)
+		for _, e := range reg.Candidates(tt.heads) {
+			got = append(got, e.Version)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRarRegistryScan(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the builds are shell scripts")
+	}
+	os.Setenv("RESCENE_HELPER_RAR", "1")
+	defer os.Unsetenv("RESCENE_HELPER_RAR")
+	dir := t.TempDir()
+	ran := filepath.Join(dir, "ran")
+	scripts := map[string]string{
+		// runs as RAR 3.80
+		"rar380": fmt.Sprintf("exec %q -test.run=TestHelperRar -- \"$@\"", os.Args[0]),
+		// no banner
+		"rar": "echo usage",
+		// fails to run
+		"rar-5.00.exe": "exit 3",
+		// not a RAR build by its name
+		"unrar":    "touch " + ran,
+		"rar.sh":   "touch " + ran,
+		"rarcrack": "touch " + ran,
+	}
+	for name, script := range scripts {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestFile(t, filepath.Join(dir, "rar290"), []byte("#!/bin/sh\ntouch "+ran+"\n"))
+
+	reg := &RarRegistry{}
+	failed, err := reg.Scan(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reg.Executables) != 1 || reg.Executables[0].Version != 380 || reg.Executables[0].Command[0] != filepath.Join(dir, "rar380") {
+		t.Errorf("registered %+v", reg.Executables)
+	}
+	if len(failed) != 2 || failed[filepath.Join(dir, "rar")] != ErrNoRar {
+		t.Errorf("failed %v", failed)
+	}
+	var rarErr *RarError
+	if err := failed[filepath.Join(dir, "rar-5.00.exe")]; !errors.As(err, &rarErr) {
+		t.Errorf("failed to run: %v", err)
+	}
+	if _, err := os.Stat(ran); err == nil {
+		t.Error("ran a file not named like a RAR build")
+	}
+	if _, err := reg.Scan(filepath.Join(dir, "missing")); err == nil {
+		t.Error("missing directory: no error")
+	}
+}
+
+func TestRarArgs(t *testing.T) {
+	tests := []struct {
+		version int
+		method  uint8
+		dict    int
+		solid   bool
+		args    string
+	}{
+		{380, 0x33, 4096, false, "-x a -cfg- -y -m3 -md4096 -s- out.rar a b"},
+		{290, 0x35, 64, true, "-x a -cfg- -y -m5 -md64 -s out.rar a b"},
+		{500, 0x31, 32768, false, "-x a -cfg- -y -m1 -ma4 -md32768k -s- out.rar a b"},
+	}
+	for _, tt := range tests {
+		e := &RarExecutable{Command: []string{"rar", "-x"}, Version: tt.version}
+		if args := strings.Join(e.args(tt.method, tt.dict, tt.solid, "out.rar", []string{"a", "b"}), " "); args != tt.args {
+			t.Errorf("%d: %s, want %s", tt.version, args, tt.args)
+		}
+	}
+}
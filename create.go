@@ -0,0 +1,281 @@
+package rescene
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CreateOptions lists what goes into a new SRR besides the RAR headers.
+// StoredFiles maps the name inside the SRR to a path on disk, and
+// HashedFiles does the same for the files to compute an OSO hash for.
+type CreateOptions struct {
+	AppName     string
+	StoredFiles []*CreateEntry
+	HashedFiles []*CreateEntry
+}
+
+type CreateEntry struct {
+	Name string
+	Path string
+}
+
+var rarMarker = []byte{0x52, 0x61, 0x72, 0x21, 0x1A, 0x07, 0x00}
+
+func writeSrrHeader(w io.Writer, t RarHeaderType, flags RarHeaderFlag, size int) error {
+	h := RarHeader{
+		CRC:   uint16(t)<<8 | uint16(t),
+		Type:  t,
+		Flags: flags,
+		Size:  uint16(size),
+	}
+	return binary.Write(w, binary.LittleEndian, &h)
+}
+
+func writeSrrVolHead(w io.Writer, appName string) error {
+	if appName == "" {
+		return writeSrrHeader(w, SrrVolHead, 0, 7)
+	}
+	if err := writeSrrHeader(w, SrrVolHead, SRR_APP_NAME, 7+2+len(appName)); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint16(len(appName))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, appName)
+	return err
+}
+
+func writeSrrStoredFile(w io.Writer, name string, data []byte) error {
+	if err := writeSrrHeader(w, SrrStoredFileHead, HAS_DATA, 7+4+2+len(name)); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint16(len(name))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, name); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func writeSrrOSOHash(w io.Writer, h *OSOHash) error {
+	if err := writeSrrHeader(w, OSOHashHead, 0, 7+8+8+2+len(h.Path)); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, h.Size); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, h.Hash); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint16(len(h.Path))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, h.Path)
+	return err
+}
+
+func writeSrrRarFile(w io.Writer, name string) error {
+	if err := writeSrrHeader(w, SrrRarSubBlockHead, 0, 7+2+len(name)); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint16(len(name))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, name)
+	return err
+}
+
+// writeRarHeaders copies the headers of a RAR volume to w, leaving out the
+// packed file data and the recovery records. Bytes found after the end of
+// archive block are kept as an SRR padding block.
+func writeRarHeaders(w io.Writer, r io.ReadSeeker) error {
+	mark := make([]byte, len(rarMarker))
+	if _, err := io.ReadFull(r, mark); err != nil || !bytes.Equal(mark, rarMarker) {
+		return ErrBadFile
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	for {
+		b := make([]byte, 7)
+		if _, err := io.ReadFull(r, b); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return ErrBadFile
+		}
+		header := &RarHeader{}
+		if err := header.Parse(b); err != nil {
+			return err
+		}
+		if header.Size < 7 {
+			return ErrBadFile
+		}
+		b = append(b, make([]byte, header.GetSize()-7)...)
+		if _, err := io.ReadFull(r, b[7:]); err != nil {
+			return ErrBadFile
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		skip := 0
+		switch header.Type {
+		case FileHead:
+			block := &FileHeadBlock{RarHeader: *header}
+			if err := block.Parse(b); err != nil {
+				return err
+			}
+			skip = block.GetPackSize()
+		case NewSubHead:
+			block := &NewSubHeadBlock{RarHeader: *header}
+			if err := block.Parse(b); err != nil {
+				return err
+			}
+			if block.GetFileName() == "RR" {
+				skip = block.GetPackSize()
+			} else if _, err := io.CopyN(w, r, int64(block.GetPackSize())); err != nil {
+				return ErrBadFile
+			}
+		case ProtectHead:
+			block := &ProtectHeadBlock{RarHeader: *header}
+			if err := block.Parse(b); err != nil {
+				return err
+			}
+			skip = int(block.PackedSize)
+		case SubHead:
+			// RAR 2.x streams, ACLs... are kept with their data
+			if header.Flag(HAS_DATA) && len(b) >= 11 {
+				if _, err := io.CopyN(w, r, int64(binary.LittleEndian.Uint32(b[7:11]))); err != nil {
+					return ErrBadFile
+				}
+			}
+		case EndArcHead:
+			pad, err := ioutil.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			if len(pad) == 0 {
+				return nil
+			}
+			if err := writeSrrHeader(w, SrrRarPadHead, HAS_DATA, 7+4); err != nil {
+				return err
+			}
+			if err := binary.Write(w, binary.LittleEndian, uint32(len(pad))); err != nil {
+				return err
+			}
+			_, err = w.Write(pad)
+			return err
+		}
+		if _, err := r.Seek(int64(skip), io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+}
+
+// CreateSrr writes an SRR for the given RAR volumes to w. Volumes are stored
+// under their base name, in the order given.
+func CreateSrr(w io.Writer, volumes []string, opts CreateOptions) error {
+	entries := make([]*CreateEntry, len(volumes))
+	for i, v := range volumes {
+		entries[i] = &CreateEntry{Name: filepath.Base(v), Path: v}
+	}
+	return createSrr(w, entries, opts)
+}
+
+// createSrr writes an SRR for the given RAR volumes, each stored under the
+// name of its entry.
+func createSrr(w io.Writer, volumes []*CreateEntry, opts CreateOptions) error {
+	if err := writeSrrVolHead(w, opts.AppName); err != nil {
+		return err
+	}
+	for _, e := range opts.StoredFiles {
+		data, err := ioutil.ReadFile(e.Path)
+		if err != nil {
+			return err
+		}
+		// stored paths use forward slashes, as pyReScene writes them
+		if err = writeSrrStoredFile(w, strings.ReplaceAll(e.Name, "\\", "/"), data); err != nil {
+			return err
+		}
+	}
+	for _, v := range volumes {
+		file, err := os.Open(v.Path)
+		if err != nil {
+			return err
+		}
+		if err = writeSrrRarFile(w, v.Name); err == nil {
+			err = writeRarHeaders(w, file)
+		}
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	for _, e := range opts.HashedFiles {
+		h, err := OSOHashFile(e.Path)
+		if err != nil {
+			return err
+		}
+		h.Path = e.Name
+		if err = writeSrrOSOHash(w, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OSOHashFile computes the OpenSubtitles hash of a file: its size plus the
+// 64-bit little endian words of the first and last 64 KiB.
+func OSOHashFile(path string) (*OSOHash, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return osoHashAt(filepath.Base(path), file, fi.Size())
+}
+
+// osoHashAt computes the OSO hash of the size bytes of r.
+func osoHashAt(name string, r io.ReaderAt, size int64) (*OSOHash, error) {
+	head := make([]byte, 65536)
+	tail := make([]byte, 65536)
+	if _, err := r.ReadAt(head, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	offset := size - 65536
+	if offset < 0 {
+		offset = 0
+	}
+	if _, err := r.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return &OSOHash{
+		Path: name,
+		Size: uint64(size),
+		Hash: osoSum(uint64(size), head, tail),
+	}, nil
+}
+
+func osoSum(size uint64, head, tail []byte) uint64 {
+	sum := size
+	for i := 0; i+8 <= len(head); i += 8 {
+		sum += binary.LittleEndian.Uint64(head[i:])
+	}
+	for i := 0; i+8 <= len(tail); i += 8 {
+		sum += binary.LittleEndian.Uint64(tail[i:])
+	}
+	return sum
+}
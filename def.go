@@ -19,3 +19,24 @@ var ErrNoData = errors.New("rescene : no data")
 
 // ErrDuplSFV file referenced twice in sfv
 var ErrDuplSFV = errors.New("rescene : duplicate file in sfv")
+
+// ErrFirstVolume first volume flag missing or misplaced in a volume set
+var ErrFirstVolume = errors.New("rescene : first volume flag mismatch")
+
+// ErrCompressed operation needs stored (uncompressed) RAR volumes
+var ErrCompressed = errors.New("rescene : compressed archive")
+
+// ErrNotFound file not found
+var ErrNotFound = errors.New("rescene : file not found")
+
+// ErrExists file already present
+var ErrExists = errors.New("rescene : file already exists")
+
+// ErrNoRar no RAR build available for the archive
+var ErrNoRar = errors.New("rescene : no matching rar executable")
+
+// ErrUnsupported packing method not supported
+var ErrUnsupported = errors.New("rescene : unsupported packing method")
+
+// ErrBadPath path of the SRR leading out of the directory it is used in
+var ErrBadPath = errors.New("rescene : path outside of the directory")
@@ -0,0 +1,142 @@
+package rescene
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Marshal returns the SRR as bytes. Blocks are written as they were read,
+// so an SRR that was not edited comes out unchanged.
+func (f *SrrFile) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, b := range f.Blocks {
+		buf.Write(b.Raw)
+	}
+	return buf.Bytes(), nil
+}
+
+// update parses the SRR made of blocks and replaces f with it, so that the
+// derived fields (StoredFiles, SFV CRCs...) follow the edit. Nested files
+// are parsed again when f had them parsed.
+func (f *SrrFile) update(blocks []Block) error {
+	var buf bytes.Buffer
+	for _, b := range blocks {
+		buf.Write(b.Raw)
+	}
+	g := &SrrFile{}
+	if err := g.Unmarshal(buf.Bytes()); err != nil {
+		return err
+	}
+	if f.nested {
+		// the files that do not parse stay opaque, as they did
+		g.ParseNested()
+	}
+	*f = *g
+	return nil
+}
+
+func storedPath(path string) string {
+	return strings.Trim(strings.ReplaceAll(path, "\\", "/"), "/")
+}
+
+// storedBlock returns the block of a stored file, its path written as
+// given.
+func storedBlock(path string, data []byte) (Block, error) {
+	if path == "" || len(path) > 0xFFFF-13 {
+		return Block{}, ErrBadData
+	}
+	var buf bytes.Buffer
+	if err := writeSrrStoredFile(&buf, path, data); err != nil {
+		return Block{}, err
+	}
+	return Block{
+		Type:   SrrStoredFileHead,
+		Header: &SrrStoredFileHeadBlock{},
+		Raw:    buf.Bytes(),
+	}, nil
+}
+
+// storedFileIndex returns the position in Blocks of the stored file, or -1.
+// Paths are compared with either path separator.
+func (f *SrrFile) storedFileIndex(path string) int {
+	path = storedPath(path)
+	for i, b := range f.Blocks {
+		if h, ok := b.Header.(*SrrStoredFileHeadBlock); ok && storedPath(string(h.FileName)) == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddStoredFile stores a new file in the SRR. Like pyReScene, it goes after
+// the SRR header and the files already stored, before the first RAR volume.
+// The path is stored as given.
+func (f *SrrFile) AddStoredFile(path string, data []byte) error {
+	if f.storedFileIndex(path) >= 0 {
+		return ErrExists
+	}
+	block, err := storedBlock(path, data)
+	if err != nil {
+		return err
+	}
+	pos := 0
+	for i, b := range f.Blocks {
+		if b.Type == SrrRarSubBlockHead {
+			break
+		}
+		if b.Type == SrrVolHead || b.Type == SrrStoredFileHead {
+			pos = i + 1
+		}
+	}
+	blocks := make([]Block, 0, len(f.Blocks)+1)
+	blocks = append(blocks, f.Blocks[:pos]...)
+	blocks = append(blocks, block)
+	blocks = append(blocks, f.Blocks[pos:]...)
+	return f.update(blocks)
+}
+
+// RemoveStoredFile removes a stored file from the SRR.
+func (f *SrrFile) RemoveStoredFile(path string) error {
+	i := f.storedFileIndex(path)
+	if i < 0 {
+		return ErrNotFound
+	}
+	blocks := make([]Block, 0, len(f.Blocks)-1)
+	blocks = append(blocks, f.Blocks[:i]...)
+	blocks = append(blocks, f.Blocks[i+1:]...)
+	return f.update(blocks)
+}
+
+// RenameStoredFile changes the path of a stored file, keeping its place.
+// The new path is stored as given.
+func (f *SrrFile) RenameStoredFile(path, newPath string) error {
+	i := f.storedFileIndex(path)
+	if i < 0 {
+		return ErrNotFound
+	}
+	if j := f.storedFileIndex(newPath); j >= 0 && j != i {
+		return ErrExists
+	}
+	return f.setStoredBlock(i, newPath, f.Blocks[i].Header.(*SrrStoredFileHeadBlock).FileData)
+}
+
+// ReplaceStoredFile changes the content of a stored file, keeping its place
+// and its stored path.
+func (f *SrrFile) ReplaceStoredFile(path string, data []byte) error {
+	i := f.storedFileIndex(path)
+	if i < 0 {
+		return ErrNotFound
+	}
+	return f.setStoredBlock(i, string(f.Blocks[i].Header.(*SrrStoredFileHeadBlock).FileName), data)
+}
+
+func (f *SrrFile) setStoredBlock(i int, path string, data []byte) error {
+	block, err := storedBlock(path, data)
+	if err != nil {
+		return err
+	}
+	blocks := make([]Block, len(f.Blocks))
+	copy(blocks, f.Blocks)
+	blocks[i] = block
+	return f.update(blocks)
+}
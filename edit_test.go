@@ -0,0 +1,111 @@
+package rescene
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+)
+
+// rarBlocks returns the bytes of the blocks of the RAR volumes.
+func rarBlocks(f *SrrFile) []byte {
+	var b []byte
+	for _, block := range f.Blocks {
+		if block.Volume != nil {
+			b = append(b, block.Raw...)
+		}
+	}
+	return b
+}
+
+func storedPaths(f *SrrFile) []string {
+	paths := make([]string, len(f.StoredFiles))
+	for i, sf := range f.StoredFiles {
+		paths[i] = sf.Path
+	}
+	return paths
+}
+
+func TestEditStoredFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{"movie.mkv": testData(2500, 1)}
+	volumes := rarSplit(t, dir, "movie", 1000, files, "movie.mkv")
+	writeTestFile(t, filepath.Join(dir, "movie.nfo"), []byte("nfo"))
+	writeTestFile(t, filepath.Join(dir, "movie.sfv"), []byte("; sfv\r\n"))
+	f := srrOf(t, dir, volumes, CreateOptions{StoredFiles: []*CreateEntry{
+		{Name: "movie.nfo", Path: filepath.Join(dir, "movie.nfo")},
+		{Name: "movie.sfv", Path: filepath.Join(dir, "movie.sfv")},
+	}})
+	original, err := f.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &SrrFile{}
+	if err = g.Unmarshal(original); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := g.Marshal(); !bytes.Equal(again, original) {
+		t.Fatal("Unmarshal and Marshal do not give the SRR back")
+	}
+	rar := rarBlocks(f)
+	if err = f.ParseNested(); err != nil {
+		t.Fatal(err)
+	}
+
+	srs := []byte("SRSF\x00\x00\x00\x00")
+	fd := srsFileData(0, "sample.mkv", testData(10, 2))
+	binary.LittleEndian.PutUint32(srs[4:], uint32(8+len(fd)))
+	srs = append(srs, fd...)
+	edits := []struct {
+		name  string
+		edit  func() error
+		paths []string
+	}{
+		{"add", func() error { return f.AddStoredFile(`Sample\movie.srs`, srs) },
+			[]string{"movie.nfo", "movie.sfv", `Sample\movie.srs`}},
+		{"add again", func() error {
+			if err := f.AddStoredFile("Sample/movie.srs", nil); err != ErrExists {
+				t.Errorf("adding a stored path again: %v", err)
+			}
+			return nil
+		}, []string{"movie.nfo", "movie.sfv", `Sample\movie.srs`}},
+		{"rename", func() error { return f.RenameStoredFile("movie.nfo", `Info\movie.nfo`) },
+			[]string{`Info\movie.nfo`, "movie.sfv", `Sample\movie.srs`}},
+		{"replace", func() error { return f.ReplaceStoredFile("Info/movie.nfo", []byte("new nfo")) },
+			[]string{`Info\movie.nfo`, "movie.sfv", `Sample\movie.srs`}},
+		{"remove", func() error { return f.RemoveStoredFile("movie.sfv") },
+			[]string{`Info\movie.nfo`, `Sample\movie.srs`}},
+	}
+	for _, e := range edits {
+		if err := e.edit(); err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		if paths := storedPaths(f); len(paths) != len(e.paths) {
+			t.Errorf("%s: stored %q, want %q", e.name, paths, e.paths)
+		} else {
+			for i := range paths {
+				if paths[i] != e.paths[i] {
+					t.Errorf("%s: stored %q, want %q", e.name, paths, e.paths)
+					break
+				}
+			}
+		}
+		if !bytes.Equal(rarBlocks(f), rar) {
+			t.Errorf("%s: the RAR blocks changed", e.name)
+		}
+		if f.StoredFiles[len(f.StoredFiles)-1].Srs == nil {
+			t.Errorf("%s: the nested SRS is not parsed", e.name)
+		}
+	}
+	if string(f.StoredFiles[0].Data) != "new nfo" {
+		t.Errorf("replaced data is %q", f.StoredFiles[0].Data)
+	}
+	edited, _ := f.Marshal()
+	g = &SrrFile{}
+	if err = g.Unmarshal(edited); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := g.Marshal(); !bytes.Equal(again, edited) {
+		t.Error("the edited SRR does not round trip")
+	}
+}
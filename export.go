@@ -0,0 +1,673 @@
+package rescene
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ExportVersion is the version of the JSON model written by ExportJSON and
+// described by schema/rescene.schema.json. It changes whenever a field is
+// renamed or removed.
+const ExportVersion = 1
+
+// ExportOptions controls ExportJSON and ExportYAML. Stored file data is left
+// out unless StoredData is set, in which case it is base64 encoded. Blocks
+// adds the raw block list of the SRR.
+type ExportOptions struct {
+	StoredData bool
+	Blocks     bool
+}
+
+type jsonSrrFile struct {
+	Version         int               `json:"version"`
+	Type            string            `json:"type"`
+	ApplicationName string            `json:"application_name"`
+	Compressed      bool              `json:"compressed"`
+	StoredFiles     []*jsonStoredFile `json:"stored_files"`
+	RarFiles        []*jsonRarFile    `json:"rar_files"`
+	PackedFiles     []*jsonPackedFile `json:"packed_files"`
+	OSOHashes       []*jsonOSOHash    `json:"oso_hashes"`
+	SFVComments     []string          `json:"sfv_comments"`
+	Blocks          []*jsonBlock      `json:"blocks,omitempty"`
+}
+
+type jsonBlock struct {
+	Offset int         `json:"offset"`
+	Size   int         `json:"size"`
+	Volume string      `json:"volume,omitempty"`
+	Header interface{} `json:"header"`
+}
+
+type jsonStoredFile struct {
+	Type string       `json:"type"`
+	Path string       `json:"path"`
+	Size int          `json:"size"`
+	Data string       `json:"data,omitempty"`
+	Srs  *jsonSrsFile `json:"srs,omitempty"`
+	Srr  *jsonSrrFile `json:"srr,omitempty"`
+}
+
+type jsonRarFile struct {
+	Type         string                `json:"type"`
+	Path         string                `json:"path"`
+	Size         int                   `json:"size"`
+	CRC          string                `json:"crc,omitempty"`
+	FirstVolume  bool                  `json:"first_volume"`
+	NewNumbering bool                  `json:"new_numbering"`
+	EndOfArchive bool                  `json:"end_of_archive"`
+	PackedFiles  []string              `json:"packed_files"`
+	Properties   jsonArchiveProperties `json:"properties"`
+	Comment      *jsonComment          `json:"comment,omitempty"`
+	AuthInfo     string                `json:"auth_info,omitempty"`
+	Streams      []*jsonStream         `json:"streams,omitempty"`
+	ACLs         []*jsonACL            `json:"acls,omitempty"`
+}
+
+type jsonServiceData struct {
+	Method     uint8  `json:"method"`
+	UnpackSize int    `json:"unpack_size"`
+	CRC        string `json:"crc"`
+}
+
+type jsonComment struct {
+	jsonServiceData
+	Text string `json:"text,omitempty"`
+}
+
+type jsonStream struct {
+	jsonServiceData
+	File string `json:"file"`
+	Name string `json:"name"`
+}
+
+type jsonACL struct {
+	jsonServiceData
+	File    string          `json:"file"`
+	Owner   string          `json:"owner,omitempty"`
+	Group   string          `json:"group,omitempty"`
+	Entries []*jsonACLEntry `json:"entries,omitempty"`
+}
+
+type jsonACLEntry struct {
+	Type  uint8  `json:"type"`
+	Flags uint8  `json:"flags"`
+	Mask  uint32 `json:"mask"`
+	SID   string `json:"sid"`
+}
+
+type jsonPackedFile struct {
+	Type       string             `json:"type"`
+	Path       string             `json:"path"`
+	Size       uint64             `json:"size"`
+	CRC        string             `json:"crc"`
+	Properties jsonFileProperties `json:"properties"`
+}
+
+type jsonArchiveProperties struct {
+	Volume           bool `json:"volume"`
+	Solid            bool `json:"solid"`
+	Locked           bool `json:"locked"`
+	HasRecovery      bool `json:"has_recovery"`
+	HasAuthInfo      bool `json:"has_auth_info"`
+	HasComment       bool `json:"has_comment"`
+	EncryptedHeaders bool `json:"encrypted_headers"`
+}
+
+type jsonFileProperties struct {
+	Encrypted     bool  `json:"encrypted"`
+	Salt          bool  `json:"salt"`
+	Solid         bool  `json:"solid"`
+	Directory     bool  `json:"directory"`
+	DictSize      int   `json:"dict_size"`
+	UnpackVersion uint8 `json:"unpack_version"`
+	Method        uint8 `json:"method"`
+}
+
+type jsonOSOHash struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+	Size uint64 `json:"size"`
+	Hash string `json:"hash"`
+}
+
+type jsonSrsFile struct {
+	Version int           `json:"version"`
+	Type    string        `json:"type"`
+	Blocks  []interface{} `json:"blocks"`
+}
+
+type jsonRarHeader struct {
+	Type       string `json:"type"`
+	HeaderCRC  string `json:"header_crc"`
+	HeaderType int    `json:"header_type"`
+	Flags      int    `json:"flags"`
+	HeaderSize int    `json:"header_size"`
+}
+
+type jsonSizedBlock struct {
+	Type string `json:"type"`
+	Size int    `json:"size"`
+}
+
+func hexCRC(crc uint32) string {
+	return fmt.Sprintf("%08x", crc)
+}
+
+func (d *ServiceData) export() jsonServiceData {
+	crc := hexCRC(d.CRC)
+	if d.crc16 {
+		crc = fmt.Sprintf("%04x", d.CRC)
+	}
+	return jsonServiceData{
+		Method:     d.Method,
+		UnpackSize: d.UnpackSize,
+		CRC:        crc,
+	}
+}
+
+func (h RarHeader) export(t string) jsonRarHeader {
+	return jsonRarHeader{
+		Type:       t,
+		HeaderCRC:  fmt.Sprintf("%04x", h.CRC),
+		HeaderType: int(h.Type),
+		Flags:      int(h.Flags),
+		HeaderSize: int(h.Size),
+	}
+}
+
+func (f *SrrFile) export(opts ExportOptions) *jsonSrrFile {
+	e := &jsonSrrFile{
+		Version:         ExportVersion,
+		Type:            "srr",
+		ApplicationName: f.ApplicationName,
+		Compressed:      f.RarCompressed,
+		StoredFiles:     make([]*jsonStoredFile, 0, len(f.StoredFiles)),
+		RarFiles:        make([]*jsonRarFile, 0, len(f.RarFiles)),
+		PackedFiles:     make([]*jsonPackedFile, 0, len(f.PackedFiles)),
+		OSOHashes:       make([]*jsonOSOHash, 0, len(f.OSOHashes)),
+		SFVComments:     make([]string, 0, len(f.SFVComments)),
+	}
+	for _, v := range f.StoredFiles {
+		s := &jsonStoredFile{
+			Type: "stored_file",
+			Path: v.Path,
+			Size: len(v.Data),
+		}
+		if opts.StoredData {
+			s.Data = base64.StdEncoding.EncodeToString(v.Data)
+		}
+		if v.Srs != nil {
+			s.Srs = v.Srs.export()
+		}
+		if v.Srr != nil {
+			s.Srr = v.Srr.export(opts)
+		}
+		e.StoredFiles = append(e.StoredFiles, s)
+	}
+	for _, v := range f.RarFiles {
+		r := &jsonRarFile{
+			Type:         "rar_file",
+			Path:         v.Path,
+			Size:         v.Size,
+			FirstVolume:  v.IsFirst,
+			NewNumbering: v.IsNewFmt,
+			EndOfArchive: v.HasEndArc,
+			PackedFiles:  make([]string, 0, len(v.PackedFiles)),
+			Properties:   jsonArchiveProperties(v.Properties),
+		}
+		if v.CRC != 0 {
+			r.CRC = hexCRC(v.CRC)
+		}
+		for _, p := range v.PackedFiles {
+			r.PackedFiles = append(r.PackedFiles, p.Path)
+		}
+		if v.Comment != nil {
+			r.Comment = &jsonComment{v.Comment.export(), v.Comment.Text}
+		}
+		if v.AuthInfo != nil {
+			r.AuthInfo = base64.StdEncoding.EncodeToString(v.AuthInfo)
+		}
+		for _, st := range v.Streams {
+			r.Streams = append(r.Streams, &jsonStream{st.export(), st.File, st.Name})
+		}
+		for _, a := range v.ACLs {
+			acl := &jsonACL{jsonServiceData: a.export(), File: a.File, Owner: a.Owner, Group: a.Group}
+			for _, e := range a.Entries {
+				acl.Entries = append(acl.Entries, &jsonACLEntry{e.Type, e.Flags, e.Mask, e.SID})
+			}
+			r.ACLs = append(r.ACLs, acl)
+		}
+		e.RarFiles = append(e.RarFiles, r)
+	}
+	for _, v := range f.PackedFiles {
+		e.PackedFiles = append(e.PackedFiles, &jsonPackedFile{
+			Type:       "packed_file",
+			Path:       v.Path,
+			Size:       v.Size,
+			CRC:        hexCRC(v.CRC),
+			Properties: jsonFileProperties(v.Properties),
+		})
+	}
+	for _, v := range f.OSOHashes {
+		e.OSOHashes = append(e.OSOHashes, &jsonOSOHash{
+			Type: "oso_hash",
+			Path: v.Path,
+			Size: v.Size,
+			Hash: fmt.Sprintf("%016x", v.Hash),
+		})
+	}
+	e.SFVComments = append(e.SFVComments, f.SFVComments...)
+	if opts.Blocks {
+		e.Blocks = make([]*jsonBlock, 0, len(f.Blocks))
+		for _, v := range f.Blocks {
+			b := &jsonBlock{
+				Offset: v.Offset,
+				Size:   len(v.Raw),
+				Header: v.Header,
+			}
+			if v.Volume != nil {
+				b.Volume = v.Volume.Path
+			}
+			e.Blocks = append(e.Blocks, b)
+		}
+	}
+	return e
+}
+
+// ExportJSON returns the versioned JSON model of the SRR.
+func (f *SrrFile) ExportJSON(opts ExportOptions) ([]byte, error) {
+	return json.Marshal(f.export(opts))
+}
+
+// ExportYAML returns the same model as ExportJSON, as YAML.
+func (f *SrrFile) ExportYAML(opts ExportOptions) ([]byte, error) {
+	b, err := f.ExportJSON(opts)
+	if err != nil {
+		return nil, err
+	}
+	return jsonToYAML(b)
+}
+
+func (f *SrrFile) MarshalJSON() ([]byte, error) {
+	return f.ExportJSON(ExportOptions{})
+}
+
+func (f *SrsFile) export() *jsonSrsFile {
+	e := &jsonSrsFile{
+		Version: ExportVersion,
+		Type:    "srs",
+		Blocks:  make([]interface{}, 0, len(f.Blocks)),
+	}
+	e.Blocks = append(e.Blocks, f.Blocks...)
+	return e
+}
+
+// ExportJSON returns the versioned JSON model of the SRS.
+func (f *SrsFile) ExportJSON() ([]byte, error) {
+	return json.Marshal(f.export())
+}
+
+// ExportYAML returns the same model as ExportJSON, as YAML.
+func (f *SrsFile) ExportYAML() ([]byte, error) {
+	b, err := f.ExportJSON()
+	if err != nil {
+		return nil, err
+	}
+	return jsonToYAML(b)
+}
+
+func (f *SrsFile) MarshalJSON() ([]byte, error) {
+	return f.ExportJSON()
+}
+
+type jsonVolumeResult struct {
+	Path         string `json:"path"`
+	Size         int64  `json:"size"`
+	ExpectedSize int64  `json:"expected_size"`
+	CRC          string `json:"crc,omitempty"`
+	ExpectedCRC  string `json:"expected_crc,omitempty"`
+	Missing      bool   `json:"missing,omitempty"`
+	OK           bool   `json:"ok"`
+}
+
+// MarshalJSON writes the result as the verify command and the server
+// report it, CRCs in upper case hex.
+func (r *VolumeResult) MarshalJSON() ([]byte, error) {
+	e := &jsonVolumeResult{
+		Path:         r.Path,
+		Size:         r.Size,
+		ExpectedSize: r.ExpectedSize,
+		Missing:      r.Missing,
+		OK:           r.OK(),
+	}
+	if !r.Missing {
+		e.CRC = fmt.Sprintf("%08X", r.CRC)
+	}
+	if r.ExpectedCRC != 0 {
+		e.ExpectedCRC = fmt.Sprintf("%08X", r.ExpectedCRC)
+	}
+	return json.Marshal(e)
+}
+
+func (h RarHeader) MarshalJSON() ([]byte, error) {
+	if h.Type == EmptyHead {
+		return json.Marshal(h.export("empty"))
+	}
+	return json.Marshal(h.export("unknown"))
+}
+
+func (b SrrVolHeadBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonRarHeader
+		AppName string `json:"app_name"`
+	}{b.RarHeader.export("srr_volume"), b.GetAppName()})
+}
+
+func (b SrrStoredFileHeadBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonRarHeader
+		Path     string `json:"path"`
+		DataSize uint32 `json:"data_size"`
+	}{b.RarHeader.export("srr_stored_file"), string(b.FileName), b.DataSize})
+}
+
+func (b OSOHashHeadBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonRarHeader
+		Path     string `json:"path"`
+		FileSize uint64 `json:"file_size"`
+		Hash     string `json:"hash"`
+	}{b.RarHeader.export("srr_oso_hash"), string(b.FileName), b.FileSize, fmt.Sprintf("%016x", b.OSOHash)})
+}
+
+func (b SrrRarPadHeadBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonRarHeader
+		PadSize uint32 `json:"pad_size"`
+	}{b.RarHeader.export("srr_rar_padding"), b.PadSize})
+}
+
+func (b SrrRarSubBlockHeadBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonRarHeader
+		Path string `json:"path"`
+	}{b.RarHeader.export("srr_rar_file"), b.GetRarFileName()})
+}
+
+func (b MarkHeadBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.RarHeader.export("mark"))
+}
+
+// export returns the comment of a RAR 2.x comment block, whose text is
+// left out when it cannot be unpacked.
+func (b *CommHeadBlock) export() *jsonComment {
+	c := b.GetComment()
+	return &jsonComment{c.export(), c.Text}
+}
+
+func (b MainHeadBlock) MarshalJSON() ([]byte, error) {
+	e := struct {
+		jsonRarHeader
+		PosAV          uint64       `json:"pos_av"`
+		EncryptVersion uint8        `json:"encrypt_version,omitempty"`
+		Comment        *jsonComment `json:"comment,omitempty"`
+	}{
+		jsonRarHeader:  b.RarHeader.export("main"),
+		PosAV:          uint64(b.HighPosAV)<<32 | uint64(b.PosAV),
+		EncryptVersion: b.EncryptVer,
+	}
+	if b.Comment != nil {
+		e.Comment = b.Comment.export()
+	}
+	return json.Marshal(e)
+}
+
+type jsonFileHead struct {
+	jsonRarHeader
+	Path          string       `json:"path"`
+	PackSize      int          `json:"pack_size"`
+	UnpackSize    int          `json:"unpack_size"`
+	HostOS        uint8        `json:"host_os"`
+	CRC           string       `json:"crc"`
+	FileTime      uint32       `json:"file_time"`
+	UnpackVersion uint8        `json:"unpack_version"`
+	Method        uint8        `json:"method"`
+	Attributes    uint32       `json:"attributes"`
+	Salt          string       `json:"salt,omitempty"`
+	Comment       *jsonComment `json:"comment,omitempty"`
+}
+
+func (b FileHeadBlock) MarshalJSON() ([]byte, error) {
+	e := jsonFileHead{
+		jsonRarHeader: b.RarHeader.export("file"),
+		Path:          b.GetFileName(),
+		PackSize:      b.GetPackSize(),
+		UnpackSize:    b.GetUnpackSize(),
+		HostOS:        b.HostOS,
+		CRC:           hexCRC(b.FileCRC),
+		FileTime:      b.FileTime,
+		UnpackVersion: b.UnpackVersion,
+		Method:        b.Method,
+		Attributes:    b.FileAttr,
+	}
+	if b.Flag(LHD_SALT) {
+		e.Salt = fmt.Sprintf("%016x", b.Salt)
+	}
+	if b.Comment != nil {
+		e.Comment = b.Comment.export()
+	}
+	return json.Marshal(e)
+}
+
+func (b CommHeadBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonRarHeader
+		UnpackSize    uint16 `json:"unpack_size"`
+		UnpackVersion uint8  `json:"unpack_version"`
+		Method        uint8  `json:"method"`
+		CommentCRC    string `json:"comment_crc"`
+		Text          string `json:"text,omitempty"`
+	}{b.RarHeader.export("comment"), b.UnpackSize, b.UnpackVersion, b.Method, fmt.Sprintf("%04x", b.CommentCRC), b.GetComment().Text})
+}
+
+func (b AvHeadBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonRarHeader
+		UnpackVersion uint8  `json:"unpack_version"`
+		Method        uint8  `json:"method"`
+		AVVersion     uint8  `json:"av_version"`
+		AVInfoCRC     string `json:"av_info_crc"`
+		AVInfo        string `json:"av_info"`
+	}{b.RarHeader.export("av"), b.UnpackVersion, b.Method, b.AVVersion, hexCRC(b.AVInfoCRC), base64.StdEncoding.EncodeToString(b.AVInfo)})
+}
+
+func (b SubHeadBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonRarHeader
+		DataSize uint32 `json:"data_size"`
+		SubType  uint16 `json:"sub_type"`
+	}{b.RarHeader.export("sub"), b.DataSize, b.SubType})
+}
+
+func (b ProtectHeadBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonRarHeader
+		PackedSize      uint32 `json:"packed_size"`
+		Version         uint8  `json:"version"`
+		RecoverySectors uint16 `json:"recovery_sectors"`
+		DataSectors     uint32 `json:"data_sectors"`
+	}{b.RarHeader.export("protect"), b.PackedSize, b.Version, b.RecSectorCount, b.DataSectorCount})
+}
+
+func (b SignHeadBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.RarHeader.export("sign"))
+}
+
+func (b NewSubHeadBlock) MarshalJSON() ([]byte, error) {
+	e := jsonFileHead{
+		jsonRarHeader: b.RarHeader.export("new_sub"),
+		Path:          b.GetFileName(),
+		PackSize:      b.GetPackSize(),
+		UnpackSize:    int(b.HighUnpackSize)<<32 + int(b.LowUnpackSize),
+		HostOS:        b.HostOS,
+		CRC:           hexCRC(b.FileCRC),
+		FileTime:      b.FileTime,
+		UnpackVersion: b.UnpackVersion,
+		Method:        b.Method,
+		Attributes:    b.FileAttr,
+	}
+	if b.Flag(LHD_SALT) {
+		e.Salt = fmt.Sprintf("%016x", b.Salt)
+	}
+	return json.Marshal(e)
+}
+
+func (b EndArcHeadBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.RarHeader.export("end_archive"))
+}
+
+func (b SrsBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type   string `json:"type"`
+		Size   int    `json:"size"`
+		Head   string `json:"head"`
+		Length uint32 `json:"length"`
+	}{"srs_block", b.Size, string(b.Head[:]), b.Length})
+}
+
+func (b ID3v1Block) MarshalJSON() ([]byte, error) {
+	e := struct {
+		jsonSizedBlock
+		Title     string `json:"title"`
+		Artist    string `json:"artist"`
+		Album     string `json:"album"`
+		Year      string `json:"year"`
+		Comment   string `json:"comment"`
+		Track     uint8  `json:"track,omitempty"`
+		Genre     uint8  `json:"genre"`
+		GenreName string `json:"genre_name,omitempty"`
+	}{jsonSizedBlock{"id3v1", b.Size}, b.Title, b.Artist, b.Album, b.Year, b.Comment, b.Track, b.Genre, b.GenreName()}
+	return json.Marshal(e)
+}
+
+type jsonID3v2Frame struct {
+	ID          string   `json:"id"`
+	Flags       uint16   `json:"flags"`
+	Size        int      `json:"size"`
+	Text        []string `json:"text,omitempty"`
+	Language    string   `json:"language,omitempty"`
+	Description string   `json:"description,omitempty"`
+	MIMEType    string   `json:"mime_type,omitempty"`
+	PictureType *uint8   `json:"picture_type,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+}
+
+func exportID3v2Frame(frame interface{}) *jsonID3v2Frame {
+	var e *jsonID3v2Frame
+	base := func(f ID3v2Frame) *jsonID3v2Frame {
+		return &jsonID3v2Frame{ID: f.ID, Flags: f.Flags, Size: len(f.Data)}
+	}
+	switch f := frame.(type) {
+	case *ID3v2TextFrame:
+		e = base(f.ID3v2Frame)
+		e.Text = f.Text
+	case *ID3v2UserTextFrame:
+		e = base(f.ID3v2Frame)
+		e.Description = f.Description
+		e.Text = []string{f.Value}
+	case *ID3v2CommentFrame:
+		e = base(f.ID3v2Frame)
+		e.Language = f.Language
+		e.Description = f.Description
+		e.Text = []string{f.Text}
+	case *ID3v2PictureFrame:
+		e = base(f.ID3v2Frame)
+		e.MIMEType = f.MIMEType
+		e.PictureType = &f.PictureType
+		e.Description = f.Description
+	case *ID3v2PrivateFrame:
+		e = base(f.ID3v2Frame)
+		e.Owner = f.Owner
+	case *ID3v2Frame:
+		e = base(*f)
+	}
+	return e
+}
+
+func (b ID3v2Block) MarshalJSON() ([]byte, error) {
+	frames := make([]*jsonID3v2Frame, 0, len(b.Frames))
+	for _, f := range b.Frames {
+		frames = append(frames, exportID3v2Frame(f))
+	}
+	return json.Marshal(struct {
+		jsonSizedBlock
+		Version string            `json:"version"`
+		Flags   uint8             `json:"flags"`
+		Frames  []*jsonID3v2Frame `json:"frames"`
+	}{jsonSizedBlock{"id3v2", b.Size}, fmt.Sprintf("2.%d.%d", b.Version, b.Revision), b.Flags, frames})
+}
+
+func (b Lyrics200Block) MarshalJSON() ([]byte, error) {
+	fields := make([]*jsonTagField, 0, len(b.Fields))
+	for _, f := range b.Fields {
+		fields = append(fields, &jsonTagField{Key: string(f.Head[:]), Value: string(f.Data)})
+	}
+	return json.Marshal(struct {
+		jsonSizedBlock
+		Fields []*jsonTagField `json:"fields"`
+	}{jsonSizedBlock{"lyrics3v2", b.Size}, fields})
+}
+
+type jsonTagField struct {
+	Key    string `json:"key"`
+	Flags  uint32 `json:"flags,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Binary int    `json:"binary,omitempty"`
+}
+
+func (b ApeBlock) MarshalJSON() ([]byte, error) {
+	items := make([]*jsonTagField, 0, len(b.Items))
+	for _, i := range b.Items {
+		f := &jsonTagField{Key: i.Key, Flags: i.Flags}
+		if i.Flags&APE_TYPE_MASK == APE_BINARY {
+			f.Binary = len(i.Value)
+		} else {
+			f.Value = i.Text()
+		}
+		items = append(items, f)
+	}
+	return json.Marshal(struct {
+		jsonSizedBlock
+		Version string          `json:"version"`
+		Flags   uint32          `json:"flags"`
+		Items   []*jsonTagField `json:"fields"`
+	}{jsonSizedBlock{"ape", b.Size}, fmt.Sprintf("%d.%03d", b.Version/1000, b.Version%1000), b.Flags, items})
+}
+
+func (b MpegBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonSizedBlock
+		Frames     int     `json:"frame_count"`
+		Version    string  `json:"version"`
+		Layer      int     `json:"layer"`
+		Bitrate    int     `json:"bitrate"`
+		VBR        bool    `json:"vbr"`
+		SampleRate int     `json:"sample_rate"`
+		Channels   int     `json:"channels"`
+		Duration   float64 `json:"duration"`
+		VBRHeader  string  `json:"vbr_header,omitempty"`
+		VBRFrames  uint32  `json:"vbr_frames,omitempty"`
+		VBRBytes   uint32  `json:"vbr_bytes,omitempty"`
+	}{jsonSizedBlock{"mpeg", b.Size}, b.Frames, strings.TrimSuffix(fmt.Sprintf("%d.%d", b.Version/10, b.Version%10), ".0"),
+		b.Layer, b.Bitrate, b.VBR, b.SampleRate, b.Channels, b.Duration.Seconds(), b.VBRHeader, b.VBRFrames, b.VBRBytes})
+}
+
+func (b MkvBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonSizedBlock{"mkv", b.Size})
+}
+
+func (b AviBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonSizedBlock{"avi", b.Size})
+}
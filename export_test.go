@@ -0,0 +1,101 @@
+package rescene
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// golden compares got with the content of testdata/name, which -update
+// writes instead.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	p := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(p, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs:\n%s", name, got)
+	}
+}
+
+// exportSrr returns an SRR of a RAR 2.x volume with an archive comment and
+// an authenticity verification block, and of strings that YAML must quote.
+func exportSrr(t *testing.T) *SrrFile {
+	dir := t.TempDir()
+	text := []byte("yes: \"quoted\" \\ #not a comment\r\n- item\r\n")
+	main := append(make([]byte, 6), rarCommHead(text, uint16(crc32.ChecksumIEEE(text)))...)
+	info := []byte("AV info")
+	av := []byte{20, 0x30, 1, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(av[3:], crc32.ChecksumIEEE(info))
+	data := []byte("packed data")
+
+	v := append([]byte(nil), rarMarker...)
+	v = append(v, rarBlock(MainHead, MHD_COMMENT|MHD_AV, main)...)
+	v = append(v, rarFileHead(FileHead, 0, "null", len(data), len(data), crc32.ChecksumIEEE(data), nil)...)
+	v = append(v, data...)
+	v = append(v, rarBlock(AvHead, 0, append(av, info...))...)
+	v = append(v, rarEndArc(0)...)
+	writeTestFile(t, filepath.Join(dir, "test.rar"), v)
+	sfv := fmt.Sprintf("; sfv: \"comment\"\r\ntest.rar %08x\r\n", crc32.ChecksumIEEE(v))
+	writeTestFile(t, filepath.Join(dir, "- release.sfv"), []byte(sfv))
+	return srrOf(t, dir, []string{"test.rar"}, CreateOptions{
+		AppName:     "true",
+		StoredFiles: []*CreateEntry{{Name: "- release.sfv", Path: filepath.Join(dir, "- release.sfv")}},
+	})
+}
+
+func TestExportGolden(t *testing.T) {
+	f := exportSrr(t)
+	opts := ExportOptions{StoredData: true, Blocks: true}
+	b, err := f.ExportJSON(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indented bytes.Buffer
+	if err = json.Indent(&indented, b, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "export.json", append(indented.Bytes(), '\n'))
+
+	y, err := f.ExportYAML(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "export.yaml", y)
+}
+
+func TestJSONToYAML(t *testing.T) {
+	tests := []struct {
+		json string
+		yaml string
+	}{
+		{`"a: b"`, "\"a: b\"\n"},
+		{`[]`, "[]\n"},
+		{`{"no":1,"on":true,"1a":null,"a b":"#","":{},"ok_2":[]}`,
+			"\"no\": 1\n\"on\": true\n\"1a\": null\n\"a b\": \"#\"\n\"\": {}\nok_2: []\n"},
+		{`{"list":[{"a":"x","b":["- y"]},"z\n"]}`,
+			"list:\n  - a: \"x\"\n    b:\n      - \"- y\"\n  - \"z\\n\"\n"},
+	}
+	for _, tt := range tests {
+		y, err := jsonToYAML([]byte(tt.json))
+		if err != nil || string(y) != tt.yaml {
+			t.Errorf("%s: %q, %v; want %q", tt.json, y, err, tt.yaml)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+//go:build ignore
+// +build ignore
+
+// This program generates the font of RenderNfo, written to the file given
+// with -o (fonts/cp437-8x16.bin, see go:generate in nfo.go): the 256
+// characters of code page 437 in the 8×16 font of the IBM VGA, 16 bytes
+// per glyph, the high bit of each byte being the left column, as in the VGA
+// character generator. Box drawing, block and shade characters fill their
+// cells to the edges, so that they join like they do in NFO viewers.
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"io/ioutil"
+	"log"
+)
+
+const height = 16
+
+// glyphs holds the rows of each character, top to bottom, in hexadecimal.
+var glyphs = [256]string{
+	"00000000000000000000000000000000", // 00 NUL
+	"00007e81a58181bd9981817e00000000", // 01 ☺
+	"00007effdbffffc3e7ffff7e00000000", // 02 ☻
+	"000000006cfefefefe7c381000000000", // 03 ♥
+	"0000000010387cfe7c38100000000000", // 04 ♦
+	"000000183c3ce7e7e718183c00000000", // 05 ♣
+	"000000183c7effff7e18183c00000000", // 06 ♠
+	"000000000000183c3c18000000000000", // 07 •
+	"ffffffffffffe7c3c3e7ffffffffffff", // 08 ◘
+	"00000000003c664242663c0000000000", // 09 ○
+	"ffffffffffc399bdbd99c3ffffffffff", // 0A ◙
+	"00001e0e1a3278cccccccc7800000000", // 0B ♂
+	"00003c666666663c187e181800000000", // 0C ♀
+	"00003f333f3030303070f0e000000000", // 0D ♪
+	"00007f637f6363636367e7e6c0000000", // 0E ♫
+	"0000001818db3ce73cdb181800000000", // 0F ☼
+	"0080c0e0f0f8fef8f0e0c08000000000", // 10 ►
+	"0002060e1e3efe3e1e0e060200000000", // 11 ◄
+	"0000183c7e1818187e3c180000000000", // 12 ↕
+	"00006666666666666600666600000000", // 13 ‼
+	"00007fdbdbdb7b1b1b1b1b1b00000000", // 14 ¶
+	"007cc660386cc6c66c380cc67c000000", // 15 §
+	"0000000000000000fefefefe00000000", // 16 ▬
+	"0000183c7e1818187e3c187e00000000", // 17 ↨
+	"0000183c7e1818181818181800000000", // 18 ↑
+	"0000181818181818187e3c1800000000", // 19 ↓
+	"0000000000180cfe0c18000000000000", // 1A →
+	"00000000003060fe6030000000000000", // 1B ←
+	"000000000000c0c0c0fe000000000000", // 1C ∟
+	"0000000000286cfe6c28000000000000", // 1D ↔
+	"000000001038387c7cfefe0000000000", // 1E ▲
+	"00000000fefe7c7c3838100000000000", // 1F ▼
+	"00000000000000000000000000000000", // 20 space
+	"0000183c3c3c18181800181800000000", // 21 !
+	"00666666240000000000000000000000", // 22 "
+	"0000006c6cfe6c6c6cfe6c6c00000000", // 23 #
+	"18187cc6c2c07c060686c67c18180000", // 24 $
+	"00000000c2c60c183060c68600000000", // 25 %
+	"0000386c6c3876dccccccc7600000000", // 26 &
+	"00303030600000000000000000000000", // 27 '
+	"00000c18303030303030180c00000000", // 28 (
+	"000030180c0c0c0c0c0c183000000000", // 29 )
+	"0000000000663cff3c66000000000000", // 2A *
+	"000000000018187e1818000000000000", // 2B +
+	"00000000000000000018181830000000", // 2C ,
+	"00000000000000fe0000000000000000", // 2D -
+	"00000000000000000000181800000000", // 2E .
+	"0000000002060c183060c08000000000", // 2F /
+	"0000386cc6c6d6d6c6c66c3800000000", // 30 0
+	"00001838781818181818187e00000000", // 31 1
+	"00007cc6060c183060c0c6fe00000000", // 32 2
+	"00007cc606063c060606c67c00000000", // 33 3
+	"00000c1c3c6cccfe0c0c0c1e00000000", // 34 4
+	"0000fec0c0c0fc060606c67c00000000", // 35 5
+	"00003860c0c0fcc6c6c6c67c00000000", // 36 6
+	"0000fec606060c183030303000000000", // 37 7
+	"00007cc6c6c67cc6c6c6c67c00000000", // 38 8
+	"00007cc6c6c67e0606060c7800000000", // 39 9
+	"00000000181800000018180000000000", // 3A :
+	"00000000181800000018183000000000", // 3B ;
+	"000000060c18306030180c0600000000", // 3C <
+	"00000000007e00007e00000000000000", // 3D =
+	"0000006030180c060c18306000000000", // 3E >
+	"00007cc6c60c18181800181800000000", // 3F ?
+	"0000007cc6c6dedededcc07c00000000", // 40 @
+	"000010386cc6c6fec6c6c6c600000000", // 41 A
+	"0000fc6666667c66666666fc00000000", // 42 B
+	"00003c66c2c0c0c0c0c2663c00000000", // 43 C
+	"0000f86c6666666666666cf800000000", // 44 D
+	"0000fe6662687868606266fe00000000", // 45 E
+	"0000fe6662687868606060f000000000", // 46 F
+	"00003c66c2c0c0dec6c6663a00000000", // 47 G
+	"0000c6c6c6c6fec6c6c6c6c600000000", // 48 H
+	"00003c18181818181818183c00000000", // 49 I
+	"00001e0c0c0c0c0ccccccc7800000000", // 4A J
+	"0000e666666c78786c6666e600000000", // 4B K
+	"0000f06060606060606266fe00000000", // 4C L
+	"0000c6eefefed6c6c6c6c6c600000000", // 4D M
+	"0000c6e6f6fedecec6c6c6c600000000", // 4E N
+	"00007cc6c6c6c6c6c6c6c67c00000000", // 4F O
+	"0000fc6666667c60606060f000000000", // 50 P
+	"00007cc6c6c6c6c6c6d6de7c0c0e0000", // 51 Q
+	"0000fc6666667c6c666666e600000000", // 52 R
+	"00007cc6c660380c06c6c67c00000000", // 53 S
+	"00007e7e5a1818181818183c00000000", // 54 T
+	"0000c6c6c6c6c6c6c6c6c67c00000000", // 55 U
+	"0000c6c6c6c6c6c6c66c381000000000", // 56 V
+	"0000c6c6c6c6d6d6d6feee6c00000000", // 57 W
+	"0000c6c66c7c38387c6cc6c600000000", // 58 X
+	"0000666666663c181818183c00000000", // 59 Y
+	"0000fec6860c183060c2c6fe00000000", // 5A Z
+	"00003c30303030303030303c00000000", // 5B [
+	"00000080c0e070381c0e060200000000", // 5C \
+	"00003c0c0c0c0c0c0c0c0c3c00000000", // 5D ]
+	"10386cc6000000000000000000000000", // 5E ^
+	"00000000000000000000000000ff0000", // 5F _
+	"30301800000000000000000000000000", // 60 `
+	"0000000000780c7ccccccc7600000000", // 61 a
+	"0000e06060786c666666667c00000000", // 62 b
+	"00000000007cc6c0c0c0c67c00000000", // 63 c
+	"00001c0c0c3c6ccccccccc7600000000", // 64 d
+	"00000000007cc6fec0c0c67c00000000", // 65 e
+	"0000386c6460f060606060f000000000", // 66 f
+	"000000000076cccccccccc7c0ccc7800", // 67 g
+	"0000e060606c7666666666e600000000", // 68 h
+	"00001818003818181818183c00000000", // 69 i
+	"00000606000e06060606060666663c00", // 6A j
+	"0000e06060666c78786c66e600000000", // 6B k
+	"00003818181818181818183c00000000", // 6C l
+	"0000000000ecfed6d6d6d6c600000000", // 6D m
+	"0000000000dc66666666666600000000", // 6E n
+	"00000000007cc6c6c6c6c67c00000000", // 6F o
+	"0000000000dc66666666667c6060f000", // 70 p
+	"000000000076cccccccccc7c0c0c1e00", // 71 q
+	"0000000000dc7666606060f000000000", // 72 r
+	"00000000007cc660380cc67c00000000", // 73 s
+	"0000103030fc30303030361c00000000", // 74 t
+	"0000000000cccccccccccc7600000000", // 75 u
+	"000000000066666666663c1800000000", // 76 v
+	"0000000000c6c6d6d6d6fe6c00000000", // 77 w
+	"0000000000c66c3838386cc600000000", // 78 x
+	"0000000000c6c6c6c6c6c67e060cf800", // 79 y
+	"0000000000fecc183060c6fe00000000", // 7A z
+	"00000e18181870181818180e00000000", // 7B {
+	"00001818181800181818181800000000", // 7C |
+	"0000701818180e181818187000000000", // 7D }
+	"000076dc000000000000000000000000", // 7E ~
+	"0000000010386cc6c6c6fe0000000000", // 7F ⌂
+	"00003c66c2c0c0c0c2663c0c067c0000", // 80 Ç
+	"0000cc0000cccccccccccc7600000000", // 81 ü
+	"000c1830007cc6fec0c0c67c00000000", // 82 é
+	"0010386c00780c7ccccccc7600000000", // 83 â
+	"0000cc0000780c7ccccccc7600000000", // 84 ä
+	"0060301800780c7ccccccc7600000000", // 85 à
+	"00386c3800780c7ccccccc7600000000", // 86 å
+	"000000003c666060663c0c063c000000", // 87 ç
+	"0010386c007cc6fec0c0c67c00000000", // 88 ê
+	"0000c600007cc6fec0c0c67c00000000", // 89 ë
+	"00603018007cc6fec0c0c67c00000000", // 8A è
+	"00006600003818181818183c00000000", // 8B ï
+	"00183c66003818181818183c00000000", // 8C î
+	"00603018003818181818183c00000000", // 8D ì
+	"00c60010386cc6c6fec6c6c600000000", // 8E Ä
+	"386c3800386cc6c6fec6c6c600000000", // 8F Å
+	"18306000fe66607c606066fe00000000", // 90 É
+	"0000000000cc76367ed8d86e00000000", // 91 æ
+	"00003e6cccccfeccccccccce00000000", // 92 Æ
+	"0010386c007cc6c6c6c6c67c00000000", // 93 ô
+	"0000c600007cc6c6c6c6c67c00000000", // 94 ö
+	"00603018007cc6c6c6c6c67c00000000", // 95 ò
+	"003078cc00cccccccccccc7600000000", // 96 û
+	"0060301800cccccccccccc7600000000", // 97 ù
+	"0000c60000c6c6c6c6c6c67e060c7800", // 98 ÿ
+	"00c6007cc6c6c6c6c6c6c67c00000000", // 99 Ö
+	"00c600c6c6c6c6c6c6c6c67c00000000", // 9A Ü
+	"0018183c66606060663c181800000000", // 9B ¢
+	"00386c6460f060606060e6fc00000000", // 9C £
+	"000066663c187e187e18181800000000", // 9D ¥
+	"00f8ccccf8c4ccdeccccccc600000000", // 9E ₧
+	"000e1b1818187e1818181818d8700000", // 9F ƒ
+	"0018306000780c7ccccccc7600000000", // A0 á
+	"000c1830003818181818183c00000000", // A1 í
+	"00183060007cc6c6c6c6c67c00000000", // A2 ó
+	"0018306000cccccccccccc7600000000", // A3 ú
+	"000076dc00dc66666666666600000000", // A4 ñ
+	"76dc00c6e6f6fedecec6c6c600000000", // A5 Ñ
+	"003c6c6c3e007e000000000000000000", // A6 ª
+	"00386c6c38007c000000000000000000", // A7 º
+	"0000303000303060c0c6c67c00000000", // A8 ¿
+	"000000000000fec0c0c0c00000000000", // A9 ⌐
+	"000000000000fe060606060000000000", // AA ¬
+	"0060e062666c183060dc860c183e0000", // AB ½
+	"0060e062666c183066ce9a3f06060000", // AC ¼
+	"00001818001818183c3c3c1800000000", // AD ¡
+	"0000000000366cd86c36000000000000", // AE «
+	"0000000000d86c366cd8000000000000", // AF »
+	"11441144114411441144114411441144", // B0 ░
+	"55aa55aa55aa55aa55aa55aa55aa55aa", // B1 ▒
+	"dd77dd77dd77dd77dd77dd77dd77dd77", // B2 ▓
+	"18181818181818181818181818181818", // B3 │
+	"18181818181818f81818181818181818", // B4 ┤
+	"1818181818f818f81818181818181818", // B5 ╡
+	"36363636363636f63636363636363636", // B6 ╢
+	"00000000000000fe3636363636363636", // B7 ╖
+	"0000000000f818f81818181818181818", // B8 ╕
+	"3636363636f606f63636363636363636", // B9 ╣
+	"36363636363636363636363636363636", // BA ║
+	"0000000000fe06f63636363636363636", // BB ╗
+	"3636363636f606fe0000000000000000", // BC ╝
+	"36363636363636fe0000000000000000", // BD ╜
+	"1818181818f818f80000000000000000", // BE ╛
+	"00000000000000f81818181818181818", // BF ┐
+	"181818181818181f0000000000000000", // C0 └
+	"18181818181818ff0000000000000000", // C1 ┴
+	"00000000000000ff1818181818181818", // C2 ┬
+	"181818181818181f1818181818181818", // C3 ├
+	"00000000000000ff0000000000000000", // C4 ─
+	"18181818181818ff1818181818181818", // C5 ┼
+	"18181818181f181f1818181818181818", // C6 ╞
+	"36363636363636373636363636363636", // C7 ╟
+	"363636363637303f0000000000000000", // C8 ╚
+	"00000000003f30373636363636363636", // C9 ╔
+	"3636363636f700ff0000000000000000", // CA ╩
+	"0000000000ff00f73636363636363636", // CB ╦
+	"36363636363730373636363636363636", // CC ╠
+	"0000000000ff00ff0000000000000000", // CD ═
+	"3636363636f700f73636363636363636", // CE ╬
+	"1818181818ff00ff0000000000000000", // CF ╧
+	"36363636363636ff0000000000000000", // D0 ╨
+	"0000000000ff00ff1818181818181818", // D1 ╤
+	"00000000000000ff3636363636363636", // D2 ╥
+	"363636363636363f0000000000000000", // D3 ╙
+	"18181818181f181f0000000000000000", // D4 ╘
+	"00000000001f181f1818181818181818", // D5 ╒
+	"000000000000003f3636363636363636", // D6 ╓
+	"36363636363636ff3636363636363636", // D7 ╫
+	"1818181818ff18ff1818181818181818", // D8 ╪
+	"18181818181818f80000000000000000", // D9 ┘
+	"000000000000001f1818181818181818", // DA ┌
+	"ffffffffffffffffffffffffffffffff", // DB █
+	"00000000000000ffffffffffffffffff", // DC ▄
+	"f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0", // DD ▌
+	"0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f", // DE ▐
+	"ffffffffffffff000000000000000000", // DF ▀
+	"000000000076dcd8d8d8dc7600000000", // E0 α
+	"000078ccccccd8ccc6c6c6cc00000000", // E1 ß
+	"0000fec6c6c0c0c0c0c0c0c000000000", // E2 Γ
+	"00000000fe6c6c6c6c6c6c6c00000000", // E3 π
+	"000000fec66030183060c6fe00000000", // E4 Σ
+	"00000000007ed8d8d8d8d87000000000", // E5 σ
+	"0000000066666666667c6060c0000000", // E6 µ
+	"0000000076dc18181818181800000000", // E7 τ
+	"0000007e183c6666663c187e00000000", // E8 Φ
+	"000000386cc6c6fec6c66c3800000000", // E9 Θ
+	"0000386cc6c6c66c6c6c6cee00000000", // EA Ω
+	"00001e30180c3e666666663c00000000", // EB δ
+	"00000000007edbdbdb7e000000000000", // EC ∞
+	"00000003067edbdbf37e60c000000000", // ED φ
+	"00001c3060607c606060301c00000000", // EE ε
+	"0000007cc6c6c6c6c6c6c6c600000000", // EF ∩
+	"00000000fe0000fe0000fe0000000000", // F0 ≡
+	"0000000018187e18180000ff00000000", // F1 ±
+	"00000030180c060c1830007e00000000", // F2 ≥
+	"0000000c18306030180c007e00000000", // F3 ≤
+	"00000e1b1b1818181818181818181818", // F4 ⌠
+	"1818181818181818d8d8d87000000000", // F5 ⌡
+	"000000000018007e0018000000000000", // F6 ÷
+	"000000000076dc0076dc000000000000", // F7 ≈
+	"00386c6c380000000000000000000000", // F8 °
+	"00000000000000181800000000000000", // F9 ∙
+	"00000000000000001800000000000000", // FA ·
+	"000f0c0c0c0c0cec6c6c3c1c00000000", // FB √
+	"00d86c6c6c6c6c000000000000000000", // FC ⁿ
+	"0070d83060c8f8000000000000000000", // FD ²
+	"000000007c7c7c7c7c7c7c0000000000", // FE ■
+	"00000000000000000000000000000000", // FF no-break space
+}
+
+func main() {
+	output := flag.String("o", "", "file to write the font to")
+	flag.Parse()
+	if *output == "" {
+		log.Fatal("usage: gen -o file")
+	}
+	out := make([]byte, 0, len(glyphs)*height)
+	for c, g := range glyphs {
+		b, err := hex.DecodeString(g)
+		if err != nil || len(b) != height {
+			log.Fatalf("glyph %02X: bad rows %q", c, g)
+		}
+		out = append(out, b...)
+	}
+	if err := ioutil.WriteFile(*output, out, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,259 @@
+package rescene
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// fsNode is a file or a directory of a read-only file system built from
+// the paths found in an SRR.
+type fsNode struct {
+	name     string
+	size     int64
+	mode     fs.FileMode
+	modTime  time.Time
+	children []*fsNode
+	open     func() (fsReader, error)
+}
+
+// fsReader is what the files of the file systems of this package read from.
+type fsReader interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+}
+
+func (n *fsNode) Name() string               { return n.name }
+func (n *fsNode) Size() int64                { return n.size }
+func (n *fsNode) Mode() fs.FileMode          { return n.mode }
+func (n *fsNode) ModTime() time.Time         { return n.modTime }
+func (n *fsNode) IsDir() bool                { return n.mode.IsDir() }
+func (n *fsNode) Sys() interface{}           { return nil }
+func (n *fsNode) Type() fs.FileMode          { return n.mode.Type() }
+func (n *fsNode) Info() (fs.FileInfo, error) { return n, nil }
+
+// fsTree indexes the nodes of a file system by their full name, "." being
+// the root directory.
+type fsTree map[string]*fsNode
+
+func newFSTree() fsTree {
+	return fsTree{".": {name: ".", mode: fs.ModeDir | 0555}}
+}
+
+// add adds a file, creating its parent directories. Names that are not
+// valid fs paths once cleaned, and names already taken by a file or a
+// directory, are skipped: the first one wins.
+func (t fsTree) add(name string, n *fsNode) bool {
+	name = path.Clean(storedPath(name))
+	if !fs.ValidPath(name) || name == "." {
+		return false
+	}
+	if _, ok := t[name]; ok {
+		return false
+	}
+	dir := path.Dir(name)
+	parent, ok := t[dir]
+	if !ok {
+		parent = &fsNode{name: path.Base(dir), mode: fs.ModeDir | 0555}
+		if !t.add(dir, parent) {
+			return false
+		}
+	} else if !parent.IsDir() {
+		return false
+	}
+	n.name = path.Base(name)
+	t[name] = n
+	parent.children = append(parent.children, n)
+	return true
+}
+
+// sort orders the entries of every directory by name, as fs.ReadDir does.
+func (t fsTree) sort() {
+	for _, n := range t {
+		sort.Slice(n.children, func(i, j int) bool {
+			return n.children[i].name < n.children[j].name
+		})
+	}
+}
+
+func (t fsTree) lookup(op, name string) (*fsNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	n, ok := t[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return n, nil
+}
+
+func (t fsTree) Open(name string) (fs.File, error) {
+	n, err := t.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if n.IsDir() {
+		return &fsDir{node: n, path: name}, nil
+	}
+	r, err := n.open()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &fsFile{node: n, path: name, r: r}, nil
+}
+
+func (t fsTree) Stat(name string) (fs.FileInfo, error) {
+	return t.lookup("stat", name)
+}
+
+func (t fsTree) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := t.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !n.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries := make([]fs.DirEntry, len(n.children))
+	for i, c := range n.children {
+		entries[i] = c
+	}
+	return entries, nil
+}
+
+// fsFile is an open file of an fsTree.
+type fsFile struct {
+	node   *fsNode
+	path   string
+	r      fsReader
+	closed bool
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.node, nil
+}
+
+func (f *fsFile) Read(b []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: fs.ErrClosed}
+	}
+	return f.r.Read(b)
+}
+
+func (f *fsFile) ReadAt(b []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: fs.ErrClosed}
+	}
+	return f.r.ReadAt(b, off)
+}
+
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.path, Err: fs.ErrClosed}
+	}
+	return f.r.Seek(offset, whence)
+}
+
+func (f *fsFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.path, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	if c, ok := f.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// fsDir is an open directory of an fsTree.
+type fsDir struct {
+	node   *fsNode
+	path   string
+	offset int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return d.node, nil
+}
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: fs.ErrInvalid}
+}
+
+func (d *fsDir) Close() error {
+	return nil
+}
+
+func (d *fsDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	rest := d.node.children[d.offset:]
+	if count > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > 0 && count < len(rest) {
+		rest = rest[:count]
+	}
+	d.offset += len(rest)
+	entries := make([]fs.DirEntry, len(rest))
+	for i, c := range rest {
+		entries[i] = c
+	}
+	return entries, nil
+}
+
+// StoredFS is a read-only file system over the stored files of an SRR,
+// with directories made from the stored paths ("\" being read as "/").
+// Files read as they were when StoredFS was called.
+type StoredFS struct {
+	fsTree
+}
+
+// StoredFS returns the stored files of the SRR as a file system, for use
+// with fs.WalkDir, http.FS, template.ParseFS... A stored path that is not
+// valid for io/fs, such as one with "..", is left out, as is a second file
+// with the same path.
+func (f *SrrFile) StoredFS() *StoredFS {
+	t := newFSTree()
+	for _, sf := range f.StoredFiles {
+		data := sf.Data
+		t.add(sf.Path, &fsNode{
+			size: int64(len(data)),
+			mode: 0444,
+			open: func() (fsReader, error) {
+				return bytes.NewReader(data), nil
+			},
+		})
+	}
+	t.sort()
+	return &StoredFS{t}
+}
+
+// ReadFile returns the content of a stored file.
+func (s *StoredFS) ReadFile(name string) ([]byte, error) {
+	n, err := s.lookup("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	if n.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	r, err := n.open()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n.size)
+	_, err = r.ReadAt(b, 0)
+	if err == io.EOF {
+		err = nil
+	}
+	return b, err
+}
+
+var (
+	_ fs.ReadDirFS  = (*StoredFS)(nil)
+	_ fs.StatFS     = (*StoredFS)(nil)
+	_ fs.ReadFileFS = (*StoredFS)(nil)
+)
@@ -0,0 +1,52 @@
+package rescene
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStoredFS(t *testing.T) {
+	f := &SrrFile{StoredFiles: []*StoredFile{
+		{Path: "movie.nfo", Data: []byte("nfo")},
+		{Path: `Sample\movie.srs`, Data: testData(100, 1)},
+		{Path: "Proof/Sub/proof.jpg", Data: testData(50, 2)},
+		{Path: "movie.NFO", Data: []byte("other case")},
+		{Path: "../outside.txt", Data: []byte("left out")},
+		{Path: "movie.nfo/inside", Data: []byte("left out")},
+		{Path: "movie.nfo", Data: []byte("second")},
+	}}
+	fsys := f.StoredFS()
+	if err := fstest.TestFS(fsys, "movie.nfo", "movie.NFO", "Sample/movie.srs", "Proof/Sub/proof.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := fsys.ReadFile("movie.nfo"); err != nil || string(b) != "nfo" {
+		t.Errorf("ReadFile(movie.nfo) = %q, %v", b, err)
+	}
+	for _, name := range []string{"../outside.txt", "outside.txt", "movie.nfo/inside"} {
+		if _, err := fs.Stat(fsys, name); err == nil {
+			t.Errorf("%s is in the file system", name)
+		}
+	}
+	if _, err := fsys.ReadFile("Sample"); err == nil {
+		t.Error("ReadFile reads a directory")
+	}
+}
+
+func TestPackedFS(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"movie.mkv":      testData(2500, 1),
+		"Subs/movie.srt": testData(300, 2),
+		"Subs/movie.idx": testData(10, 3),
+	}
+	volumes := rarSplit(t, dir, "movie", 1000, files, "movie.mkv", "Subs/movie.srt", "Subs/movie.idx")
+	f := srrOf(t, dir, volumes, CreateOptions{})
+	fsys, err := f.PackedFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = fstest.TestFS(fsys, "movie.mkv", "Subs/movie.srt", "Subs/movie.idx"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,10 +3,9 @@ module github.com/rescene/rescene
 go 1.16
 
 require (
-	github.com/djimenez/iconv-go v0.0.0-20160305225143-8960e66bd3da // indirect
 	github.com/h2non/filetype v1.1.3
-	github.com/mikkyang/id3-go v0.0.0-20191012064224-2c6ab3bb1fbd
 	github.com/rescene/mkvparse v0.0.0-20211218022330-75763c1ac43a
+	go.etcd.io/bbolt v1.3.6
 	golang.org/x/image v0.0.0-20211028202545-6944b10bf410
 	golang.org/x/text v0.3.6
 )
@@ -0,0 +1,325 @@
+package rescene
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+const (
+	ID3V2_UNSYNC   uint8 = 0x80
+	ID3V2_EXTENDED uint8 = 0x40
+	ID3V2_FOOTER   uint8 = 0x10
+)
+
+// ID3v2Block is an ID3v2 tag. Frames holds *ID3v2TextFrame,
+// *ID3v2CommentFrame... for the frames with a known layout and *ID3v2Frame
+// for the others.
+type ID3v2Block struct {
+	Size     int
+	Data     []byte
+	Version  uint8
+	Revision uint8
+	Flags    uint8
+	Frames   []interface{}
+}
+
+// ID3v2Frame is a frame of an ID3v2 tag. Data is the frame content after
+// unsynchronisation and decompression; it stays as stored when the frame is
+// encrypted.
+type ID3v2Frame struct {
+	ID    string
+	Flags uint16
+	Data  []byte
+}
+
+// ID3v2TextFrame is a T??? frame. ID3v2.4 allows several values.
+type ID3v2TextFrame struct {
+	ID3v2Frame
+	Text []string
+}
+
+// ID3v2UserTextFrame is a TXXX frame.
+type ID3v2UserTextFrame struct {
+	ID3v2Frame
+	Description string
+	Value       string
+}
+
+// ID3v2CommentFrame is a COMM frame.
+type ID3v2CommentFrame struct {
+	ID3v2Frame
+	Language    string
+	Description string
+	Text        string
+}
+
+// ID3v2PictureFrame is an APIC frame, or a PIC frame of ID3v2.2 whose image
+// format ("JPG", "PNG") is kept as MIMEType.
+type ID3v2PictureFrame struct {
+	ID3v2Frame
+	MIMEType    string
+	PictureType uint8
+	Description string
+	Picture     []byte
+}
+
+// ID3v2PrivateFrame is a PRIV frame.
+type ID3v2PrivateFrame struct {
+	ID3v2Frame
+	Owner   string
+	Private []byte
+}
+
+// id3Synchsafe reads a 28 bits integer stored in 4 bytes of 7 bits.
+func id3Synchsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// id3Resync undoes the unsynchronisation scheme: 0xFF 0x00 becomes 0xFF.
+func id3Resync(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xff, 0x00}, []byte{0xff})
+}
+
+func id3Encoding(enc byte) encoding.Encoding {
+	switch enc {
+	case 1:
+		return unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	case 2:
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case 3:
+		return unicode.UTF8
+	default:
+		return charmap.ISO8859_1
+	}
+}
+
+// id3Split cuts b at the first string terminator of the encoding, one zero
+// byte or two aligned ones for UTF-16.
+func id3Split(enc byte, b []byte) (s, rest []byte) {
+	if enc == 1 || enc == 2 {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return b[:i], b[i+2:]
+			}
+		}
+		return b, nil
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return b[:i], b[i+1:]
+	}
+	return b, nil
+}
+
+func id3Decode(enc byte, b []byte) string {
+	s, err := id3Encoding(enc).NewDecoder().Bytes(b)
+	if err != nil {
+		return string(b)
+	}
+	return strings.TrimRight(string(s), "\x00")
+}
+
+// Unmarshal reads the ID3v2 tag at the start of b. Data keeps the tag as
+// found, footer included, so that it can be written back unchanged. Only a
+// bad tag header is an error: frames are read up to the first one that does
+// not parse, as taggers often leave sloppy frames behind.
+func (block *ID3v2Block) Unmarshal(b []byte) (err error) {
+	if len(b) < 10 || string(b[0:3]) != "ID3" {
+		return ErrBadData
+	}
+	block.Version = b[3]
+	block.Revision = b[4]
+	block.Flags = b[5]
+	size := 10 + id3Synchsafe(b[6:10])
+	if block.Version >= 4 && block.Flags&ID3V2_FOOTER != 0 {
+		size += 10
+	}
+	if size > len(b) {
+		return ErrBadData
+	}
+	block.Size = size
+	block.Data = b[:size]
+	block.Frames = make([]interface{}, 0)
+
+	body := b[10 : 10+id3Synchsafe(b[6:10])]
+	if block.Version < 4 && block.Flags&ID3V2_UNSYNC != 0 {
+		body = id3Resync(body)
+	}
+	if block.Flags&ID3V2_EXTENDED != 0 && len(body) >= 4 {
+		n := int(binary.BigEndian.Uint32(body))
+		if block.Version >= 4 {
+			n = id3Synchsafe(body)
+		} else {
+			n += 4
+		}
+		if n > len(body) {
+			return nil
+		}
+		body = body[n:]
+	}
+	for len(body) > 0 && body[0] != 0 {
+		frame, n, err := block.readFrame(body)
+		if err != nil {
+			break
+		}
+		block.Frames = append(block.Frames, frame)
+		body = body[n:]
+	}
+	return nil
+}
+
+// readFrame reads the frame at the start of b and returns it with the
+// number of bytes it takes.
+func (block *ID3v2Block) readFrame(b []byte) (interface{}, int, error) {
+	f := ID3v2Frame{}
+	var size, head int
+	switch block.Version {
+	case 2:
+		if len(b) < 6 {
+			return nil, 0, ErrBadData
+		}
+		f.ID = string(b[0:3])
+		size, head = int(b[3])<<16|int(b[4])<<8|int(b[5]), 6
+	case 3:
+		if len(b) < 10 {
+			return nil, 0, ErrBadData
+		}
+		f.ID = string(b[0:4])
+		size, head = int(binary.BigEndian.Uint32(b[4:8])), 10
+		f.Flags = binary.BigEndian.Uint16(b[8:10])
+	default:
+		if len(b) < 10 {
+			return nil, 0, ErrBadData
+		}
+		f.ID = string(b[0:4])
+		size, head = id3Synchsafe(b[4:8]), 10
+		if b[4]|b[5]|b[6]|b[7] >= 0x80 {
+			// some taggers write plain sizes in ID3v2.4 tags
+			size = int(binary.BigEndian.Uint32(b[4:8]))
+		}
+		f.Flags = binary.BigEndian.Uint16(b[8:10])
+	}
+	for _, c := range []byte(f.ID) {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return nil, 0, ErrBadData
+		}
+	}
+	if size < 0 || head+size > len(b) {
+		return nil, 0, ErrBadData
+	}
+	f.Data = b[head : head+size]
+	skip := func(n int) {
+		if n > len(f.Data) {
+			n = len(f.Data)
+		}
+		f.Data = f.Data[n:]
+	}
+
+	compressed, encrypted := false, false
+	switch block.Version {
+	case 3:
+		if f.Flags&0x0080 != 0 {
+			compressed = true
+			skip(4)
+		}
+		if f.Flags&0x0040 != 0 {
+			encrypted = true
+			skip(1)
+		}
+		if f.Flags&0x0020 != 0 {
+			skip(1)
+		}
+	case 4:
+		if f.Flags&0x0040 != 0 {
+			skip(1)
+		}
+		if f.Flags&0x0004 != 0 {
+			encrypted = true
+			skip(1)
+		}
+		if f.Flags&0x0001 != 0 {
+			skip(4)
+		}
+		if f.Flags&0x0002 != 0 || block.Flags&ID3V2_UNSYNC != 0 {
+			f.Data = id3Resync(f.Data)
+		}
+		compressed = f.Flags&0x0008 != 0
+	}
+	if encrypted {
+		return &f, head + size, nil
+	}
+	if compressed {
+		r, err := zlib.NewReader(bytes.NewReader(f.Data))
+		if err != nil {
+			return &f, head + size, nil
+		}
+		if data, err := ioutil.ReadAll(r); err == nil {
+			f.Data = data
+		}
+	}
+	return typedID3v2Frame(f), head + size, nil
+}
+
+// typedID3v2Frame decodes the frames with a known layout.
+func typedID3v2Frame(f ID3v2Frame) interface{} {
+	d := f.Data
+	switch {
+	case f.ID == "PRIV":
+		owner, rest := id3Split(0, d)
+		return &ID3v2PrivateFrame{ID3v2Frame: f, Owner: string(owner), Private: rest}
+	case len(d) == 0:
+		return &f
+	case f.ID == "TXXX" || f.ID == "TXX":
+		desc, value := id3Split(d[0], d[1:])
+		return &ID3v2UserTextFrame{
+			ID3v2Frame:  f,
+			Description: id3Decode(d[0], desc),
+			Value:       id3Decode(d[0], value),
+		}
+	case f.ID[0] == 'T':
+		t := &ID3v2TextFrame{ID3v2Frame: f, Text: make([]string, 0)}
+		for rest := d[1:]; len(rest) > 0; {
+			var s []byte
+			s, rest = id3Split(d[0], rest)
+			t.Text = append(t.Text, id3Decode(d[0], s))
+		}
+		return t
+	case (f.ID == "COMM" || f.ID == "COM") && len(d) >= 4:
+		desc, text := id3Split(d[0], d[4:])
+		return &ID3v2CommentFrame{
+			ID3v2Frame:  f,
+			Language:    string(d[1:4]),
+			Description: id3Decode(d[0], desc),
+			Text:        id3Decode(d[0], text),
+		}
+	case f.ID == "APIC" && len(d) >= 2:
+		mime, rest := id3Split(0, d[1:])
+		if len(rest) == 0 {
+			return &f
+		}
+		desc, pic := id3Split(d[0], rest[1:])
+		return &ID3v2PictureFrame{
+			ID3v2Frame:  f,
+			MIMEType:    string(mime),
+			PictureType: rest[0],
+			Description: id3Decode(d[0], desc),
+			Picture:     pic,
+		}
+	case f.ID == "PIC" && len(d) >= 5:
+		desc, pic := id3Split(d[0], d[5:])
+		return &ID3v2PictureFrame{
+			ID3v2Frame:  f,
+			MIMEType:    string(d[1:4]),
+			PictureType: d[4],
+			Description: id3Decode(d[0], desc),
+			Picture:     pic,
+		}
+	}
+	return &f
+}
@@ -0,0 +1,121 @@
+package rescene
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func id3Size(n int) []byte {
+	return []byte{byte(n>>21) & 0x7f, byte(n>>14) & 0x7f, byte(n>>7) & 0x7f, byte(n) & 0x7f}
+}
+
+func id3Tag(version, flags uint8, body []byte) []byte {
+	b := append([]byte{'I', 'D', '3', version, 0, flags}, id3Size(len(body))...)
+	return append(b, body...)
+}
+
+// id3Frame returns a frame of an ID3v2.3 tag, or of an ID3v2.4 tag with a
+// synchsafe size.
+func id3Frame(version uint8, id string, flags uint16, data []byte) []byte {
+	b := append([]byte(id), 0, 0, 0, 0, byte(flags>>8), byte(flags))
+	if version >= 4 {
+		copy(b[4:], id3Size(len(data)))
+	} else {
+		binary.BigEndian.PutUint32(b[4:], uint32(len(data)))
+	}
+	return append(b, data...)
+}
+
+// id3Unsync applies the unsynchronisation scheme to b.
+func id3Unsync(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for _, c := range b {
+		out = append(out, c)
+		if c == 0xff {
+			out = append(out, 0)
+		}
+	}
+	return out
+}
+
+func id3Text(b *ID3v2Block, i int) string {
+	if i >= len(b.Frames) {
+		return ""
+	}
+	switch f := b.Frames[i].(type) {
+	case *ID3v2TextFrame:
+		if len(f.Text) > 0 {
+			return f.Text[0]
+		}
+	case *ID3v2CommentFrame:
+		return f.Text
+	}
+	return ""
+}
+
+func TestID3v2Frames(t *testing.T) {
+	title := append([]byte{0}, "Title"...)
+	comment := append([]byte{0}, "eng\x00Comment"...)
+	tests := []struct {
+		name string
+		tag  []byte
+		want []string
+	}{
+		{"v2.3", id3Tag(3, 0, append(
+			id3Frame(3, "TIT2", 0, title),
+			append(id3Frame(3, "COMM", 0, comment), make([]byte, 16)...)...)),
+			[]string{"Title", "Comment"}},
+		{"v2.4", id3Tag(4, 0, append(
+			id3Frame(4, "TIT2", 0, append([]byte{3}, "Tïtle"...)),
+			id3Frame(4, "TPE1", 0, append([]byte{0}, make([]byte, 200)...))...)),
+			[]string{"Tïtle", ""}},
+		// 0xFF 0x00 in the stored tag stands for 0xFF
+		{"v2.3 unsync", id3Tag(3, ID3V2_UNSYNC, id3Unsync(
+			id3Frame(3, "TIT2", 0, []byte{0, 'A', 0xff, 'B'}))),
+			[]string{"AÿB"}},
+		{"v2.4 frame unsync", id3Tag(4, 0,
+			id3Frame(4, "TIT2", 0x0002, []byte{0, 'A', 0xff, 0x00, 'B'})),
+			[]string{"AÿB"}},
+		{"truncated frame", id3Tag(3, 0, append(
+			id3Frame(3, "TIT2", 0, title),
+			id3Frame(3, "COMM", 0, comment)[:14]...)),
+			[]string{"Title"}},
+		{"bad frame id", id3Tag(3, 0, append(
+			id3Frame(3, "TIT2", 0, title),
+			id3Frame(3, "c\x01mm", 0, comment)...)),
+			[]string{"Title"}},
+		{"bad extended header", id3Tag(3, ID3V2_EXTENDED, append(
+			[]byte{0, 0, 1, 0},
+			id3Frame(3, "TIT2", 0, title)...)),
+			nil},
+	}
+	for _, tt := range tests {
+		data := append(append([]byte(nil), tt.tag...), "audio"...)
+		b := &ID3v2Block{}
+		if err := b.Unmarshal(data); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if b.Size != len(tt.tag) || len(b.Data) != len(tt.tag) {
+			t.Errorf("%s: size %d/%d, want %d", tt.name, b.Size, len(b.Data), len(tt.tag))
+		}
+		if len(b.Frames) != len(tt.want) {
+			t.Errorf("%s: got %d frames, want %d", tt.name, len(b.Frames), len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			if got := id3Text(b, i); got != want {
+				t.Errorf("%s: frame %d is %q, want %q", tt.name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestID3v2BadHeader(t *testing.T) {
+	tag := id3Tag(3, 0, id3Frame(3, "TIT2", 0, []byte{0, 'A'}))
+	for _, b := range [][]byte{tag[:9], tag[:len(tag)-1], append([]byte("ID2"), tag[3:]...)} {
+		if err := (&ID3v2Block{}).Unmarshal(b); err != ErrBadData {
+			t.Errorf("%q: got %v, want ErrBadData", b, err)
+		}
+	}
+}
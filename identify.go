@@ -0,0 +1,184 @@
+package rescene
+
+import (
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FileHashes are the size, CRC32 and OSO hash of a file, the values SRRs
+// keep of the files they describe.
+type FileHashes struct {
+	Path    string
+	Size    uint64
+	CRC     uint32
+	OSOHash uint64
+}
+
+const (
+	RoleRarVolume  = "rar_volume"
+	RolePackedFile = "packed_file"
+	RoleOSOHash    = "oso_hash"
+)
+
+// FileMatch is a release a file was found in. Role tells what the file is
+// in the release (RoleRarVolume, RolePackedFile or RoleOSOHash, which is a
+// packed file known by its OSO hash) and Name its name there.
+type FileMatch struct {
+	Release string
+	Role    string
+	Name    string
+}
+
+// osoHasher computes the OSO hash of what is written to it, keeping the
+// first and the last 64 KiB.
+type osoHasher struct {
+	size uint64
+	head []byte
+	tail []byte
+}
+
+func (h *osoHasher) Write(p []byte) (int, error) {
+	h.size += uint64(len(p))
+	if n := 65536 - len(h.head); n > 0 {
+		if n > len(p) {
+			n = len(p)
+		}
+		h.head = append(h.head, p[:n]...)
+	}
+	h.tail = append(h.tail, p...)
+	if len(h.tail) > 2*65536 {
+		h.tail = append([]byte(nil), h.tail[len(h.tail)-65536:]...)
+	}
+	return len(p), nil
+}
+
+// Sum64 returns the hash as OSOHashFile computes it: the head and the tail
+// of a file under 64 KiB are padded with zeros, which keeps its last
+// partial word.
+func (h *osoHasher) Sum64() uint64 {
+	tail := h.tail
+	if len(tail) > 65536 {
+		tail = tail[len(tail)-65536:]
+	}
+	return osoSum(h.size, osoPad(h.head), osoPad(tail))
+}
+
+func osoPad(b []byte) []byte {
+	if len(b) >= 65536 {
+		return b
+	}
+	return append(b[:len(b):len(b)], make([]byte, 65536-len(b))...)
+}
+
+// HashFile reads a file once and computes its hashes, the hashers running
+// in parallel on the blocks read.
+func HashFile(path string) (*FileHashes, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	crc := crc32.NewIEEE()
+	oso := &osoHasher{}
+	hashers := []io.Writer{crc, oso}
+	chans := make([]chan []byte, len(hashers))
+	var wg sync.WaitGroup
+	for i, h := range hashers {
+		chans[i] = make(chan []byte, 4)
+		wg.Add(1)
+		go func(h io.Writer, c chan []byte) {
+			defer wg.Done()
+			for b := range c {
+				h.Write(b)
+			}
+		}(h, chans[i])
+	}
+
+	var size uint64
+	for {
+		// each block goes to every hasher, so it is not reused
+		b := make([]byte, 1<<20)
+		n, err := io.ReadFull(file, b)
+		if n > 0 {
+			size += uint64(n)
+			for _, c := range chans {
+				c <- b[:n]
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			for _, c := range chans {
+				close(c)
+			}
+			wg.Wait()
+			return nil, err
+		}
+	}
+	for _, c := range chans {
+		close(c)
+	}
+	wg.Wait()
+	return &FileHashes{
+		Path:    filepath.Base(path),
+		Size:    size,
+		CRC:     crc.Sum32(),
+		OSOHash: oso.Sum64(),
+	}, nil
+}
+
+// Match returns the roles the file of these hashes has in the SRR: a RAR
+// volume listed in the stored SFV, a packed file of the same CRC and size,
+// or a file of the same OSO hash and size. Release names the matches.
+func (h *FileHashes) Match(release string, f *SrrFile) []*FileMatch {
+	matches := make([]*FileMatch, 0)
+	for _, v := range f.RarFiles {
+		if v.CRC != 0 && v.CRC == h.CRC && uint64(v.Size) == h.Size {
+			matches = append(matches, &FileMatch{release, RoleRarVolume, v.Path})
+		}
+	}
+	for _, p := range f.PackedFiles {
+		if p.CRC == h.CRC && p.Size == h.Size && !p.Properties.Directory {
+			matches = append(matches, &FileMatch{release, RolePackedFile, p.Path})
+		}
+	}
+	for _, o := range f.OSOHashes {
+		if o.Hash == h.OSOHash && o.Size == h.Size {
+			matches = append(matches, &FileMatch{release, RoleOSOHash, o.Path})
+		}
+	}
+	return matches
+}
+
+// Identify hashes a file and looks for it in SRRs, given by release name,
+// see MatchReleases.
+func Identify(path string, srrs map[string]*SrrFile) (*FileHashes, []*FileMatch, error) {
+	h, err := HashFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h, h.MatchReleases(srrs), nil
+}
+
+// MatchReleases returns the matches of the file in SRRs, given by release
+// name. Matches are sorted by release name.
+func (h *FileHashes) MatchReleases(srrs map[string]*SrrFile) []*FileMatch {
+	names := make([]string, 0, len(srrs))
+	for name := range srrs {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+	matches := make([]*FileMatch, 0)
+	for _, name := range names {
+		matches = append(matches, h.Match(name, srrs[name])...)
+	}
+	return matches
+}
@@ -0,0 +1,82 @@
+package rescene
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// sfvOf returns an SFV listing the volumes found in dir.
+func sfvOf(t *testing.T, dir string, volumes []string) string {
+	t.Helper()
+	sfv := ""
+	for _, v := range volumes {
+		b, err := ioutil.ReadFile(filepath.Join(dir, v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sfv += fmt.Sprintf("%s %08x\r\n", v, crc32.ChecksumIEEE(b))
+	}
+	return sfv
+}
+
+func TestHashFileOSO(t *testing.T) {
+	dir := t.TempDir()
+	for _, size := range []int{0, 7, 100, 104, 65535, 65536, 65540, 3 << 16, 1<<20 + 3} {
+		p := filepath.Join(dir, "file.bin")
+		writeTestFile(t, p, testData(size, byte(size)))
+		h, err := HashFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		oso, err := OSOHashFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.OSOHash != oso.Hash || h.Size != uint64(size) {
+			t.Errorf("size %d: HashFile %016x, OSOHashFile %016x", size, h.OSOHash, oso.Hash)
+		}
+		if h.CRC != crc32.ChecksumIEEE(testData(size, byte(size))) {
+			t.Errorf("size %d: CRC %08x", size, h.CRC)
+		}
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{"movie.mkv": testData(2500, 1)}
+	volumes := rarSplit(t, dir, "movie", 1000, files, "movie.mkv")
+	writeTestFile(t, filepath.Join(dir, "movie.mkv"), files["movie.mkv"])
+	writeTestFile(t, filepath.Join(dir, "movie.sfv"), []byte(sfvOf(t, dir, volumes)))
+	f := srrOf(t, dir, volumes, CreateOptions{
+		StoredFiles: []*CreateEntry{{Name: "movie.sfv", Path: filepath.Join(dir, "movie.sfv")}},
+		HashedFiles: []*CreateEntry{{Name: "movie.mkv", Path: filepath.Join(dir, "movie.mkv")}},
+	})
+	srrs := map[string]*SrrFile{"Group.Movie": f, "group.other": {}}
+
+	tests := []struct {
+		file  string
+		roles []string
+	}{
+		{"movie.mkv", []string{RolePackedFile, RoleOSOHash}},
+		{volumes[1], []string{RoleRarVolume}},
+		{"movie.sfv", nil},
+	}
+	for _, tt := range tests {
+		h, matches, err := Identify(filepath.Join(dir, tt.file), srrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Path != tt.file || len(matches) != len(tt.roles) {
+			t.Errorf("%s: %s, %d matches, want %d", tt.file, h.Path, len(matches), len(tt.roles))
+			continue
+		}
+		for i, m := range matches {
+			if m.Release != "Group.Movie" || m.Role != tt.roles[i] {
+				t.Errorf("%s: match %d is %+v, want %s", tt.file, i, m, tt.roles[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package rescene
+
+import (
+	"sort"
+	"strings"
+)
+
+// PackedExtent is a run of bytes of a packed file stored in one volume:
+// Size bytes from PackedOffset in the file are found at VolumeOffset in
+// Volume. Only stored archives keep the packed bytes as they are in the
+// file; for compressed ones the offsets are those of the packed stream.
+type PackedExtent struct {
+	Volume       *RarFile
+	VolumeOffset int64
+	PackedOffset int64
+	Size         int64
+}
+
+// packedKey names a packed file of an archive set: sets are free to hold
+// files of the same name.
+type packedKey struct {
+	set  string // see setKey
+	name string
+}
+
+// packedExtents returns the extents of every packed file, by archive set
+// and file name, in packed file order. The volume offsets are worked out like writeVolumes
+// lays the volumes out: headers as kept in the SRR, packed data, padding
+// and the data of service blocks.
+func (f *SrrFile) packedExtents() map[packedKey][]PackedExtent {
+	extents := make(map[packedKey][]PackedExtent)
+	var pos int64
+	for _, block := range f.Blocks {
+		if block.Volume == nil {
+			continue
+		}
+		switch h := block.Header.(type) {
+		case *SrrRarSubBlockHeadBlock:
+			pos = 0
+		case *SrrRarPadHeadBlock:
+			pos += int64(h.PadSize)
+		case *FileHeadBlock:
+			pos += int64(len(block.Raw))
+			size := int64(h.GetPackSize())
+			if size == 0 {
+				continue
+			}
+			key := packedKey{setKey(block.Volume.Path), h.GetFileName()}
+			var packed int64
+			if prev := extents[key]; h.Flag(LHD_SPLIT_BEFORE) && len(prev) > 0 {
+				last := prev[len(prev)-1]
+				packed = last.PackedOffset + last.Size
+			} else {
+				// a new file of the same name replaces the previous one
+				extents[key] = nil
+			}
+			extents[key] = append(extents[key], PackedExtent{block.Volume, pos, packed, size})
+			pos += size
+		case *NewSubHeadBlock:
+			pos += int64(h.GetSize())
+		case *SubHeadBlock:
+			pos += int64(h.GetSize())
+		case *ProtectHeadBlock:
+			pos += int64(h.GetSize())
+		default:
+			pos += int64(len(block.Raw))
+		}
+	}
+	return extents
+}
+
+// PackedExtents returns where the bytes of a packed file are stored, in
+// packed file order, nil when no file has this name. When several archive
+// sets hold a file of this name, the first set of ArchiveSets is used; see
+// ArchiveSetExtents.
+func (f *SrrFile) PackedExtents(name string) []PackedExtent {
+	extents := f.packedExtents()
+	for _, set := range f.ArchiveSets() {
+		if e, ok := extents[packedKey{strings.ToLower(set.Root), name}]; ok {
+			return e
+		}
+	}
+	return nil
+}
+
+// ArchiveSetExtents is PackedExtents for the file of an archive set.
+func (f *SrrFile) ArchiveSetExtents(set *ArchiveSet, name string) []PackedExtent {
+	return f.packedExtents()[packedKey{strings.ToLower(set.Root), name}]
+}
+
+// VolumeOffset tells in which volume, and where in it, byte offset of the
+// packed file name is stored, name being looked up like PackedExtents. It
+// returns ErrNotFound for an unknown file and ErrBadData for an offset past
+// its end.
+func (f *SrrFile) VolumeOffset(name string, offset int64) (*RarFile, int64, error) {
+	extents := f.PackedExtents(name)
+	if extents == nil {
+		return nil, 0, ErrNotFound
+	}
+	i := sort.Search(len(extents), func(i int) bool {
+		return extents[i].PackedOffset+extents[i].Size > offset
+	})
+	if offset < 0 || i == len(extents) {
+		return nil, 0, ErrBadData
+	}
+	e := extents[i]
+	return e.Volume, e.VolumeOffset + offset - e.PackedOffset, nil
+}
+
+// PackedOffset tells which packed file, and which byte of it, is stored at
+// offset of the volume, named as in RarFiles (case is ignored). It returns
+// ErrNotFound when the volume is unknown or when the offset is not in
+// packed data but in a header, padding or a service block.
+func (f *SrrFile) PackedOffset(volume string, offset int64) (string, int64, error) {
+	for key, extents := range f.packedExtents() {
+		for _, e := range extents {
+			if strings.EqualFold(e.Volume.Path, volume) &&
+				offset >= e.VolumeOffset && offset < e.VolumeOffset+e.Size {
+				return key.name, e.PackedOffset + offset - e.VolumeOffset, nil
+			}
+		}
+	}
+	return "", 0, ErrNotFound
+}
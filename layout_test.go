@@ -0,0 +1,108 @@
+package rescene
+
+import (
+	"bytes"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+func TestPackedExtentsSplit(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"movie.mkv": testData(2500, 1),
+		"movie.nfo": testData(300, 2),
+	}
+	volumes := rarSplit(t, dir, "movie", 1000, files, "movie.mkv", "movie.nfo")
+	f := srrOf(t, dir, volumes, CreateOptions{})
+
+	extents := f.PackedExtents("movie.mkv")
+	if len(extents) != 3 {
+		t.Fatalf("got %d extents, want 3", len(extents))
+	}
+	var packed int64
+	for i, e := range extents {
+		if e.Volume.Path != volumes[i] || e.PackedOffset != packed {
+			t.Errorf("extent %d: %s at %d, want %s at %d", i, e.Volume.Path, e.PackedOffset, volumes[i], packed)
+		}
+		packed += e.Size
+	}
+	if packed != 2500 {
+		t.Errorf("extents hold %d bytes, want 2500", packed)
+	}
+
+	for _, offset := range []int64{0, 999, 1000, 2499} {
+		v, at, err := f.VolumeOffset("movie.mkv", offset)
+		if err != nil {
+			t.Fatalf("VolumeOffset(%d): %v", offset, err)
+		}
+		name, back, err := f.PackedOffset(v.Path, at)
+		if err != nil || name != "movie.mkv" || back != offset {
+			t.Errorf("PackedOffset(%s, %d) = %s, %d, %v; want movie.mkv, %d", v.Path, at, name, back, err, offset)
+		}
+	}
+	if _, _, err := f.VolumeOffset("movie.mkv", 2500); err != ErrBadData {
+		t.Errorf("offset past the end: %v", err)
+	}
+	if _, _, err := f.VolumeOffset("movie.avi", 0); err != ErrNotFound {
+		t.Errorf("unknown file: %v", err)
+	}
+	if _, _, err := f.PackedOffset(volumes[0], 0); err != ErrNotFound {
+		t.Errorf("offset in a header: %v", err)
+	}
+
+	fsys, err := f.PackedFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range files {
+		got, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s read from the volumes differs", name)
+		}
+	}
+}
+
+func TestPackedExtentsSets(t *testing.T) {
+	dir := t.TempDir()
+	a := map[string][]byte{"file.bin": testData(1500, 1)}
+	b := map[string][]byte{"file.bin": testData(700, 2)}
+	volumes := rarSplit(t, filepath.Join(dir, "a"), "a", 1000, a, "file.bin")
+	for _, v := range rarSplit(t, filepath.Join(dir, "b"), "b", 1000, b, "file.bin") {
+		volumes = append(volumes, filepath.Join("..", "b", v))
+	}
+	f := srrOf(t, filepath.Join(dir, "a"), volumes, CreateOptions{})
+
+	sets := f.ArchiveSets()
+	if len(sets) != 2 {
+		t.Fatalf("got %d sets, want 2", len(sets))
+	}
+	for i, want := range []int64{1500, 700} {
+		var size int64
+		for _, e := range f.ArchiveSetExtents(sets[i], "file.bin") {
+			size += e.Size
+		}
+		if size != want {
+			t.Errorf("set %s: %d bytes, want %d", sets[i].Root, size, want)
+		}
+	}
+	if e := f.PackedExtents("file.bin"); len(e) != 2 || e[0].Volume != sets[0].Volumes[0] {
+		t.Errorf("PackedExtents is not the first set: %+v", e)
+	}
+
+	// the file of the first set is the one listed
+	fsys, err := f.PackedFS(filepath.Join(dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fs.ReadFile(fsys, "file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, a["file.bin"]) {
+		t.Error("file.bin is not read from the first set")
+	}
+}
@@ -7,16 +7,31 @@ import (
 // TypeSrs for SRS files
 var TypeSrs = filetype.NewType("srs", "application/resample")
 
+// TypeSrr for SRR files
+var TypeSrr = filetype.NewType("srr", "application/x-srr")
+
 // TypeID3v1 for ID3v1 tags
 var TypeID3v1 = filetype.NewType("id3v1", "audio/id3v1")
 
 // TypeLyrics200 for Lyricsv2 tags
 var TypeLyrics200 = filetype.NewType("lyrics200", "audio/lyrics200")
 
+// TypeApe for APE tags
+var TypeApe = filetype.NewType("apetag", "audio/apetag")
+
+// TypeMpeg for MPEG audio frames
+var TypeMpeg = filetype.NewType("mpa", "audio/mpeg")
+
 func SrsMatcher(buf []byte) bool {
 	return len(buf) > 4 && buf[0] == 'S' && buf[1] == 'R' && buf[2] == 'S' && (buf[3] == 'F' || buf[3] == 'T' || buf[3] == 'P')
 }
 
+// SrrMatcher tells whether buf starts with the SRR volume header, whose CRC
+// and type are all 0x69.
+func SrrMatcher(buf []byte) bool {
+	return len(buf) >= 7 && buf[0] == 0x69 && buf[1] == 0x69 && buf[2] == 0x69
+}
+
 func ID3v1Matcher(buf []byte) bool {
 	return len(buf) >= 128 && buf[0] == 'T' && buf[1] == 'A' && buf[2] == 'G'
 }
@@ -25,8 +40,15 @@ func Lyrics200Matcher(buf []byte) bool {
 	return len(buf) >= 11 && buf[0] == 'L' && buf[1] == 'Y' && buf[2] == 'R' && buf[3] == 'I' && buf[4] == 'C' && buf[5] == 'S' && buf[6] == 'B' && buf[7] == 'E' && buf[8] == 'G' && buf[9] == 'I' && buf[10] == 'N'
 }
 
+func ApeMatcher(buf []byte) bool {
+	return len(buf) >= 32 && string(buf[0:8]) == "APETAGEX"
+}
+
 func init() {
 	filetype.AddMatcher(TypeSrs, SrsMatcher)
+	filetype.AddMatcher(TypeSrr, SrrMatcher)
 	filetype.AddMatcher(TypeID3v1, ID3v1Matcher)
 	filetype.AddMatcher(TypeLyrics200, Lyrics200Matcher)
+	filetype.AddMatcher(TypeApe, ApeMatcher)
+	filetype.AddMatcher(TypeMpeg, MpegMatcher)
 }
@@ -0,0 +1,181 @@
+package rescene
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// MpegBlock is a run of MPEG audio frames. Version is 10, 20 or 25 for
+// MPEG-1, MPEG-2 and MPEG-2.5, Bitrate the one of the first frame in kbit/s.
+// VBRHeader is "Xing", "Info" or "VBRI" when the first frame holds such a
+// header, VBRFrames and VBRBytes being the counts it gives.
+type MpegBlock struct {
+	Size       int
+	Frames     int
+	Version    int
+	Layer      int
+	Bitrate    int
+	VBR        bool
+	SampleRate int
+	Channels   int
+	Duration   time.Duration
+	VBRHeader  string
+	VBRFrames  uint32
+	VBRBytes   uint32
+}
+
+// mpegFrame is a decoded MPEG audio frame header.
+type mpegFrame struct {
+	version    int
+	layer      int
+	bitrate    int
+	sampleRate int
+	channels   int
+	size       int
+	samples    int
+}
+
+var mpegBitrates = map[[2]int][]int{
+	{10, 1}: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	{10, 2}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	{10, 3}: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{20, 1}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	{20, 2}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	{20, 3}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+var mpegSampleRates = map[int][]int{
+	10: {44100, 48000, 32000},
+	20: {22050, 24000, 16000},
+	25: {11025, 12000, 8000},
+}
+
+// parseMpegFrame decodes the frame header at the start of b. Free format
+// frames, whose size is not given by the header, are not supported.
+func parseMpegFrame(b []byte) (*mpegFrame, bool) {
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return nil, false
+	}
+	f := &mpegFrame{}
+	switch (b[1] >> 3) & 3 {
+	case 0:
+		f.version = 25
+	case 2:
+		f.version = 20
+	case 3:
+		f.version = 10
+	default:
+		return nil, false
+	}
+	f.layer = 4 - int((b[1]>>1)&3)
+	bitrate, rate := int(b[2]>>4), int((b[2]>>2)&3)
+	if f.layer == 4 || bitrate == 0 || bitrate == 15 || rate == 3 {
+		return nil, false
+	}
+	table := f.version
+	if table == 25 {
+		table = 20
+	}
+	f.bitrate = mpegBitrates[[2]int{table, f.layer}][bitrate]
+	f.sampleRate = mpegSampleRates[f.version][rate]
+	padding := int((b[2] >> 1) & 1)
+	f.channels = 2
+	if b[3]>>6 == 3 {
+		f.channels = 1
+	}
+	switch {
+	case f.layer == 1:
+		f.size = (12*f.bitrate*1000/f.sampleRate + padding) * 4
+		f.samples = 384
+	case f.layer == 2 || f.version == 10:
+		f.size = 144*f.bitrate*1000/f.sampleRate + padding
+		f.samples = 1152
+	default:
+		f.size = 72*f.bitrate*1000/f.sampleRate + padding
+		f.samples = 576
+	}
+	return f, true
+}
+
+// MpegMatcher tells whether buf starts with two MPEG audio frames in a row,
+// which a false frame sync seldom gives.
+func MpegMatcher(buf []byte) bool {
+	f, ok := parseMpegFrame(buf)
+	if !ok || f.size > len(buf) {
+		return false
+	}
+	if f.size == len(buf) {
+		return true
+	}
+	g, ok := parseMpegFrame(buf[f.size:])
+	return ok && g.version == f.version && g.layer == f.layer && g.sampleRate == f.sampleRate
+}
+
+// Unmarshal reads the MPEG audio frames at the start of b, up to the first
+// bytes that are not a frame of the same stream, such as a trailing tag.
+func (block *MpegBlock) Unmarshal(b []byte) (err error) {
+	first, ok := parseMpegFrame(b)
+	if !ok || first.size > len(b) {
+		return ErrBadData
+	}
+	block.Version = first.version
+	block.Layer = first.layer
+	block.Bitrate = first.bitrate
+	block.SampleRate = first.sampleRate
+	block.Channels = first.channels
+	block.readVBRHeader(b[:first.size], first)
+
+	samples := 0
+	for offset := 0; offset < len(b); {
+		f, ok := parseMpegFrame(b[offset:])
+		if !ok || offset+f.size > len(b) || f.version != first.version || f.layer != first.layer || f.sampleRate != first.sampleRate {
+			break
+		}
+		if f.bitrate != first.bitrate {
+			block.VBR = true
+		}
+		block.Frames++
+		samples += f.samples
+		offset += f.size
+		block.Size = offset
+	}
+	block.Duration = time.Duration(samples) * time.Second / time.Duration(first.sampleRate)
+	return nil
+}
+
+// readVBRHeader looks for a Xing or Info header after the side information
+// of the first frame, and for a VBRI header 32 bytes after the frame header.
+func (block *MpegBlock) readVBRHeader(frame []byte, f *mpegFrame) {
+	side := 32
+	switch {
+	case f.version == 10 && f.channels == 1:
+		side = 17
+	case f.version != 10 && f.channels == 2:
+		side = 17
+	case f.version != 10:
+		side = 9
+	}
+	if f.layer == 3 && len(frame) >= 4+side+16 {
+		x := frame[4+side:]
+		if id := string(x[0:4]); id == "Xing" || id == "Info" {
+			block.VBRHeader = id
+			flags := binary.BigEndian.Uint32(x[4:])
+			x = x[8:]
+			if flags&1 != 0 {
+				block.VBRFrames = binary.BigEndian.Uint32(x)
+				x = x[4:]
+			}
+			if flags&2 != 0 {
+				block.VBRBytes = binary.BigEndian.Uint32(x)
+			}
+			block.VBR = block.VBR || id == "Xing"
+			return
+		}
+	}
+	if len(frame) >= 36+18 && string(frame[36:40]) == "VBRI" {
+		block.VBRHeader = "VBRI"
+		block.VBRBytes = binary.BigEndian.Uint32(frame[46:])
+		block.VBRFrames = binary.BigEndian.Uint32(frame[50:])
+		block.VBR = true
+	}
+}
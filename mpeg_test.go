@@ -0,0 +1,59 @@
+package rescene
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// mpegFrameData returns an MPEG-1 Layer III frame of 44100 Hz stereo at the
+// bitrate of the given index, with zeroed audio data.
+func mpegFrameData(bitrate byte) []byte {
+	h := []byte{0xff, 0xfb, bitrate << 4, 0x00}
+	f, _ := parseMpegFrame(h)
+	return append(h, make([]byte, f.size-4)...)
+}
+
+func TestMpegBlock(t *testing.T) {
+	xing := mpegFrameData(9)
+	copy(xing[36:], "Xing")
+	binary.BigEndian.PutUint32(xing[40:], 3)
+	binary.BigEndian.PutUint32(xing[44:], 4)
+	binary.BigEndian.PutUint32(xing[48:], 1878)
+
+	var b []byte
+	b = append(b, xing...)
+	b = append(b, mpegFrameData(9)...)
+	b = append(b, mpegFrameData(10)...)
+	b = append(b, mpegFrameData(9)...)
+	b = append(b, mpegFrameData(11)...)
+	audio := len(b)
+	b = append(b, id3v1Tag()...)
+
+	if !MpegMatcher(b) {
+		t.Error("MpegMatcher does not match")
+	}
+	block := &MpegBlock{}
+	if err := block.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	if block.Size != audio || block.Frames != 5 {
+		t.Errorf("%d frames in %d bytes, want 5 in %d", block.Frames, block.Size, audio)
+	}
+	if block.Version != 10 || block.Layer != 3 || block.Bitrate != 128 || block.SampleRate != 44100 || block.Channels != 2 {
+		t.Errorf("stream %+v", block)
+	}
+	if !block.VBR || block.VBRHeader != "Xing" || block.VBRFrames != 4 || block.VBRBytes != 1878 {
+		t.Errorf("VBR %v, header %q, %d frames, %d bytes", block.VBR, block.VBRHeader, block.VBRFrames, block.VBRBytes)
+	}
+	if want := 5 * 1152 * time.Second / 44100; block.Duration != want {
+		t.Errorf("duration %v, want %v", block.Duration, want)
+	}
+
+	if MpegMatcher(append(mpegFrameData(9)[:100], 0xff, 0xfb)) {
+		t.Error("MpegMatcher matches a cut frame")
+	}
+	if err := (&MpegBlock{}).Unmarshal([]byte("TAG")); err != ErrBadData {
+		t.Errorf("no frame: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package rescene
+
+import (
+	"path"
+	"strings"
+)
+
+// ParseNested parses the stored files that are SRS or SRR files themselves,
+// such as the SRS of a sample or the SRR of a subs archive, into their Srs
+// or Srr field, and does the same in the nested SRRs. Files are recognised
+// by their signature, SRS files of video samples by their extension. A file
+// that can not be parsed stays opaque and the first such error is returned
+// once the whole tree has been walked.
+func (f *SrrFile) ParseNested() error {
+	f.nested = true
+	var first error
+	for _, sf := range f.StoredFiles {
+		var err error
+		switch {
+		case SrrMatcher(sf.Data):
+			s := &SrrFile{}
+			if err = s.Unmarshal(sf.Data); err == nil {
+				sf.Srr = s
+				err = s.ParseNested()
+			}
+		case SrsMatcher(sf.Data) || strings.EqualFold(path.Ext(sf.Path), ".srs"):
+			s := &SrsFile{}
+			if err = s.Unmarshal(sf.Data); err == nil {
+				sf.Srs = s
+			}
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,44 @@
+package rescene
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseNested(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{"subs.rar.bin": testData(100, 1)}
+	volumes := rarSplit(t, dir, "subs", 1000, files, "subs.rar.bin")
+	writeTestFile(t, filepath.Join(dir, "sample.srs"), srsOf("sample.mp3", testData(10, 2)))
+	var inner bytes.Buffer
+	err := CreateSrr(&inner, []string{filepath.Join(dir, volumes[0])}, CreateOptions{
+		StoredFiles: []*CreateEntry{{Name: "Sample/sample.srs", Path: filepath.Join(dir, "sample.srs")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &SrrFile{StoredFiles: []*StoredFile{
+		{Path: "Subs/subs.srr", Data: inner.Bytes()},
+		{Path: "Sample/sample.srs", Data: srsOf("sample.mp3", testData(10, 3))},
+		{Path: "short.srs", Data: []byte("SRSF\x00")},
+		{Path: "empty.srs", Data: []byte("SRSF\x00\x00\x00\x00")},
+		{Path: "release.nfo", Data: []byte("nfo")},
+	}}
+	if err = f.ParseNested(); err != ErrBadData {
+		t.Errorf("ParseNested() = %v, want ErrBadData", err)
+	}
+	srr := f.StoredFiles[0].Srr
+	if srr == nil || len(srr.StoredFiles) != 1 || srr.StoredFiles[0].Srs == nil {
+		t.Fatalf("nested SRR %+v", srr)
+	}
+	if f.StoredFiles[1].Srs == nil {
+		t.Error("the SRS is not parsed")
+	}
+	for _, sf := range f.StoredFiles[2:] {
+		if sf.Srs != nil || sf.Srr != nil {
+			t.Errorf("%s is parsed", sf.Path)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package rescene
+
+import (
+	"bytes"
+	_ "embed"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+//go:generate go run fonts/gen.go -o fonts/cp437-8x16.bin
+
+// nfoFont holds the 8×16 glyphs of the 256 characters of code page 437 in
+// the font of the IBM VGA, one byte per row, see fonts/gen.go.
+//
+//go:embed fonts/cp437-8x16.bin
+var nfoFont []byte
+
+const nfoCellWidth, nfoCellHeight = 8, 16
+
+// NfoMaxScale is the largest NfoOptions.Scale RenderNfo accepts.
+const NfoMaxScale = 8
+
+// nfoMaxPixels bounds the size of the images RenderNfo draws.
+const nfoMaxPixels = 1 << 28
+
+// sauceSize is the size of a SAUCE record, the metadata some ANSI editors
+// append to the files they save.
+const sauceSize = 128
+
+// NfoText returns the text of a stored .nfo file as UTF-8 with "\n" line
+// endings. The encoding is guessed: UTF-8 when the data is valid UTF-8,
+// otherwise CP437, the encoding of DOS ASCII art, unless the text looks like
+// Windows-1252. A trailing SAUCE record is removed.
+func NfoText(sf *StoredFile) (string, error) {
+	if sf == nil || sf.Data == nil {
+		return "", ErrNoData
+	}
+	data := stripSauce(sf.Data)
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var s string
+	if enc := nfoEncoding(data); enc == nil {
+		s = string(data)
+	} else {
+		b, err := enc.NewDecoder().Bytes(data)
+		if err != nil {
+			return "", err
+		}
+		s = string(b)
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return s, nil
+}
+
+// stripSauce removes a SAUCE record, its comment block and the end of file
+// character before them.
+func stripSauce(data []byte) []byte {
+	n := len(data) - sauceSize
+	if n < 0 || string(data[n:n+7]) != "SAUCE00" {
+		return bytes.TrimRight(data, "\x1a")
+	}
+	sauce := data[n:]
+	data = data[:n]
+	// the comment block is "COMNT" followed by 64 bytes per line
+	if lines := int(sauce[104]); lines > 0 {
+		if c := len(data) - 5 - 64*lines; c >= 0 && string(data[c:c+5]) == "COMNT" {
+			data = data[:c]
+		}
+	}
+	return bytes.TrimRight(data, "\x1a")
+}
+
+// nfoEncoding guesses the encoding of data, nil meaning UTF-8. CP437 box
+// drawing and block characters are in 0xB0-0xDF, where Windows-1252 has
+// few letters; its lower case accented letters are in 0xE0-0xFF, where
+// CP437 has Greek and math symbols.
+func nfoEncoding(data []byte) encoding.Encoding {
+	if utf8.Valid(data) {
+		return nil
+	}
+	var art, latin int
+	for _, c := range data {
+		switch {
+		case c >= 0xb0 && c <= 0xdf:
+			art++
+		case c >= 0xe0:
+			latin++
+		}
+	}
+	if latin > art {
+		return charmap.Windows1252
+	}
+	return charmap.CodePage437
+}
+
+// NfoOptions are the options of RenderNfo. The colours default to black on
+// white and Scale, the size in pixels of a font pixel, to 1. Scale may not
+// be over NfoMaxScale. Font replaces the embedded VGA font with another
+// 8×16 code page 437 bitmap of 4096 bytes laid out the same way.
+type NfoOptions struct {
+	Foreground color.Color
+	Background color.Color
+	Scale      int
+	Font       []byte
+}
+
+// RenderNfo draws the text of a stored .nfo file, as decoded by NfoText,
+// with the embedded 8×16 font or opts.Font. Characters missing from code
+// page 437 are drawn as '?' and tabs stop every 8 columns. A Scale over
+// NfoMaxScale, a Font that is not 4096 bytes long, or an image of more
+// than 2^28 pixels, returns ErrBadData.
+func RenderNfo(sf *StoredFile, opts NfoOptions) (image.Image, error) {
+	text, err := NfoText(sf)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Foreground == nil {
+		opts.Foreground = color.Black
+	}
+	if opts.Background == nil {
+		opts.Background = color.White
+	}
+	if opts.Scale < 1 {
+		opts.Scale = 1
+	} else if opts.Scale > NfoMaxScale {
+		return nil, ErrBadData
+	}
+	font := nfoFont
+	if opts.Font != nil {
+		if len(opts.Font) != 256*nfoCellHeight {
+			return nil, ErrBadData
+		}
+		font = opts.Font
+	}
+
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	cells := make([][]byte, len(lines))
+	cols := 1
+	for i, line := range lines {
+		for _, r := range line {
+			if r == '\t' {
+				cells[i] = append(cells[i], ' ')
+				for len(cells[i])%8 != 0 {
+					cells[i] = append(cells[i], ' ')
+				}
+				continue
+			}
+			c, ok := byte(r), r < 0x20
+			if !ok {
+				c, ok = charmap.CodePage437.EncodeRune(r)
+			}
+			if !ok {
+				c = '?'
+			}
+			cells[i] = append(cells[i], c)
+		}
+		if len(cells[i]) > cols {
+			cols = len(cells[i])
+		}
+	}
+
+	scale := opts.Scale
+	width, height := cols*nfoCellWidth*scale, len(lines)*nfoCellHeight*scale
+	if width > nfoMaxPixels/height {
+		return nil, ErrBadData
+	}
+	img := image.NewPaletted(image.Rect(0, 0, width, height),
+		color.Palette{opts.Background, opts.Foreground})
+	for y, line := range cells {
+		for x, c := range line {
+			glyph := font[int(c)*nfoCellHeight : (int(c)+1)*nfoCellHeight]
+			for gy, bits := range glyph {
+				for gx := 0; gx < nfoCellWidth; gx++ {
+					if bits&(0x80>>uint(gx)) == 0 {
+						continue
+					}
+					px := (x*nfoCellWidth + gx) * scale
+					py := (y*nfoCellHeight + gy) * scale
+					for i := py; i < py+scale; i++ {
+						row := img.Pix[i*img.Stride:]
+						for j := px; j < px+scale; j++ {
+							row[j] = 1
+						}
+					}
+				}
+			}
+		}
+	}
+	return img, nil
+}
+
+// WriteNfoPNG writes the image of RenderNfo to w as PNG.
+func WriteNfoPNG(w io.Writer, sf *StoredFile, opts NfoOptions) error {
+	img, err := RenderNfo(sf, opts)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
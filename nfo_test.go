@@ -0,0 +1,177 @@
+package rescene
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestNfoText(t *testing.T) {
+	sauce := make([]byte, sauceSize)
+	copy(sauce, "SAUCE00")
+	tests := []struct {
+		name string
+		data string
+		text string
+	}{
+		{"ASCII", "Group\r\nRelease\r\n", "Group\nRelease\n"},
+		{"UTF-8", "caf\xc3\xa9 \xe2\x96\x88", "café █"},
+		{"UTF-8 BOM", "\xef\xbb\xbfnfo", "nfo"},
+		{"CP437", "\xdb\xdb\xb0\xb1\xb2 \xc9\xcd\xbb\r\n\x82", "██░▒▓ ╔═╗\né"},
+		{"Windows-1252", "caf\xe9 cr\xe8me br\xfbl\xe9e", "café crème brûlée"},
+		{"old Mac", "one\rtwo", "one\ntwo"},
+		{"SAUCE", "\xdb nfo\x1a" + string(sauce), "█ nfo"},
+		{"end of file", "nfo\x1a\x1a", "nfo"},
+	}
+	for _, tt := range tests {
+		text, err := NfoText(&StoredFile{Path: "test.nfo", Data: []byte(tt.data)})
+		if err != nil || text != tt.text {
+			t.Errorf("%s: %q, %v; want %q", tt.name, text, err, tt.text)
+		}
+	}
+	if _, err := NfoText(&StoredFile{Path: "test.nfo"}); err != ErrNoData {
+		t.Errorf("no data: %v", err)
+	}
+}
+
+// nfoCell returns the pixels of the character cell at column x and line y
+// of img, one string of '#' and '.' per row.
+func nfoCell(img image.Image, x, y, scale int) []string {
+	rows := make([]string, nfoCellHeight)
+	for gy := range rows {
+		for gx := 0; gx < nfoCellWidth; gx++ {
+			r, _, _, _ := img.At((x*nfoCellWidth+gx)*scale, (y*nfoCellHeight+gy)*scale).RGBA()
+			if r == 0 {
+				rows[gy] += "#"
+			} else {
+				rows[gy] += "."
+			}
+		}
+	}
+	return rows
+}
+
+func TestRenderNfo(t *testing.T) {
+	img, err := RenderNfo(&StoredFile{Path: "test.nfo", Data: []byte("\xc9\xcd\xbb\r\nx")}, NfoOptions{Scale: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 3*nfoCellWidth*2 || b.Dy() != 2*nfoCellHeight*2 {
+		t.Errorf("scale 2: bounds %v", b)
+	}
+
+	// CP437 text with a tab
+	sf := &StoredFile{Path: "test.nfo", Data: []byte("\xda\xc4\xc2\xbf\r\n\xb3\xdb\t\xb3\r\nA")}
+	if img, err = RenderNfo(sf, NfoOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 9*nfoCellWidth || b.Dy() != 3*nfoCellHeight {
+		t.Errorf("bounds %v", b)
+	}
+	// lines join from cell to cell, as in the VGA font
+	for x := 0; x < 4; x++ {
+		if row := nfoCell(img, x, 0, 1)[7]; x > 0 && row[:4] != "####" || x < 3 && row[4:] != "####" {
+			t.Errorf("top line, cell %d: row 7 is %s", x, row)
+		}
+	}
+	for _, x := range []int{0, 8} {
+		for y, row := range nfoCell(img, x, 1, 1) {
+			if row != "...##..." {
+				t.Errorf("vertical line, cell %d: row %d is %s", x, y, row)
+			}
+		}
+	}
+	for y, row := range nfoCell(img, 1, 1, 1) {
+		if row != "########" {
+			t.Errorf("full block: row %d is %s", y, row)
+		}
+	}
+	for x := 2; x < 8; x++ {
+		for y, row := range nfoCell(img, x, 1, 1) {
+			if row != "........" {
+				t.Errorf("tab, cell %d: row %d is %s", x, y, row)
+			}
+		}
+	}
+	want := []string{
+		"........", "........", "...#....", "..###...",
+		".##.##..", "##...##.", "##...##.", "#######.",
+		"##...##.", "##...##.", "##...##.", "##...##.",
+		"........", "........", "........", "........",
+	}
+	if got := nfoCell(img, 0, 2, 1); !equalStrings(got, want) {
+		t.Errorf("A: %q", got)
+	}
+	q, err := RenderNfo(&StoredFile{Path: "test.nfo", Data: []byte("?")}, NfoOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	euro, err := RenderNfo(&StoredFile{Path: "test.nfo", Data: []byte("\xe2\x82\xac")}, NfoOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := nfoCell(euro, 0, 0, 1); !equalStrings(got, nfoCell(q, 0, 0, 1)) {
+		t.Errorf("euro sign: %q", got)
+	}
+
+	font := bytes.Repeat([]byte{0xff}, 256*nfoCellHeight)
+	img, err = RenderNfo(sf, NfoOptions{Font: font, Foreground: color.White, Background: color.Black})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r != 0xffff {
+		t.Errorf("font and colours: %v", img.At(0, 0))
+	}
+
+	for _, opts := range []NfoOptions{{Scale: NfoMaxScale + 1}, {Font: font[1:]}} {
+		if _, err := RenderNfo(sf, opts); err != ErrBadData {
+			t.Errorf("%+v: %v", opts, err)
+		}
+	}
+	long := &StoredFile{Path: "long.nfo", Data: bytes.Repeat([]byte("x"), 1<<20)}
+	if _, err := RenderNfo(long, NfoOptions{Scale: NfoMaxScale}); err != ErrBadData {
+		t.Errorf("large image: %v", err)
+	}
+	if _, err := RenderNfo(&StoredFile{Path: "test.nfo"}, NfoOptions{}); err != ErrNoData {
+		t.Errorf("no data: %v", err)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWriteNfoPNG(t *testing.T) {
+	sf := &StoredFile{Path: "test.nfo", Data: []byte("\xdc\xdf")}
+	var buf bytes.Buffer
+	if err := WriteNfoPNG(&buf, sf, NfoOptions{Scale: 3}); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 2*nfoCellWidth*3 || b.Dy() != nfoCellHeight*3 {
+		t.Fatalf("bounds %v", b)
+	}
+	// the lower half block starts at row 7, the upper half block ends there
+	lower, upper := nfoCell(img, 0, 0, 3), nfoCell(img, 1, 0, 3)
+	for y := 0; y < nfoCellHeight; y++ {
+		if (lower[y] == "########") != (y >= 7) || (upper[y] == "########") != (y < 7) {
+			t.Errorf("row %d: %s %s", y, lower[y], upper[y])
+		}
+	}
+	if err := WriteNfoPNG(&buf, sf, NfoOptions{Scale: -1, Font: []byte{0}}); err != ErrBadData {
+		t.Errorf("bad font: %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package rescene
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PackedFS is a read-only file system over the files packed in the stored
+// RAR volumes of an SRR. Files are read straight from the volumes, across
+// splits, without extracting them.
+type PackedFS struct {
+	fsTree
+}
+
+// PackedFS returns the files packed in the RAR volumes found in dir as a
+// file system. The volumes are opened when a file is read. Compressed
+// archives return ErrCompressed; encrypted files are left out.
+func (f *SrrFile) PackedFS(dir string) (*PackedFS, error) {
+	if f.RarCompressed {
+		return nil, ErrCompressed
+	}
+	extents := f.packedExtents()
+	t := newFSTree()
+	for _, set := range f.ArchiveSets() {
+		key := strings.ToLower(set.Root)
+		for _, v := range set.Volumes {
+			for _, h := range v.FileHeads {
+				if h.Flag(LHD_SPLIT_BEFORE) || h.Flag(LHD_PASSWORD) {
+					continue
+				}
+				n := &fsNode{mode: 0444, modTime: h.GetFileTime()}
+				if h.GetProperties().Directory {
+					n.mode = fs.ModeDir | 0555
+					t.add(h.GetFileName(), n)
+					continue
+				}
+				ext := extents[packedKey{key, h.GetFileName()}]
+				for _, e := range ext {
+					n.size += e.Size
+				}
+				n.open = func() (fsReader, error) {
+					return newPackedReader(dir, ext, n.size), nil
+				}
+				t.add(h.GetFileName(), n)
+			}
+		}
+	}
+	t.sort()
+	return &PackedFS{t}, nil
+}
+
+// packedReader reads a packed file from its extents, opening the volumes
+// as they are needed.
+type packedReader struct {
+	dir     string
+	extents []PackedExtent
+	size    int64
+	pos     int64
+	mu      sync.Mutex
+	volumes map[*RarFile]*os.File
+}
+
+func newPackedReader(dir string, extents []PackedExtent, size int64) *packedReader {
+	return &packedReader{
+		dir:     dir,
+		extents: extents,
+		size:    size,
+		volumes: make(map[*RarFile]*os.File),
+	}
+}
+
+func (r *packedReader) volume(v *RarFile) (*os.File, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if file, ok := r.volumes[v]; ok {
+		return file, nil
+	}
+	file, err := openPackedFile(r.dir, v.Path)
+	if err != nil {
+		return nil, err
+	}
+	r.volumes[v] = file
+	return file, nil
+}
+
+func (r *packedReader) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fs.ErrInvalid
+	}
+	n := 0
+	for n < len(b) {
+		if off >= r.size {
+			return n, io.EOF
+		}
+		i := sort.Search(len(r.extents), func(i int) bool {
+			return r.extents[i].PackedOffset+r.extents[i].Size > off
+		})
+		e := r.extents[i]
+		file, err := r.volume(e.Volume)
+		if err != nil {
+			return n, err
+		}
+		want := b[n:]
+		if rest := e.PackedOffset + e.Size - off; int64(len(want)) > rest {
+			want = want[:rest]
+		}
+		m, err := file.ReadAt(want, e.VolumeOffset+off-e.PackedOffset)
+		n += m
+		off += int64(m)
+		if err == io.EOF {
+			// the volume is shorter than the SRR says
+			return n, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (r *packedReader) Read(b []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	if rest := r.size - r.pos; int64(len(b)) > rest {
+		b = b[:rest]
+	}
+	n, err := r.ReadAt(b, r.pos)
+	r.pos += int64(n)
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *packedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, fs.ErrInvalid
+	}
+	r.pos = offset
+	return offset, nil
+}
+
+func (r *packedReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var first error
+	for v, file := range r.volumes {
+		if err := file.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(r.volumes, v)
+	}
+	return first
+}
+
+var (
+	_ fs.ReadDirFS = (*PackedFS)(nil)
+	_ fs.StatFS    = (*PackedFS)(nil)
+)
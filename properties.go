@@ -0,0 +1,76 @@
+package rescene
+
+import "strings"
+
+// ArchiveProperties are the archive wide settings read from the main header
+// of a volume and from the blocks that follow it.
+type ArchiveProperties struct {
+	Volume           bool
+	Solid            bool
+	Locked           bool
+	HasRecovery      bool
+	HasAuthInfo      bool
+	HasComment       bool
+	EncryptedHeaders bool
+}
+
+// FileProperties are the settings a packed file was archived with, read
+// from its first file header.
+type FileProperties struct {
+	Encrypted     bool
+	Salt          bool
+	Solid         bool
+	Directory     bool
+	DictSize      int // KB
+	UnpackVersion uint8
+	Method        uint8
+}
+
+// GetProperties returns the settings of the main header flags. Recovery
+// records and authenticity information are only flagged by RAR 2.x, RAR 3.x
+// adds them as service blocks.
+func (b *MainHeadBlock) GetProperties() ArchiveProperties {
+	return ArchiveProperties{
+		Volume:           b.Flag(MHD_VOLUME),
+		Solid:            b.Flag(MHD_SOLID),
+		Locked:           b.Flag(MHD_LOCK),
+		HasRecovery:      b.Flag(MHD_PROTECT),
+		HasAuthInfo:      b.Flag(MHD_AV),
+		HasComment:       b.Flag(MHD_COMMENT),
+		EncryptedHeaders: b.Flag(MHD_PASSWORD),
+	}
+}
+
+func (b *FileHeadBlock) GetProperties() FileProperties {
+	return FileProperties{
+		Encrypted:     b.Flag(LHD_PASSWORD),
+		Salt:          b.Flag(LHD_SALT),
+		Solid:         b.Flag(LHD_SOLID),
+		Directory:     b.Flags&LHD_WINDOWMASK == LHD_DIRECTORY,
+		DictSize:      b.GetDictSize(),
+		UnpackVersion: b.UnpackVersion,
+		Method:        b.Method,
+	}
+}
+
+// String lists the properties that are set, as "solid, locked".
+func (p ArchiveProperties) String() string {
+	s := make([]string, 0)
+	for _, v := range []struct {
+		set  bool
+		name string
+	}{
+		{p.Volume, "volume"},
+		{p.Solid, "solid"},
+		{p.Locked, "locked"},
+		{p.HasRecovery, "recovery record"},
+		{p.HasAuthInfo, "authenticity information"},
+		{p.HasComment, "comment"},
+		{p.EncryptedHeaders, "encrypted headers"},
+	} {
+		if v.set {
+			s = append(s, v.name)
+		}
+	}
+	return strings.Join(s, ", ")
+}
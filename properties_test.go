@@ -0,0 +1,83 @@
+package rescene
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"path/filepath"
+	"testing"
+)
+
+// rarFileHeadVersion returns a file header written by another RAR version
+// and method than rarFileHead's.
+func rarFileHeadVersion(flags RarHeaderFlag, unpackVersion, method uint8, subData []byte) []byte {
+	b := rarFileHead(FileHead, flags, "file.bin", 0, 0, 0, subData)
+	b[24], b[25] = unpackVersion, method
+	binary.LittleEndian.PutUint16(b, uint16(crc32.ChecksumIEEE(b[2:])))
+	return b
+}
+
+func TestProperties(t *testing.T) {
+	text := []byte("comment")
+	crc := crc32.ChecksumIEEE(text)
+	stored := rarFileHeadVersion(0, 29, 0x30, nil)
+	base := FileProperties{DictSize: 64, UnpackVersion: 29, Method: 0x30}
+	tests := []struct {
+		name    string
+		flags   RarHeaderFlag
+		blocks  [][]byte
+		archive ArchiveProperties
+		file    FileProperties
+		str     string
+	}{
+		{"stored", 0, [][]byte{stored}, ArchiveProperties{}, base, ""},
+		{"volume", MHD_VOLUME, [][]byte{stored}, ArchiveProperties{Volume: true}, base, "volume"},
+		{"solid", MHD_SOLID, [][]byte{stored}, ArchiveProperties{Solid: true}, base, "solid"},
+		{"locked", MHD_LOCK, [][]byte{stored}, ArchiveProperties{Locked: true}, base, "locked"},
+		{"main flags", MHD_VOLUME | MHD_SOLID | MHD_LOCK, [][]byte{stored},
+			ArchiveProperties{Volume: true, Solid: true, Locked: true}, base, "volume, solid, locked"},
+		{"RAR 2.x flags", MHD_PROTECT | MHD_AV | MHD_COMMENT, [][]byte{stored},
+			ArchiveProperties{HasRecovery: true, HasAuthInfo: true, HasComment: true}, base,
+			"recovery record, authenticity information, comment"},
+		{"RAR 2.x blocks", 0, [][]byte{stored, rarCommHead(text, uint16(crc)), rarBlock(AvHead, 0, make([]byte, 7))},
+			ArchiveProperties{HasAuthInfo: true, HasComment: true}, base, "authenticity information, comment"},
+		{"RAR 3.x service blocks", 0, [][]byte{
+			stored,
+			append(rarFileHead(NewSubHead, 0, "CMT", len(text), len(text), crc, nil), text...),
+			append(rarFileHead(NewSubHead, 0, "AV", len(text), len(text), crc, nil), text...),
+		}, ArchiveProperties{HasAuthInfo: true, HasComment: true}, base, "authenticity information, comment"},
+		{"encrypted headers", MHD_PASSWORD, nil, ArchiveProperties{EncryptedHeaders: true}, FileProperties{}, "encrypted headers"},
+		{"encrypted file", 0, [][]byte{rarFileHeadVersion(LHD_PASSWORD, 29, 0x33, nil)}, ArchiveProperties{},
+			FileProperties{Encrypted: true, DictSize: 64, UnpackVersion: 29, Method: 0x33}, ""},
+		{"encrypted file with salt", 0, [][]byte{rarFileHeadVersion(LHD_PASSWORD|LHD_SALT, 29, 0x33, make([]byte, 8))}, ArchiveProperties{},
+			FileProperties{Encrypted: true, Salt: true, DictSize: 64, UnpackVersion: 29, Method: 0x33}, ""},
+		{"solid file", 0, [][]byte{rarFileHeadVersion(LHD_SOLID|0x80, 29, 0x35, nil)}, ArchiveProperties{},
+			FileProperties{Solid: true, DictSize: 1024, UnpackVersion: 29, Method: 0x35}, ""},
+		{"RAR 1.5 file", 0, [][]byte{rarFileHeadVersion(0x80, 15, 0x33, nil)}, ArchiveProperties{},
+			FileProperties{DictSize: 64, UnpackVersion: 15, Method: 0x33}, ""},
+		{"directory", 0, [][]byte{rarFileHeadVersion(LHD_DIRECTORY, 20, 0x30, nil)}, ArchiveProperties{},
+			FileProperties{Directory: true, UnpackVersion: 20, Method: 0x30}, ""},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		v := rarMainHead(tt.flags)
+		for _, b := range tt.blocks {
+			v = append(v, b...)
+		}
+		v = append(v, rarEndArc(0)...)
+		writeTestFile(t, filepath.Join(dir, "test.rar"), v)
+		f := srrOf(t, dir, []string{"test.rar"}, CreateOptions{})
+		if got := f.RarFiles[0].Properties; got != tt.archive {
+			t.Errorf("%s: archive %+v, want %+v", tt.name, got, tt.archive)
+		}
+		if s := f.RarFiles[0].Properties.String(); s != tt.str {
+			t.Errorf("%s: %q, want %q", tt.name, s, tt.str)
+		}
+		var file FileProperties
+		if len(f.PackedFiles) > 0 {
+			file = f.PackedFiles[0].Properties
+		}
+		if file != tt.file {
+			t.Errorf("%s: file %+v, want %+v", tt.name, file, tt.file)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"strings"
+	"time"
 )
 
 type RarHeaderType byte
@@ -44,6 +45,8 @@ const (
 	LHD_PASSWORD       RarHeaderFlag = 0x0004
 	LHD_COMMENT        RarHeaderFlag = 0x0008
 	LHD_SOLID          RarHeaderFlag = 0x0010
+	LHD_WINDOWMASK     RarHeaderFlag = 0x00E0
+	LHD_DIRECTORY      RarHeaderFlag = 0x00E0
 	LHD_LARGE          RarHeaderFlag = 0x0100
 	LHD_UNICODE        RarHeaderFlag = 0x0200
 	LHD_SALT           RarHeaderFlag = 0x0400
@@ -54,6 +57,16 @@ const (
 	SRR_APP_NAME       RarHeaderFlag = 0x0001
 )
 
+// types of the RAR 2.x SubHead blocks
+const (
+	EA_HEAD     uint16 = 0x0100
+	UO_HEAD     uint16 = 0x0101
+	MAC_HEAD    uint16 = 0x0102
+	BEEA_HEAD   uint16 = 0x0103
+	NTACL_HEAD  uint16 = 0x0104
+	STREAM_HEAD uint16 = 0x0105
+)
+
 type RarHeader struct {
 	CRC   uint16
 	Type  RarHeaderType
@@ -101,6 +114,10 @@ type MarkHeadBlock struct {
 
 type MainHeadBlock struct {
 	RarHeader
+	HighPosAV  uint16
+	PosAV      uint32
+	EncryptVer uint8
+	Comment    *CommHeadBlock
 }
 
 type FileHeadBlock struct {
@@ -118,19 +135,39 @@ type FileHeadBlock struct {
 	HighUnpackSize  uint32
 	FileName        []byte
 	FileNameUnicode []byte
+	Comment         *CommHeadBlock
 	Salt            uint64
 }
 
 type CommHeadBlock struct {
 	RarHeader
+	UnpackSize    uint16
+	UnpackVersion uint8
+	Method        uint8
+	CommentCRC    uint16
+	Comment       []byte
 }
 
 type AvHeadBlock struct {
 	RarHeader
+	UnpackVersion uint8
+	Method        uint8
+	AVVersion     uint8
+	AVInfoCRC     uint32
+	AVInfo        []byte
 }
 
 type SubHeadBlock struct {
 	RarHeader
+	DataSize      uint32
+	SubType       uint16
+	Level         uint8
+	UnpackSize    uint32
+	UnpackVersion uint8
+	Method        uint8
+	DataCRC       uint32
+	StreamName    []byte
+	Data          []byte // nil when the SRR does not keep it
 }
 
 type ProtectHeadBlock struct {
@@ -159,6 +196,7 @@ type NewSubHeadBlock struct {
 	HighPackSize   uint32
 	HighUnpackSize uint32
 	FileName       []byte
+	SubData        []byte
 	Salt           uint64
 }
 
@@ -394,6 +432,15 @@ func (b *FileHeadBlock) Parse(data []byte) error {
 	if err != nil {
 		return err
 	}
+	if b.Flag(LHD_COMMENT) && int(b.Size) <= len(data) && int(b.Size)-(len(data)-buffer.Len()) >= 13 {
+		// RAR 1.5 to 2.x keep the file comment in the file header
+		comment, err := parseCommHead(data[len(data)-buffer.Len() : b.Size])
+		if err != nil {
+			return err
+		}
+		b.Comment = comment
+		buffer.Next(int(comment.Size))
+	}
 	if b.Flag(LHD_SALT) {
 		err = binary.Read(buffer, binary.LittleEndian, &b.Salt)
 		if err != nil {
@@ -443,6 +490,14 @@ func (b *FileHeadBlock) GetCRC() uint32 {
 	}
 }
 
+// GetFileTime returns the modification time of the file, kept in the DOS
+// format as local time.
+func (b *FileHeadBlock) GetFileTime() time.Time {
+	d, t := b.FileTime>>16, b.FileTime&0xffff
+	return time.Date(int(d>>9)+1980, time.Month(d>>5&15), int(d&31),
+		int(t>>11), int(t>>5&63), int(t&31)*2, 0, time.Local)
+}
+
 func (b *FileHeadBlock) UpdatePackedFile(p *PackedFile) error {
 	if p.Path == "" {
 		p.Path = b.GetFileName()
@@ -461,6 +516,18 @@ func (b *FileHeadBlock) UpdatePackedFile(p *PackedFile) error {
 	return nil
 }
 
+// GetDictSize returns the dictionary size in KB, 0 for directories. RAR
+// 1.5 always uses 64 KB.
+func (b *FileHeadBlock) GetDictSize() int {
+	if b.Flags&LHD_WINDOWMASK == LHD_DIRECTORY {
+		return 0
+	}
+	if b.UnpackVersion < 20 {
+		return 64
+	}
+	return 64 << uint((b.Flags&LHD_WINDOWMASK)>>5)
+}
+
 func (b *FileHeadBlock) GetSize() int {
 	return int(b.RarHeader.Size) + b.GetPackSize()
 }
@@ -526,6 +593,18 @@ func (b *NewSubHeadBlock) Parse(data []byte) error {
 	if err != nil {
 		return err
 	}
+	// the rest of the header up to the salt, the stream name of "STM"
+	n := int(b.Size) - (len(data) - 7 - buffer.Len()) - 7
+	if b.Flag(LHD_SALT) {
+		n -= 8
+	}
+	if n > 0 && n <= buffer.Len() {
+		b.SubData = make([]byte, n)
+		err = binary.Read(buffer, binary.LittleEndian, &b.SubData)
+		if err != nil {
+			return err
+		}
+	}
 
 	if b.Flag(LHD_SALT) {
 		err = binary.Read(buffer, binary.LittleEndian, &b.Salt)
@@ -552,10 +631,180 @@ func (b *NewSubHeadBlock) GetPackSize() int {
 	}
 }
 
+func (b *NewSubHeadBlock) GetUnpackSize() int {
+	if b.Flag(LHD_LARGE) {
+		return int(b.HighUnpackSize)<<32 + int(b.LowUnpackSize)
+	} else {
+		return int(b.LowUnpackSize)
+	}
+}
+
 func (b *NewSubHeadBlock) GetSize() int {
 	return int(b.RarHeader.Size) + b.GetPackSize()
 }
 
+func (b *MainHeadBlock) Parse(data []byte) error {
+	if int(b.Size) < 13 || len(data) < int(b.Size) {
+		return ErrBadBlock
+	}
+	buffer := bytes.NewBuffer(data[7:b.Size])
+	err := binary.Read(buffer, binary.LittleEndian, &b.HighPosAV)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buffer, binary.LittleEndian, &b.PosAV)
+	if err != nil {
+		return err
+	}
+	if b.Flag(MHD_ENCRYPTVER) {
+		err = binary.Read(buffer, binary.LittleEndian, &b.EncryptVer)
+		if err != nil {
+			return err
+		}
+	}
+	if b.Flag(MHD_COMMENT) && buffer.Len() >= 13 {
+		// RAR 1.5 to 2.x keep the archive comment in the main header,
+		// RAR 3.x in a "CMT" service block
+		b.Comment, err = parseCommHead(buffer.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseCommHead reads a comment block found inside another header.
+func parseCommHead(data []byte) (*CommHeadBlock, error) {
+	header := &RarHeader{}
+	if len(data) < 7 {
+		return nil, ErrBadBlock
+	}
+	if err := header.Parse(data); err != nil {
+		return nil, err
+	}
+	if header.Type != CommHead {
+		return nil, ErrBadBlock
+	}
+	block := &CommHeadBlock{RarHeader: *header}
+	if err := block.Parse(data); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func (b *AvHeadBlock) Parse(data []byte) error {
+	if int(b.Size) < 14 || len(data) < int(b.Size) {
+		return ErrBadBlock
+	}
+	buffer := bytes.NewBuffer(data[7:b.Size])
+	err := binary.Read(buffer, binary.LittleEndian, &b.UnpackVersion)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buffer, binary.LittleEndian, &b.Method)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buffer, binary.LittleEndian, &b.AVVersion)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buffer, binary.LittleEndian, &b.AVInfoCRC)
+	if err != nil {
+		return err
+	}
+	b.AVInfo = buffer.Bytes()
+	return nil
+}
+
+// Parse reads a RAR 2.x SubHead block. Its data follows the header, the
+// size being stored like the one of the blocks with HAS_DATA (LONG_BLOCK).
+func (b *SubHeadBlock) Parse(data []byte) error {
+	if int(b.Size) < 14 || len(data) < int(b.Size) {
+		return ErrBadBlock
+	}
+	buffer := bytes.NewBuffer(data[7:b.Size])
+	err := binary.Read(buffer, binary.LittleEndian, &b.DataSize)
+	if err != nil {
+		return err
+	}
+	if !b.Flag(HAS_DATA) {
+		b.DataSize = 0
+	}
+	err = binary.Read(buffer, binary.LittleEndian, &b.SubType)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buffer, binary.LittleEndian, &b.Level)
+	if err != nil {
+		return err
+	}
+	switch b.SubType {
+	case EA_HEAD, NTACL_HEAD, STREAM_HEAD:
+		err = binary.Read(buffer, binary.LittleEndian, &b.UnpackSize)
+		if err != nil {
+			return err
+		}
+		err = binary.Read(buffer, binary.LittleEndian, &b.UnpackVersion)
+		if err != nil {
+			return err
+		}
+		err = binary.Read(buffer, binary.LittleEndian, &b.Method)
+		if err != nil {
+			return err
+		}
+		err = binary.Read(buffer, binary.LittleEndian, &b.DataCRC)
+		if err != nil {
+			return err
+		}
+	}
+	if b.SubType == STREAM_HEAD {
+		var n uint16
+		err = binary.Read(buffer, binary.LittleEndian, &n)
+		if err != nil {
+			return err
+		}
+		b.StreamName = make([]byte, n)
+		err = binary.Read(buffer, binary.LittleEndian, &b.StreamName)
+		if err != nil {
+			return err
+		}
+	}
+	if end := int(b.Size) + int(b.DataSize); end <= len(data) {
+		b.Data = data[b.Size:end]
+	}
+	return nil
+}
+
+func (b *SubHeadBlock) GetSize() int {
+	return int(b.RarHeader.Size) + int(b.DataSize)
+}
+
+func (b *CommHeadBlock) Parse(data []byte) error {
+	if int(b.Size) < 13 || len(data) < int(b.Size) {
+		return ErrBadBlock
+	}
+	buffer := bytes.NewBuffer(data[7:b.Size])
+	err := binary.Read(buffer, binary.LittleEndian, &b.UnpackSize)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buffer, binary.LittleEndian, &b.UnpackVersion)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buffer, binary.LittleEndian, &b.Method)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buffer, binary.LittleEndian, &b.CommentCRC)
+	if err != nil {
+		return err
+	}
+	b.Comment = buffer.Bytes()
+	return nil
+}
+
 func (b *ProtectHeadBlock) Parse(data []byte) error {
 	if !b.Flag(HAS_DATA) {
 		return ErrBadBlock
@@ -0,0 +1,142 @@
+package rescene
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// rarBlock returns a RAR 1.5-4.x block of the given type, flags and body,
+// with its header CRC.
+func rarBlock(t RarHeaderType, flags RarHeaderFlag, body []byte) []byte {
+	b := make([]byte, 7, 7+len(body))
+	b[2] = byte(t)
+	binary.LittleEndian.PutUint16(b[3:], uint16(flags))
+	binary.LittleEndian.PutUint16(b[5:], uint16(7+len(body)))
+	b = append(b, body...)
+	binary.LittleEndian.PutUint16(b, uint16(crc32.ChecksumIEEE(b[2:])))
+	return b
+}
+
+func rarMainHead(flags RarHeaderFlag) []byte {
+	return append(append([]byte(nil), rarMarker...), rarBlock(MainHead, flags, make([]byte, 6))...)
+}
+
+// rarFileHead returns a stored (method 0x30) file header, or a service
+// header for NewSubHead, followed by nothing: the packed data is appended by
+// the caller.
+func rarFileHead(t RarHeaderType, flags RarHeaderFlag, name string, packSize, unpackSize int, crc uint32, subData []byte) []byte {
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, uint32(packSize))
+	binary.Write(&body, binary.LittleEndian, uint32(unpackSize))
+	body.WriteByte(2)
+	binary.Write(&body, binary.LittleEndian, crc)
+	binary.Write(&body, binary.LittleEndian, uint32(0x5a000000))
+	body.WriteByte(29)
+	body.WriteByte(0x30)
+	binary.Write(&body, binary.LittleEndian, uint16(len(name)))
+	binary.Write(&body, binary.LittleEndian, uint32(0x20))
+	body.WriteString(name)
+	body.Write(subData)
+	return rarBlock(t, flags|HAS_DATA, body.Bytes())
+}
+
+func rarEndArc(flags RarHeaderFlag) []byte {
+	return rarBlock(EndArcHead, flags, nil)
+}
+
+// rarSplit stores the files in a set of volumes of the old naming scheme,
+// one part of at most volSize bytes per volume, and returns the volume
+// names.
+func rarSplit(t *testing.T, dir, root string, volSize int, files map[string][]byte, order ...string) []string {
+	t.Helper()
+	type part struct {
+		name          string
+		data, chunk   []byte
+		before, after bool
+	}
+	parts := make([]part, 0)
+	for _, name := range order {
+		data := files[name]
+		for i := 0; i == 0 || i < len(data); i += volSize {
+			end := i + volSize
+			if end > len(data) {
+				end = len(data)
+			}
+			parts = append(parts, part{name, data, data[i:end], i > 0, end < len(data)})
+		}
+	}
+	names := make([]string, 0)
+	for i, p := range parts {
+		mflags := MHD_VOLUME | MHD_NEWNUMBERING
+		if i == 0 {
+			mflags |= MHD_FIRSTVOLUME
+		}
+		var flags RarHeaderFlag
+		if p.before {
+			flags |= LHD_SPLIT_BEFORE
+		}
+		crc := crc32.ChecksumIEEE(p.data)
+		if p.after {
+			flags |= LHD_SPLIT_AFTER
+			crc = crc32.ChecksumIEEE(p.chunk)
+		}
+		v := rarMainHead(mflags)
+		v = append(v, rarFileHead(FileHead, flags, p.name, len(p.chunk), len(p.data), crc, nil)...)
+		v = append(v, p.chunk...)
+		var eflags RarHeaderFlag
+		if i < len(parts)-1 {
+			eflags = 0x0001
+		}
+		v = append(v, rarEndArc(eflags)...)
+		name := root + ".rar"
+		if i > 0 {
+			name = root + ".r" + string('0'+byte((i-1)/10)) + string('0'+byte((i-1)%10))
+		}
+		writeTestFile(t, filepath.Join(dir, name), v)
+		names = append(names, name)
+	}
+	return names
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// srrOf creates and parses the SRR of the volumes found in dir.
+func srrOf(t *testing.T, dir string, volumes []string, opts CreateOptions) *SrrFile {
+	t.Helper()
+	paths := make([]string, len(volumes))
+	for i, v := range volumes {
+		paths[i] = filepath.Join(dir, v)
+	}
+	var buf bytes.Buffer
+	if err := CreateSrr(&buf, paths, opts); err != nil {
+		t.Fatal(err)
+	}
+	f := &SrrFile{}
+	if err := f.Unmarshal(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func testData(n int, seed byte) []byte {
+	b := make([]byte, n)
+	x := uint32(seed) + 1
+	for i := range b {
+		x = x*1664525 + 1013904223
+		b[i] = byte(x >> 24)
+	}
+	return b
+}
@@ -0,0 +1,277 @@
+package rescene
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// VolumeResult compares a rebuilt or existing RAR volume with what the SRR
+// expects. ExpectedCRC is 0 when the volume is not listed in a stored SFV.
+type VolumeResult struct {
+	Path         string
+	Size         int64
+	ExpectedSize int64
+	CRC          uint32
+	ExpectedCRC  uint32
+	Missing      bool
+}
+
+func (r *VolumeResult) OK() bool {
+	if r.Missing || r.Size != r.ExpectedSize {
+		return false
+	}
+	return r.ExpectedCRC == 0 || r.CRC == r.ExpectedCRC
+}
+
+// ReconstructOptions tells Reconstruct where to find the extracted files
+// (InputDir) and where to write the RAR volumes (OutputDir). Compressed
+// archives are only rebuilt when Registry lists RAR builds to recompress
+// the files with, working in TempDir (the system default when empty).
+type ReconstructOptions struct {
+	InputDir  string
+	OutputDir string
+	Registry  *RarRegistry
+	TempDir   string
+}
+
+// localPath returns the path under dir of a volume or packed file name taken
+// from the SRR, or ErrBadPath when the cleaned name is absolute or leads out
+// of dir.
+func localPath(dir, name string) (string, error) {
+	name = path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if !fs.ValidPath(name) || name == "." || strings.Contains(name, ":") {
+		return "", ErrBadPath
+	}
+	return filepath.Join(dir, filepath.FromSlash(name)), nil
+}
+
+// openPackedFile opens an extracted file, trying the archived path first and
+// its base name next.
+func openPackedFile(dir, name string) (*os.File, error) {
+	p, err := localPath(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := os.Open(p)
+	if err == nil || !os.IsNotExist(err) {
+		return r, err
+	}
+	r, err = os.Open(filepath.Join(dir, filepath.Base(p)))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return r, err
+}
+
+// Reconstruct rebuilds the RAR volumes of an SRR, using the headers kept in
+// the SRR and the file data found in InputDir. See ReconstructCompressed
+// for archives that are not stored.
+func (f *SrrFile) Reconstruct(opts ReconstructOptions) ([]*VolumeResult, error) {
+	if f.RarCompressed {
+		if opts.Registry == nil {
+			return nil, ErrCompressed
+		}
+		return f.ReconstructCompressed(opts)
+	}
+	return f.writeVolumes(opts, nil, func(name string) (*os.File, error) {
+		return openPackedFile(opts.InputDir, name)
+	})
+}
+
+// writeVolumes writes the RAR volumes to OutputDir, all of them or those in
+// volumes when not nil, reading the packed data of each file from what open
+// returns for its name.
+func (f *SrrFile) writeVolumes(opts ReconstructOptions, volumes map[*RarFile]bool, open func(name string) (*os.File, error)) ([]*VolumeResult, error) {
+	results := make([]*VolumeResult, 0)
+	var out *os.File
+	var crc = crc32.NewIEEE()
+	var current *VolumeResult
+	var w io.Writer
+	var src *os.File
+	srcName := ""
+
+	closeVolume := func() error {
+		if out == nil {
+			return nil
+		}
+		current.CRC = crc.Sum32()
+		err := out.Close()
+		out = nil
+		return err
+	}
+	defer func() {
+		if out != nil {
+			out.Close()
+		}
+		if src != nil {
+			src.Close()
+		}
+	}()
+
+	for _, block := range f.Blocks {
+		if block.Volume == nil || volumes != nil && !volumes[block.Volume] {
+			continue
+		}
+		switch h := block.Header.(type) {
+		case *SrrRarSubBlockHeadBlock:
+			if err := closeVolume(); err != nil {
+				return results, err
+			}
+			name := h.GetRarFileName()
+			current = &VolumeResult{
+				Path:         name,
+				ExpectedSize: int64(block.Volume.Size),
+				ExpectedCRC:  block.Volume.CRC,
+			}
+			results = append(results, current)
+			p, err := localPath(opts.OutputDir, name)
+			if err != nil {
+				return results, err
+			}
+			if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				return results, err
+			}
+			if out, err = os.OpenFile(p, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+				return results, err
+			}
+			crc.Reset()
+			w = io.MultiWriter(out, crc)
+		case *SrrRarPadHeadBlock:
+			if _, err := w.Write(h.PadData); err != nil {
+				return results, err
+			}
+			current.Size += int64(h.PadSize)
+		case *FileHeadBlock:
+			if _, err := w.Write(block.Raw); err != nil {
+				return results, err
+			}
+			current.Size += int64(len(block.Raw))
+			name := h.GetFileName()
+			if h.GetPackSize() == 0 {
+				continue
+			}
+			if !h.Flag(LHD_SPLIT_BEFORE) || src == nil || srcName != name {
+				if h.Flag(LHD_SPLIT_BEFORE) {
+					// the first part is not in this SRR
+					return results, ErrBadFile
+				}
+				if src != nil {
+					src.Close()
+					src = nil
+				}
+				var err error
+				if src, err = open(name); err != nil {
+					return results, err
+				}
+				srcName = name
+			}
+			n, err := io.CopyN(w, src, int64(h.GetPackSize()))
+			current.Size += n
+			if err != nil {
+				return results, err
+			}
+		case *NewSubHeadBlock:
+			offset := current.Size
+			if _, err := w.Write(block.Raw); err != nil {
+				return results, err
+			}
+			if h.GetFileName() == "RR" {
+				// recovery data is stripped from the SRR: compute it again
+				// from what was written before the block
+				rr, err := newSubRecoveryRecord(out, offset, h)
+				if err != nil {
+					return results, err
+				}
+				if _, err = w.Write(rr); err != nil {
+					return results, err
+				}
+			}
+			current.Size += int64(h.GetSize())
+		case *SubHeadBlock:
+			if h.Data == nil && h.DataSize > 0 {
+				// stripped from the SRR and not computed again
+				return results, ErrNoData
+			}
+			if _, err := w.Write(block.Raw); err != nil {
+				return results, err
+			}
+			current.Size += int64(len(block.Raw))
+		case *ProtectHeadBlock:
+			offset := current.Size
+			if _, err := w.Write(block.Raw); err != nil {
+				return results, err
+			}
+			rr, err := protectRecoveryRecord(out, offset, h)
+			if err != nil {
+				return results, err
+			}
+			if _, err = w.Write(rr); err != nil {
+				return results, err
+			}
+			current.Size += int64(h.GetSize())
+		default:
+			if _, err := w.Write(block.Raw); err != nil {
+				return results, err
+			}
+			current.Size += int64(len(block.Raw))
+		}
+	}
+	if err := closeVolume(); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+// Verify checks, in volume order, the RAR volumes found in dir against the sizes and SFV CRCs
+// recorded in the SRR.
+func (f *SrrFile) Verify(dir string) ([]*VolumeResult, error) {
+	results := make([]*VolumeResult, 0, len(f.RarFiles))
+	volumes := make([]*RarFile, 0, len(f.RarFiles))
+	for _, set := range f.ArchiveSets() {
+		volumes = append(volumes, set.Volumes...)
+	}
+	for _, v := range volumes {
+		r := &VolumeResult{
+			Path:         v.Path,
+			ExpectedSize: int64(v.Size),
+			ExpectedCRC:  v.CRC,
+		}
+		results = append(results, r)
+		file, err := openPackedFile(dir, v.Path)
+		if err == ErrNotFound {
+			r.Missing = true
+			continue
+		} else if err != nil {
+			return results, err
+		}
+		crc := crc32.NewIEEE()
+		r.Size, err = io.Copy(crc, file)
+		file.Close()
+		if err != nil {
+			return results, err
+		}
+		r.CRC = crc.Sum32()
+	}
+	return results, nil
+}
+
+// SFV returns an SFV listing the RAR volumes whose CRC is known.
+func (f *SrrFile) SFV() string {
+	var buf bytes.Buffer
+	for _, v := range f.SFVComments {
+		buf.WriteString(v + "\r\n")
+	}
+	for _, v := range f.RarFiles {
+		if v.CRC != 0 {
+			fmt.Fprintf(&buf, "%s %08x\r\n", filepath.Base(strings.ReplaceAll(v.Path, "\\", "/")), v.CRC)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,79 @@
+package rescene
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// srrWithVolume returns an SRR holding the headers of a single stored
+// volume under the given name.
+func srrWithVolume(t *testing.T, name string, data []byte) []byte {
+	t.Helper()
+	srr := rarBlock(SrrVolHead, 0, nil)
+	srr[0], srr[1] = 0x69, 0x69
+	body := make([]byte, 2, 2+len(name))
+	binary.LittleEndian.PutUint16(body, uint16(len(name)))
+	sub := rarBlock(SrrRarSubBlockHead, 0, append(body, name...))
+	sub[0], sub[1] = 0x71, 0x71
+	srr = append(srr, sub...)
+	srr = append(srr, rarMainHead(0)...)
+	srr = append(srr, rarFileHead(FileHead, 0, "file.bin", len(data), len(data), crc32.ChecksumIEEE(data), nil)...)
+	return append(srr, rarEndArc(0)...)
+}
+
+func TestReconstructPaths(t *testing.T) {
+	data := testData(100, 1)
+	tests := []struct {
+		name string
+		path string // where the volume is written, "" when rejected
+	}{
+		{"x.rar", "x.rar"},
+		{`Sub\x.rar`, "Sub/x.rar"},
+		{"Sub/../x.rar", "x.rar"},
+		{"../x.rar", ""},
+		{`..\..\x.rar`, ""},
+		{"Sub/../../x.rar", ""},
+		{"/x.rar", ""},
+		{`\x.rar`, ""},
+		{"C:x.rar", ""},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		in := filepath.Join(dir, "in")
+		out := filepath.Join(dir, "out", "rel")
+		writeTestFile(t, filepath.Join(in, "file.bin"), data)
+		f := &SrrFile{}
+		if err := f.Unmarshal(srrWithVolume(t, tt.name, data)); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		results, err := f.Reconstruct(ReconstructOptions{InputDir: in, OutputDir: out})
+		if tt.path == "" {
+			if err != ErrBadPath {
+				t.Errorf("%s: Reconstruct() = %v, want ErrBadPath", tt.name, err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "out", "x.rar")); err == nil {
+				t.Errorf("%s: written outside of the output directory", tt.name)
+			}
+			if _, err := f.Verify(out); err != ErrBadPath {
+				t.Errorf("%s: Verify() = %v, want ErrBadPath", tt.name, err)
+			}
+			continue
+		}
+		if err != nil || len(results) != 1 || !results[0].OK() {
+			t.Errorf("%s: Reconstruct() = %+v, %v", tt.name, results, err)
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(out, filepath.FromSlash(tt.path)))
+		if err != nil || !bytes.Contains(b, data) {
+			t.Errorf("%s: volume not written to %s: %v", tt.name, tt.path, err)
+		}
+		if v, err := f.Verify(out); err != nil || len(v) != 1 || !v[0].OK() {
+			t.Errorf("%s: Verify() = %+v, %v", tt.name, v, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package rescene
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+const rrSectorSize = 512
+
+var rrMark = []byte("Protect+")
+
+// recoveryRecord computes the data of a RAR 2.x/3.x recovery record over
+// the first dataSectors sectors read from r: the low 16 bits of the
+// inverted CRC32 of each sector, followed by recSectors parity sectors, data
+// sector i being XORed into parity sector i%recSectors.
+func recoveryRecord(r io.Reader, dataSectors, recSectors int) ([]byte, error) {
+	if dataSectors <= 0 || recSectors <= 0 {
+		return nil, ErrBadData
+	}
+	crcs := make([]byte, 2*dataSectors)
+	parity := make([]byte, rrSectorSize*recSectors)
+	sector := make([]byte, rrSectorSize)
+	for i := 0; i < dataSectors; i++ {
+		n, err := io.ReadFull(r, sector)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// the last sector is padded with zeros
+			for j := n; j < len(sector); j++ {
+				sector[j] = 0
+			}
+		} else if err != nil {
+			return nil, err
+		}
+		binary.LittleEndian.PutUint16(crcs[2*i:], uint16(^crc32.ChecksumIEEE(sector)))
+		p := parity[(i%recSectors)*rrSectorSize:]
+		for j, c := range sector {
+			p[j] ^= c
+		}
+	}
+	return append(crcs, parity...), nil
+}
+
+// rrSectors reads the sector counts of a RAR 3.x "RR" service block from
+// its SubData: "Protect+", the number of recovery sectors (32 bits) and the
+// number of data sectors (64 bits). The packed data must hold one CRC per
+// data sector and the parity sectors, nothing else.
+func rrSectors(h *NewSubHeadBlock) (dataSectors, recSectors int, err error) {
+	if len(h.SubData) < len(rrMark)+4+8 || !bytes.Equal(h.SubData[:len(rrMark)], rrMark) {
+		return 0, 0, ErrBadData
+	}
+	rs := binary.LittleEndian.Uint32(h.SubData[8:12])
+	ds := binary.LittleEndian.Uint64(h.SubData[12:20])
+	if ds == 0 || rs == 0 || 2*ds+rrSectorSize*uint64(rs) != uint64(h.GetPackSize()) {
+		return 0, 0, ErrBadData
+	}
+	return int(ds), int(rs), nil
+}
+
+// newSubRecoveryRecord returns the data of a RAR 3.x "RR" service block
+// placed at offset in the volume read by r.
+func newSubRecoveryRecord(r io.ReaderAt, offset int64, h *NewSubHeadBlock) ([]byte, error) {
+	ds, rs, err := rrSectors(h)
+	if err != nil {
+		return nil, err
+	}
+	return recoveryRecord(io.NewSectionReader(r, 0, offset), ds, rs)
+}
+
+// protectRecoveryRecord returns the data of a RAR 2.x protect block placed
+// at offset in the volume read by r.
+func protectRecoveryRecord(r io.ReaderAt, offset int64, b *ProtectHeadBlock) ([]byte, error) {
+	ds, rs := int(b.DataSectorCount), int(b.RecSectorCount)
+	if 2*ds+rrSectorSize*rs != int(b.PackedSize) {
+		return nil, ErrBadData
+	}
+	return recoveryRecord(io.NewSectionReader(r, 0, offset), ds, rs)
+}
@@ -0,0 +1,108 @@
+package rescene
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// rrData computes a RAR 3.x recovery record sector by sector: the low 16
+// bits of the inverted CRC32 of each data sector, then the XOR parity.
+func rrData(protected []byte, dataSectors, recSectors int) []byte {
+	crcs := make([]byte, 0, 2*dataSectors)
+	parity := make([]byte, 512*recSectors)
+	for i := 0; i < dataSectors; i++ {
+		sector := make([]byte, 512)
+		if i*512 < len(protected) {
+			copy(sector, protected[i*512:])
+		}
+		crcs = append(crcs, 0, 0)
+		binary.LittleEndian.PutUint16(crcs[2*i:], uint16(^crc32.ChecksumIEEE(sector)))
+		for j := range sector {
+			parity[(i%recSectors)*512+j] ^= sector[j]
+		}
+	}
+	return append(crcs, parity...)
+}
+
+// rrSubData returns the SubData of an "RR" service header.
+func rrSubData(recSectors, dataSectors int) []byte {
+	sub := make([]byte, len(rrMark)+4+8)
+	copy(sub, rrMark)
+	binary.LittleEndian.PutUint32(sub[8:], uint32(recSectors))
+	binary.LittleEndian.PutUint64(sub[12:], uint64(dataSectors))
+	return sub
+}
+
+// rarWithRR builds a single RAR 3.x volume storing data, protected by an
+// "RR" service block of recSectors recovery sectors.
+func rarWithRR(name string, data []byte, recSectors int) []byte {
+	v := rarMainHead(MHD_PROTECT)
+	v = append(v, rarFileHead(FileHead, 0, name, len(data), len(data), crc32.ChecksumIEEE(data), nil)...)
+	v = append(v, data...)
+	ds := (len(v) + 511) / 512
+	sub := rrSubData(recSectors, ds)
+	rr := rrData(v, ds, recSectors)
+	head := rarFileHead(NewSubHead, 0, "RR", len(rr), len(rr), 0, sub)
+	v = append(v, head...)
+	v = append(v, rr...)
+	return append(v, rarEndArc(0)...)
+}
+
+func TestReconstructRecoveryRecord(t *testing.T) {
+	dir := t.TempDir()
+	data := testData(3000, 1)
+	writeTestFile(t, filepath.Join(dir, "in", "file.bin"), data)
+	volume := rarWithRR("file.bin", data, 2)
+	writeTestFile(t, filepath.Join(dir, "rel", "test.rar"), volume)
+
+	f := srrOf(t, filepath.Join(dir, "rel"), []string{"test.rar"}, CreateOptions{})
+	results, err := f.Reconstruct(ReconstructOptions{
+		InputDir:  filepath.Join(dir, "in"),
+		OutputDir: filepath.Join(dir, "out"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d volumes, want 1", len(results))
+	}
+	if want := crc32.ChecksumIEEE(volume); results[0].CRC != want {
+		t.Errorf("CRC %08X, want %08X", results[0].CRC, want)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(dir, "out", "test.rar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, volume) {
+		t.Error("rebuilt volume differs")
+	}
+}
+
+func TestRRSectors(t *testing.T) {
+	sub := rrSubData(3, 10)
+	tests := []struct {
+		name     string
+		subData  []byte
+		packSize int
+		ok       bool
+	}{
+		{"valid", sub, 2*10 + 512*3, true},
+		{"pack size", sub, 2*10 + 512*3 + 1, false},
+		{"no subdata", nil, 2*10 + 512*3, false},
+		{"marker", append([]byte("Protect-"), sub[8:]...), 2*10 + 512*3, false},
+	}
+	for _, tt := range tests {
+		h := &NewSubHeadBlock{SubData: tt.subData}
+		h.LowPackSize = uint32(tt.packSize)
+		ds, rs, err := rrSectors(h)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err %v", tt.name, err)
+		} else if tt.ok && (ds != 10 || rs != 3) {
+			t.Errorf("%s: got %d/%d sectors, want 10/3", tt.name, ds, rs)
+		}
+	}
+}
@@ -0,0 +1,706 @@
+package rescene
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Flags of the SRSF and SRST blocks of an SRS.
+const (
+	SrsSimpleBlockFix     = 0x1
+	SrsAttachmentsRemoved = 0x2
+	SrsBigFile            = 0x4
+	SrsBigTrackNumber     = 0x8
+)
+
+// SrsFileData is the SRSF block of an SRS: the sample it was made from.
+type SrsFileData struct {
+	Flags      uint16
+	AppName    string
+	SampleName string
+	Size       uint64
+	CRC        uint32
+}
+
+// SrsTrackData is an SRST block of an SRS: a track of the sample, whose data
+// was stripped from the SRS. It starts at MatchOffset in the main file with
+// the bytes of Signature.
+type SrsTrackData struct {
+	Flags       uint16
+	Track       uint32
+	DataLength  uint64
+	MatchOffset uint64
+	Signature   []byte
+}
+
+func parseSrsFileData(b []byte) (*SrsFileData, error) {
+	if len(b) < 4 {
+		return nil, ErrBadData
+	}
+	d := &SrsFileData{Flags: binary.LittleEndian.Uint16(b)}
+	n := int(binary.LittleEndian.Uint16(b[2:]))
+	if len(b) < 4+n+2 {
+		return nil, ErrBadData
+	}
+	d.AppName = string(b[4 : 4+n])
+	b = b[4+n:]
+	n = int(binary.LittleEndian.Uint16(b))
+	if len(b) < 2+n+12 {
+		return nil, ErrBadData
+	}
+	d.SampleName = string(b[2 : 2+n])
+	b = b[2+n:]
+	d.Size = binary.LittleEndian.Uint64(b)
+	d.CRC = binary.LittleEndian.Uint32(b[8:])
+	return d, nil
+}
+
+func parseSrsTrackData(b []byte) (*SrsTrackData, error) {
+	if len(b) < 4 {
+		return nil, ErrBadData
+	}
+	t := &SrsTrackData{Flags: binary.LittleEndian.Uint16(b)}
+	i := 2
+	if t.Flags&SrsBigTrackNumber != 0 {
+		if len(b) < i+4 {
+			return nil, ErrBadData
+		}
+		t.Track = binary.LittleEndian.Uint32(b[i:])
+		i += 4
+	} else {
+		t.Track = uint32(binary.LittleEndian.Uint16(b[i:]))
+		i += 2
+	}
+	if t.Flags&SrsBigFile != 0 {
+		if len(b) < i+8 {
+			return nil, ErrBadData
+		}
+		t.DataLength = binary.LittleEndian.Uint64(b[i:])
+		i += 8
+	} else {
+		if len(b) < i+4 {
+			return nil, ErrBadData
+		}
+		t.DataLength = uint64(binary.LittleEndian.Uint32(b[i:]))
+		i += 4
+	}
+	if len(b) < i+10 {
+		return nil, ErrBadData
+	}
+	t.MatchOffset = binary.LittleEndian.Uint64(b[i:])
+	n := int(binary.LittleEndian.Uint16(b[i+8:]))
+	i += 10
+	if len(b) < i+n {
+		return nil, ErrBadData
+	}
+	t.Signature = b[i : i+n]
+	return t, nil
+}
+
+// sampleTrack is the data of a track, read from the main file.
+type sampleTrack struct {
+	*SrsTrackData
+	data []byte
+	pos  int
+}
+
+// fill appends up to n bytes read at offset, stopping at DataLength.
+func (t *sampleTrack) fill(r io.ReaderAt, offset, n int64) error {
+	if rest := int64(t.DataLength) - int64(len(t.data)); n > rest {
+		n = rest
+	}
+	if n <= 0 {
+		return nil
+	}
+	start := len(t.data)
+	t.data = append(t.data, make([]byte, n)...)
+	if _, err := r.ReadAt(t.data[start:], offset); err != nil {
+		t.data = t.data[:start]
+		if err == io.EOF {
+			return ErrBadData
+		}
+		return err
+	}
+	return nil
+}
+
+// sampleState is what the rebuild of a sample works with: the SRSF and
+// SRST blocks found in the SRS and the track data read from the main file.
+type sampleState struct {
+	format *sampleFormat
+	file   *SrsFileData
+	tracks map[uint32]*sampleTrack
+}
+
+func (s *sampleState) meta(kind string, b []byte) error {
+	switch kind {
+	case "SRSF":
+		d, err := parseSrsFileData(b)
+		if err != nil {
+			return err
+		}
+		s.file = d
+	case "SRST":
+		t, err := parseSrsTrackData(b)
+		if err != nil {
+			return err
+		}
+		s.tracks[t.Track] = &sampleTrack{SrsTrackData: t}
+	}
+	return nil
+}
+
+// track returns the track to read data for from the main file at offset,
+// or nil.
+func (s *sampleState) track(n uint32, offset int64) *sampleTrack {
+	t := s.tracks[n]
+	if t == nil || offset < int64(t.MatchOffset) || uint64(len(t.data)) >= t.DataLength {
+		return nil
+	}
+	return t
+}
+
+func (s *sampleState) complete() bool {
+	for _, t := range s.tracks {
+		if uint64(len(t.data)) < t.DataLength {
+			return false
+		}
+	}
+	return true
+}
+
+// copy writes b to w, doing nothing on the pass that only reads the SRSF
+// and SRST blocks (w is nil).
+func (s *sampleState) copy(w io.Writer, b []byte) error {
+	if w == nil {
+		return nil
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// stripped writes the next n bytes of the data of a track in place of what
+// was stripped from the SRS.
+func (s *sampleState) stripped(w io.Writer, track uint32, n int64) error {
+	if w == nil {
+		return nil
+	}
+	t := s.tracks[track]
+	if t == nil || n < 0 || int64(t.pos)+n > int64(len(t.data)) {
+		return ErrBadData
+	}
+	if _, err := w.Write(t.data[t.pos : t.pos+int(n)]); err != nil {
+		return err
+	}
+	t.pos += int(n)
+	return nil
+}
+
+// sampleFormat walks the SRS of a container format: meta reads its SRSF
+// and SRST blocks, extract the data of the tracks from the main file and
+// rebuild writes the sample.
+type sampleFormat struct {
+	meta    func(b []byte, s *sampleState) error
+	extract func(r io.ReaderAt, size int64, s *sampleState) error
+	rebuild func(b []byte, w io.Writer, s *sampleState) error
+}
+
+var (
+	aviSample = &sampleFormat{
+		meta:    func(b []byte, s *sampleState) error { return rebuildAvi(b, nil, s) },
+		extract: extractAvi,
+		rebuild: rebuildAvi,
+	}
+	mkvSample = &sampleFormat{
+		meta:    mkvMeta,
+		extract: extractMkv,
+		rebuild: rebuildMkv,
+	}
+	streamSample = &sampleFormat{
+		meta:    func(b []byte, s *sampleState) error { return rebuildStream(b, nil, s) },
+		extract: extractStream,
+		rebuild: rebuildStream,
+	}
+)
+
+func sampleFormatOf(b []byte) *sampleFormat {
+	switch {
+	case len(b) >= 12 && string(b[:4]) == "RIFF":
+		return aviSample
+	case len(b) >= 4 && binary.BigEndian.Uint32(b) == ebmlHeader:
+		return mkvSample
+	case len(b) >= 3 && string(b[:3]) == "ID3", SrsMatcher(b):
+		return streamSample
+	}
+	return nil
+}
+
+// SampleInfo returns the SRSF and SRST blocks of an AVI, MKV or MP3 SRS.
+func SampleInfo(srs []byte) (*SrsFileData, []*SrsTrackData, error) {
+	s, err := sampleMeta(srs)
+	if err != nil {
+		return nil, nil, err
+	}
+	tracks := make([]*SrsTrackData, 0, len(s.tracks))
+	for _, t := range s.tracks {
+		tracks = append(tracks, t.SrsTrackData)
+	}
+	sort.Slice(tracks, func(i, j int) bool { return tracks[i].Track < tracks[j].Track })
+	return s.file, tracks, nil
+}
+
+func sampleMeta(srs []byte) (*sampleState, error) {
+	format := sampleFormatOf(srs)
+	if format == nil {
+		return nil, ErrUnsupported
+	}
+	s := &sampleState{format: format, tracks: make(map[uint32]*sampleTrack)}
+	if err := format.meta(srs, s); err != nil {
+		return nil, err
+	}
+	if s.file == nil || len(s.tracks) == 0 {
+		return nil, ErrBadData
+	}
+	return s, nil
+}
+
+// ReconstructSample rebuilds the sample an SRS was made from, reading the
+// stripped track data from movie, the main file of the release, and writes
+// it to outputDir under its original name. AVI, MKV and MP3 samples are
+// supported; other formats return ErrUnsupported. ErrBadData is returned
+// when movie does not hold the data of the sample.
+func ReconstructSample(srs []byte, movie, outputDir string) (*VolumeResult, error) {
+	s, err := sampleMeta(srs)
+	if err != nil {
+		return nil, err
+	}
+	format := s.format
+	if s.file.Flags&SrsAttachmentsRemoved != 0 && format == mkvSample {
+		return nil, ErrUnsupported
+	}
+
+	in, err := os.Open(movie)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if err = format.extract(in, fi.Size(), s); err != nil {
+		return nil, err
+	}
+	for _, t := range s.tracks {
+		if uint64(len(t.data)) != t.DataLength || !bytes.HasPrefix(t.data, t.Signature) {
+			return nil, ErrBadData
+		}
+	}
+
+	result := &VolumeResult{
+		Path:         filepath.Base(filepath.FromSlash(s.file.SampleName)),
+		ExpectedSize: int64(s.file.Size),
+		ExpectedCRC:  s.file.CRC,
+	}
+	out, err := os.Create(filepath.Join(outputDir, result.Path))
+	if err != nil {
+		return nil, err
+	}
+	crc := crc32.NewIEEE()
+	cw := &countWriter{w: io.MultiWriter(out, crc)}
+	err = format.rebuild(srs, cw, s)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Size = cw.n
+	result.CRC = crc.Sum32()
+	return result, nil
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// aviStream returns the stream number of a movi data chunk ("00dc",
+// "01wb"...).
+func aviStream(id []byte) (uint32, bool) {
+	if id[0] < '0' || id[0] > '9' || id[1] < '0' || id[1] > '9' {
+		return 0, false
+	}
+	return uint32(id[0]-'0')*10 + uint32(id[1]-'0'), true
+}
+
+// rebuildAvi walks the chunks of an AVI SRS, lists being entered. The
+// data chunks of the streams keep their header only.
+func rebuildAvi(b []byte, w io.Writer, s *sampleState) error {
+	for pos := 0; pos < len(b); {
+		if len(b)-pos < 8 {
+			return s.copy(w, b[pos:])
+		}
+		id := b[pos : pos+4]
+		size := int64(binary.LittleEndian.Uint32(b[pos+4:]))
+		switch stream, data := aviStream(id); {
+		case string(id) == "RIFF" || string(id) == "LIST":
+			if len(b)-pos < 12 {
+				return ErrBadData
+			}
+			if err := s.copy(w, b[pos:pos+12]); err != nil {
+				return err
+			}
+			pos += 12
+		case string(id) == "SRSF" || string(id) == "SRST":
+			end := int64(pos) + 8 + size
+			if end > int64(len(b)) {
+				return ErrBadData
+			}
+			if w == nil {
+				if err := s.meta(string(id), b[pos+8:end]); err != nil {
+					return err
+				}
+			}
+			pos = int(end + size&1)
+		case data:
+			if err := s.copy(w, b[pos:pos+8]); err != nil {
+				return err
+			}
+			if err := s.stripped(w, stream, size); err != nil {
+				return err
+			}
+			if size&1 != 0 {
+				if err := s.copy(w, []byte{0}); err != nil {
+					return err
+				}
+			}
+			pos += 8
+		default:
+			end := int64(pos) + 8 + size + size&1
+			if end > int64(len(b)) {
+				end = int64(len(b))
+			}
+			if err := s.copy(w, b[pos:end]); err != nil {
+				return err
+			}
+			pos = int(end)
+		}
+	}
+	return nil
+}
+
+func extractAvi(r io.ReaderAt, size int64, s *sampleState) error {
+	h := make([]byte, 8)
+	for pos := int64(0); pos+8 <= size && !s.complete(); {
+		if _, err := r.ReadAt(h, pos); err != nil {
+			return err
+		}
+		n := int64(binary.LittleEndian.Uint32(h[4:]))
+		if string(h[:4]) == "RIFF" || string(h[:4]) == "LIST" {
+			pos += 12
+			continue
+		}
+		if stream, ok := aviStream(h); ok {
+			if t := s.track(stream, pos+8); t != nil {
+				if err := t.fill(r, pos+8, n); err != nil {
+					return err
+				}
+			}
+		}
+		pos += 8 + n + n&1
+	}
+	return nil
+}
+
+// Matroska element IDs used by the sample rebuild.
+const (
+	ebmlHeader          = 0x1A45DFA3
+	mkvSegment          = 0x18538067
+	mkvCluster          = 0x1F43B675
+	mkvBlockGroup       = 0xA0
+	mkvBlock            = 0xA1
+	mkvSimpleBlock      = 0xA3
+	mkvAttachments      = 0x1941A469
+	mkvAttachedFile     = 0x61A7
+	mkvResample         = 0x1F697576
+	mkvResampleFile     = 0x6A75
+	mkvResampleTrack    = 0x6B75
+	ebmlUnknownSize     = -1
+	ebmlMaxHeaderLength = 12
+)
+
+// ebmlVint returns the value of the variable size integer at the start of
+// b, with its length marker kept when id is true, and its length.
+func ebmlVint(b []byte, id bool) (uint64, int, error) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, ErrBadData
+	}
+	n := 1
+	for b[0]&(0x80>>uint(n-1)) == 0 {
+		n++
+	}
+	if len(b) < n || (id && n > 4) {
+		return 0, 0, ErrBadData
+	}
+	v := uint64(b[0])
+	if !id {
+		v &= 0xFF >> uint(n)
+	}
+	for _, c := range b[1:n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, n, nil
+}
+
+// ebmlElement reads the ID and the data size of the element at the start of
+// b and returns them with the length of the element header. The size is
+// ebmlUnknownSize when all its bits are set.
+func ebmlElement(b []byte) (id uint32, size int64, n int, err error) {
+	v, l, err := ebmlVint(b, true)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	s, m, err := ebmlVint(b[l:], false)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	size = int64(s)
+	if s == 1<<uint(7*m)-1 {
+		size = ebmlUnknownSize
+	}
+	return uint32(v), size, l + m, nil
+}
+
+// mkvBlockHeader returns the track number of a Block or SimpleBlock and the
+// length of its header: track number, timecode, flags and, when lacing is
+// read, the lace sizes.
+func mkvBlockHeader(b []byte, lacing bool) (track uint32, n int, err error) {
+	t, n, err := ebmlVint(b, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	n += 3
+	if len(b) < n {
+		return 0, 0, ErrBadData
+	}
+	flags := b[n-1]
+	if !lacing || flags&0x06 == 0 {
+		return uint32(t), n, nil
+	}
+	if len(b) < n+1 {
+		return 0, 0, ErrBadData
+	}
+	frames := int(b[n]) + 1
+	n++
+	switch flags & 0x06 {
+	case 0x02:
+		// Xiph lacing
+		for i := 0; i < frames-1; i++ {
+			for {
+				if len(b) <= n {
+					return 0, 0, ErrBadData
+				}
+				n++
+				if b[n-1] != 0xFF {
+					break
+				}
+			}
+		}
+	case 0x06:
+		// EBML lacing
+		for i := 0; i < frames-1; i++ {
+			_, l, err := ebmlVint(b[n:], false)
+			if err != nil {
+				return 0, 0, err
+			}
+			n += l
+		}
+	}
+	return uint32(t), n, nil
+}
+
+// mkvLacing tells whether the lace sizes of a block are part of its header.
+// SRS files made before the SimpleBlock fix stripped them with the frames.
+func (s *sampleState) mkvLacing(id uint32) bool {
+	return id == mkvBlock || s.file.Flags&SrsSimpleBlockFix != 0
+}
+
+// mkvMeta reads the ReSample element of an MKV SRS.
+func mkvMeta(b []byte, s *sampleState) error {
+	mark := []byte{0x1F, 0x69, 0x75, 0x76}
+	i := bytes.Index(b, mark)
+	if i < 0 {
+		return ErrBadData
+	}
+	_, size, n, err := ebmlElement(b[i:])
+	if err != nil || size < 0 || int64(i+n)+size > int64(len(b)) {
+		return ErrBadData
+	}
+	children := b[i+n : int64(i+n)+size]
+	for len(children) > 0 {
+		id, size, n, err := ebmlElement(children)
+		if err != nil || size < 0 || int64(n)+size > int64(len(children)) {
+			return ErrBadData
+		}
+		switch id {
+		case mkvResampleFile:
+			err = s.meta("SRSF", children[n:int64(n)+size])
+		case mkvResampleTrack:
+			err = s.meta("SRST", children[n:int64(n)+size])
+		}
+		if err != nil {
+			return err
+		}
+		children = children[int64(n)+size:]
+	}
+	return nil
+}
+
+// rebuildMkv walks the elements of an MKV SRS, the segment, clusters and
+// block groups being entered. Blocks keep their header only; the ReSample
+// element is left out.
+func rebuildMkv(b []byte, w io.Writer, s *sampleState) error {
+	for pos := 0; pos < len(b); {
+		id, size, n, err := ebmlElement(b[pos:])
+		if err != nil {
+			return err
+		}
+		switch id {
+		case mkvSegment, mkvCluster, mkvBlockGroup, mkvAttachments, mkvAttachedFile:
+			if err = s.copy(w, b[pos:pos+n]); err != nil {
+				return err
+			}
+			pos += n
+			continue
+		case mkvBlock, mkvSimpleBlock:
+			track, hl, err := mkvBlockHeader(b[pos+n:], s.mkvLacing(id))
+			if err != nil || size < int64(hl) {
+				return ErrBadData
+			}
+			if err = s.copy(w, b[pos:pos+n+hl]); err != nil {
+				return err
+			}
+			if err = s.stripped(w, track, size-int64(hl)); err != nil {
+				return err
+			}
+			pos += n + hl
+			continue
+		}
+		if size < 0 || int64(pos+n)+size > int64(len(b)) {
+			return ErrBadData
+		}
+		end := pos + n + int(size)
+		if id != mkvResample {
+			if err = s.copy(w, b[pos:end]); err != nil {
+				return err
+			}
+		}
+		pos = end
+	}
+	return nil
+}
+
+func extractMkv(r io.ReaderAt, size int64, s *sampleState) error {
+	h := make([]byte, ebmlMaxHeaderLength)
+	for pos := int64(0); pos < size && !s.complete(); {
+		m, err := r.ReadAt(h, pos)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		id, n64, n, err := ebmlElement(h[:m])
+		if err != nil {
+			return err
+		}
+		switch id {
+		case mkvSegment, mkvCluster, mkvBlockGroup:
+			pos += int64(n)
+			continue
+		}
+		if n64 < 0 {
+			return ErrBadData
+		}
+		if id == mkvBlock || id == mkvSimpleBlock {
+			hb := make([]byte, n64)
+			if n64 > 65536 {
+				hb = hb[:65536]
+			}
+			if _, err := r.ReadAt(hb, pos+int64(n)); err != nil {
+				return err
+			}
+			track, hl, err := mkvBlockHeader(hb, s.mkvLacing(id))
+			if err != nil {
+				return err
+			}
+			start := pos + int64(n+hl)
+			if t := s.track(track, start); t != nil {
+				if err := t.fill(r, start, n64-int64(hl)); err != nil {
+					return err
+				}
+			}
+		}
+		pos += int64(n) + n64
+	}
+	return nil
+}
+
+// rebuildStream writes an MP3 SRS: an optional ID3v2 tag, the SRS blocks,
+// in place of which the audio goes, and the tags that followed the audio.
+// SRSP blocks, the audio fingerprint, are left out.
+func rebuildStream(b []byte, w io.Writer, s *sampleState) error {
+	pos := 0
+	if len(b) >= 10 && string(b[:3]) == "ID3" {
+		pos = 10 + (int(b[6]&0x7F)<<21 | int(b[7]&0x7F)<<14 | int(b[8]&0x7F)<<7 | int(b[9]&0x7F))
+		if b[5]&0x10 != 0 {
+			pos += 10
+		}
+		if pos > len(b) {
+			return ErrBadData
+		}
+		if err := s.copy(w, b[:pos]); err != nil {
+			return err
+		}
+	}
+	for len(b)-pos >= 8 && SrsMatcher(b[pos:]) {
+		kind := string(b[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(b[pos+4:]))
+		if size < 8 || pos+size > len(b) {
+			return ErrBadData
+		}
+		if w == nil {
+			if err := s.meta(kind, b[pos+8:pos+size]); err != nil {
+				return err
+			}
+		} else if kind == "SRST" {
+			t, err := parseSrsTrackData(b[pos+8 : pos+size])
+			if err != nil {
+				return err
+			}
+			if err = s.stripped(w, t.Track, int64(t.DataLength)); err != nil {
+				return err
+			}
+		}
+		pos += size
+	}
+	return s.copy(w, b[pos:])
+}
+
+func extractStream(r io.ReaderAt, size int64, s *sampleState) error {
+	for _, t := range s.tracks {
+		if err := t.fill(r, int64(t.MatchOffset), int64(t.DataLength)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
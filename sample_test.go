@@ -0,0 +1,255 @@
+package rescene
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func srsFileData(flags uint16, name string, sample []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, flags)
+	binary.Write(&b, binary.LittleEndian, uint16(len("test")))
+	b.WriteString("test")
+	binary.Write(&b, binary.LittleEndian, uint16(len(name)))
+	b.WriteString(name)
+	binary.Write(&b, binary.LittleEndian, uint64(len(sample)))
+	binary.Write(&b, binary.LittleEndian, crc32.ChecksumIEEE(sample))
+	return b.Bytes()
+}
+
+func srsTrackData(track uint16, data []byte, offset int) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint16(0))
+	binary.Write(&b, binary.LittleEndian, track)
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	binary.Write(&b, binary.LittleEndian, uint64(offset))
+	sig := data
+	if len(sig) > 32 {
+		sig = sig[:32]
+	}
+	binary.Write(&b, binary.LittleEndian, uint16(len(sig)))
+	b.Write(sig)
+	return b.Bytes()
+}
+
+// checkSample writes the SRS and the main file, rebuilds the sample and
+// compares it with the expected one.
+func checkSample(t *testing.T, srs, main, sample []byte, name string) {
+	t.Helper()
+	dir := t.TempDir()
+	movie := filepath.Join(dir, "movie")
+	writeTestFile(t, movie, main)
+	r, err := ReconstructSample(srs, movie, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Path != name || !r.OK() {
+		t.Errorf("result %+v", r)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, sample) {
+		t.Errorf("rebuilt sample differs")
+	}
+}
+
+func TestReconstructSampleStream(t *testing.T) {
+	audio := testData(5000, 2)
+	main := append([]byte("head"), audio...)
+	tag := append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 20}, testData(20, 3)...)
+	tail := append([]byte("TAG"), make([]byte, 125)...)
+	sample := append(append(append([]byte(nil), tag...), audio[1000:3000]...), tail...)
+
+	block := func(kind string, data []byte) []byte {
+		b := []byte(kind)
+		b = append(b, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(b[4:], uint32(8+len(data)))
+		return append(b, data...)
+	}
+	srs := append([]byte(nil), tag...)
+	srs = append(srs, block("SRSF", srsFileData(0, "sample.mp3", sample))...)
+	srs = append(srs, block("SRST", srsTrackData(1, audio[1000:3000], 4+1000))...)
+	srs = append(srs, block("SRSP", []byte("fingerprint"))...)
+	srs = append(srs, tail...)
+	checkSample(t, srs, main, sample, "sample.mp3")
+}
+
+func aviChunk(id string, data []byte) []byte {
+	b := append([]byte(id), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(data)))
+	b = append(b, data...)
+	if len(data)%2 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func aviList(id, form string, children ...[]byte) []byte {
+	data := []byte(form)
+	for _, c := range children {
+		data = append(data, c...)
+	}
+	return aviChunk(id, data)
+}
+
+func TestReconstructSampleAvi(t *testing.T) {
+	hdrl := aviList("LIST", "hdrl", aviChunk("avih", testData(56, 4)))
+	type frame struct {
+		id   string
+		data []byte
+	}
+	frames := make([]frame, 0)
+	for i := 0; i < 12; i++ {
+		frames = append(frames, frame{"00dc", testData(100+i*7, byte(i))})
+		frames = append(frames, frame{"01wb", testData(31+i, byte(i+50))})
+	}
+	chunks := func(fs []frame) [][]byte {
+		c := make([][]byte, len(fs))
+		for i, f := range fs {
+			c[i] = aviChunk(f.id, f.data)
+		}
+		return c
+	}
+	main := aviList("RIFF", "AVI ", hdrl, aviList("LIST", "movi", chunks(frames)...), aviChunk("idx1", testData(64, 9)))
+	part := frames[6:14]
+	sample := aviList("RIFF", "AVI ", hdrl, aviList("LIST", "movi", chunks(part)...), aviChunk("idx1", testData(16, 9)))
+
+	// the data of each stream, as found in the sample
+	var video, audio []byte
+	for _, f := range part {
+		if f.id == "00dc" {
+			video = append(video, f.data...)
+		} else {
+			audio = append(audio, f.data...)
+		}
+	}
+	offset := func(data []byte) int {
+		return bytes.Index(main, data[:32])
+	}
+
+	srs := append([]byte(nil), sample[:12]...)
+	srs = append(srs, aviChunk("SRSF", srsFileData(0, "sample.avi", sample))...)
+	srs = append(srs, aviChunk("SRST", srsTrackData(0, video, offset(video)))...)
+	srs = append(srs, aviChunk("SRST", srsTrackData(1, audio, offset(audio)))...)
+	srs = append(srs, hdrl...)
+	srs = append(srs, sample[12+len(hdrl):12+len(hdrl)+12]...)
+	for _, c := range chunks(part) {
+		srs = append(srs, c[:8]...)
+	}
+	srs = append(srs, aviChunk("idx1", testData(16, 9))...)
+	checkSample(t, srs, main, sample, "sample.avi")
+}
+
+func ebml(id uint32, data []byte) []byte {
+	var b []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if c := byte(id >> uint(shift)); c != 0 || len(b) > 0 {
+			b = append(b, c)
+		}
+	}
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(data)))
+	size[0] = 0x01
+	return append(append(b, size...), data...)
+}
+
+// ebmlHead returns the header of a master element of unknown size.
+func ebmlHead(id uint32) []byte {
+	b := ebml(id, nil)
+	for i := len(b) - 7; i < len(b); i++ {
+		b[i] = 0xFF
+	}
+	return b
+}
+
+func TestReconstructSampleMkv(t *testing.T) {
+	type block struct {
+		id     uint32
+		header []byte
+		data   []byte
+	}
+	blocks := make([]block, 0)
+	for i := 0; i < 10; i++ {
+		blocks = append(blocks, block{mkvSimpleBlock, []byte{0x81, 0, byte(i), 0x80}, testData(300+i, byte(i))})
+		// two Xiph laced frames of the second track
+		blocks = append(blocks, block{mkvSimpleBlock, []byte{0x82, 0, byte(i), 0x82, 1, 40}, testData(90, byte(i+20))})
+		blocks = append(blocks, block{mkvBlock, []byte{0x82, 0, byte(i), 0x00}, testData(10, byte(i+40))})
+	}
+	cluster := func(bs []block, stripped bool) []byte {
+		c := ebml(0xE7, []byte{1})
+		for _, b := range bs {
+			content := append(append([]byte(nil), b.header...), b.data...)
+			e := ebml(b.id, content)
+			if b.id == mkvBlock {
+				e = ebml(mkvBlockGroup, e)
+			}
+			if stripped {
+				// element headers keep their sizes, the frames go
+				e = e[:len(e)-len(b.data)]
+			}
+			c = append(c, e...)
+		}
+		return c
+	}
+	head := ebml(ebmlHeader, testData(20, 7))
+	var main []byte
+	main = append(main, head...)
+	main = append(main, ebmlHead(mkvSegment)...)
+	main = append(main, ebml(mkvCluster, cluster(blocks[:12], false))...)
+	main = append(main, ebml(mkvCluster, cluster(blocks[12:], false))...)
+
+	part := blocks[12:]
+	body := cluster(part, false)
+	var sample []byte
+	sample = append(sample, head...)
+	sample = append(sample, ebmlHead(mkvSegment)...)
+	sample = append(sample, ebml(mkvCluster, body)...)
+
+	tracks := map[byte][]byte{}
+	for _, b := range part {
+		tracks[b.header[0]] = append(tracks[b.header[0]], b.data...)
+	}
+	offset := func(data []byte) int {
+		return bytes.Index(main, data[:32])
+	}
+	resample := ebml(mkvResampleFile, srsFileData(SrsSimpleBlockFix, "sample.mkv", sample))
+	resample = append(resample, ebml(mkvResampleTrack, srsTrackData(1, tracks[0x81], offset(tracks[0x81])))...)
+	resample = append(resample, ebml(mkvResampleTrack, srsTrackData(2, tracks[0x82], offset(tracks[0x82])))...)
+
+	var srs []byte
+	srs = append(srs, head...)
+	srs = append(srs, ebml(mkvResample, resample)...)
+	srs = append(srs, ebmlHead(mkvSegment)...)
+	srs = append(srs, ebml(mkvCluster, body)[:4+8]...)
+	srs = append(srs, cluster(part, true)...)
+	checkSample(t, srs, main, sample, "sample.mkv")
+}
+
+func TestReconstructSampleWrongMovie(t *testing.T) {
+	audio := testData(3000, 2)
+	sample := audio[1000:2000]
+	srs := []byte("SRSF\x00\x00\x00\x00")
+	fd := srsFileData(0, "s.mp3", sample)
+	binary.LittleEndian.PutUint32(srs[4:], uint32(8+len(fd)))
+	srs = append(srs, fd...)
+	td := srsTrackData(1, sample, 1000)
+	srs = append(srs, 'S', 'R', 'S', 'T', 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(srs[len(srs)-4:], uint32(8+len(td)))
+	srs = append(srs, td...)
+
+	dir := t.TempDir()
+	movie := filepath.Join(dir, "movie")
+	writeTestFile(t, movie, testData(3000, 3))
+	if _, err := ReconstructSample(srs, movie, dir); err != ErrBadData {
+		t.Errorf("got %v, want ErrBadData", err)
+	}
+	if _, err := ReconstructSample([]byte("fLaC...."), movie, dir); err != ErrUnsupported {
+		t.Errorf("got %v, want ErrUnsupported", err)
+	}
+}
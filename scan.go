@@ -0,0 +1,369 @@
+package rescene
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ScanWarningKind int
+
+const (
+	WarnNoSFV ScanWarningKind = iota
+	WarnMissingFile
+	WarnNotInSFV
+	WarnExtraFile
+)
+
+func (k ScanWarningKind) String() string {
+	switch k {
+	case WarnNoSFV:
+		return "no sfv"
+	case WarnMissingFile:
+		return "missing file"
+	case WarnNotInSFV:
+		return "volume not in sfv"
+	case WarnExtraFile:
+		return "extra file"
+	default:
+		return fmt.Sprintf("warning %d", int(k))
+	}
+}
+
+// ScanWarning is something ScanReleases found odd in a release. Path is
+// relative to the release directory.
+type ScanWarning struct {
+	Kind   ScanWarningKind
+	Path   string
+	Detail string
+}
+
+func (w *ScanWarning) Error() string {
+	s := w.Kind.String() + ": " + w.Path
+	if w.Detail != "" {
+		s += ": " + w.Detail
+	}
+	return s
+}
+
+// ScannedRelease is a release directory found by ScanReleases. Entry names
+// are the paths relative to Dir, with "/" separators, under which they go
+// into the SRR: the RAR volumes, grouped by set and in volume order, and
+// the files to store (SFV, NFO, M3U, Proof/ and Subs/ files, sample SRS).
+// Sample media files are left out: they go into the SRR as SRS files.
+type ScannedRelease struct {
+	Name        string
+	Dir         string
+	Volumes     []*CreateEntry
+	StoredFiles []*CreateEntry
+	Warnings    []*ScanWarning
+}
+
+// Options returns the options to create the SRR of the release with.
+func (r *ScannedRelease) Options(appName string) CreateOptions {
+	return CreateOptions{
+		AppName:     appName,
+		StoredFiles: r.StoredFiles,
+	}
+}
+
+// CreateSrr writes the SRR of the release to w, with the OSO hashes of the
+// files packed in its stored archives, read from the volumes. Compressed
+// archives get no hashes.
+func (r *ScannedRelease) CreateSrr(w io.Writer, appName string) error {
+	var buf bytes.Buffer
+	if err := createSrr(&buf, r.Volumes, r.Options(appName)); err != nil {
+		return err
+	}
+	hashes, err := r.packedHashes(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	for _, h := range hashes {
+		if err = writeSrrOSOHash(w, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packedHashes returns the OSO hashes of the files packed in the volumes
+// of srr, none when the archives are compressed.
+func (r *ScannedRelease) packedHashes(srr []byte) ([]*OSOHash, error) {
+	f := &SrrFile{}
+	if err := f.Unmarshal(srr); err != nil {
+		return nil, err
+	}
+	if f.RarCompressed {
+		return nil, nil
+	}
+	packed, err := f.PackedFS(r.Dir)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]*OSOHash, 0)
+	err = fs.WalkDir(packed, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		file, err := packed.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		h, err := osoHashAt(p, file.(io.ReaderAt), info.Size())
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, h)
+		return nil
+	})
+	return hashes, err
+}
+
+var reDiscDir = regexp.MustCompile(`(?i)^(cd|disc|disk|dvd)[0-9]+$`)
+
+// ScanReleases walks root and returns the release directories found under
+// it, root included. A release directory holds RAR volumes, directly or in
+// disc directories (CD1, CD2...); its Sample, Proof and Subs directories
+// are part of it and are not scanned as releases of their own. The entries
+// that cannot be read are left out and returned by path, the scan going on
+// without them; the error is that of reading root.
+func ScanReleases(root string) ([]*ScannedRelease, map[string]error, error) {
+	releases := make([]*ScannedRelease, 0)
+	failed := make(map[string]error)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			failed[p] = err
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		r, err := scanRelease(p, failed)
+		if err != nil {
+			if p == root {
+				return err
+			}
+			failed[p] = err
+			return filepath.SkipDir
+		}
+		if len(r.Volumes) == 0 {
+			return nil
+		}
+		releases = append(releases, r)
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return releases, failed, nil
+}
+
+// releaseScan is the state of the scan of one release directory.
+type releaseScan struct {
+	*ScannedRelease
+	files  map[string]bool
+	sfv    map[string]uint32
+	sfvs   int
+	failed map[string]error
+}
+
+// scanRelease scans dir as a release directory, adding the entries that
+// cannot be read to failed. The error is that of reading dir.
+func scanRelease(dir string, failed map[string]error) (*ScannedRelease, error) {
+	s := &releaseScan{
+		ScannedRelease: &ScannedRelease{
+			Name:        filepath.Base(dir),
+			Dir:         dir,
+			Volumes:     make([]*CreateEntry, 0),
+			StoredFiles: make([]*CreateEntry, 0),
+			Warnings:    make([]*ScanWarning, 0),
+		},
+		files:  make(map[string]bool),
+		sfv:    make(map[string]uint32),
+		failed: failed,
+	}
+	if err := s.scanDir("", true); err != nil {
+		return nil, err
+	}
+	if len(s.Volumes) == 0 {
+		return s.ScannedRelease, nil
+	}
+
+	if s.sfvs == 0 {
+		s.warn(WarnNoSFV, ".", "")
+	}
+	names := make([]string, 0, len(s.sfv))
+	for name := range s.sfv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !s.files[name] {
+			s.warn(WarnMissingFile, name, "listed in sfv")
+		}
+	}
+	if s.sfvs > 0 {
+		for _, v := range s.Volumes {
+			if _, ok := s.sfv[strings.ToLower(v.Name)]; !ok {
+				s.warn(WarnNotInSFV, v.Name, "")
+			}
+		}
+	}
+	return s.ScannedRelease, nil
+}
+
+func (s *releaseScan) warn(kind ScanWarningKind, name, detail string) {
+	s.Warnings = append(s.Warnings, &ScanWarning{Kind: kind, Path: name, Detail: detail})
+}
+
+// scanDir scans the release directory (top) or one of its disc directories.
+// Only the error of reading the release directory is returned, those of its
+// entries going to failed.
+func (s *releaseScan) scanDir(prefix string, top bool) error {
+	dir := filepath.Join(s.Dir, filepath.FromSlash(prefix))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if top {
+			return err
+		}
+		s.failed[dir] = err
+		return nil
+	}
+	volumes := make([]*CreateEntry, 0)
+	for _, e := range entries {
+		name := path.Join(prefix, e.Name())
+		if e.IsDir() {
+			switch lower := strings.ToLower(e.Name()); {
+			case top && reDiscDir.MatchString(e.Name()):
+				s.scanDir(name, false)
+			case top && (lower == "sample" || lower == "proof" || lower == "subs"):
+				s.scanExtras(name, lower)
+			default:
+				s.warn(WarnExtraFile, name, "directory")
+			}
+			continue
+		}
+		s.files[strings.ToLower(name)] = true
+		entry := s.entry(name)
+		switch ext := strings.ToLower(filepath.Ext(name)); {
+		case RarRootName(e.Name()) != "":
+			volumes = append(volumes, entry)
+		case ext == ".sfv":
+			s.addSFV(entry)
+		case ext == ".nfo" || ext == ".m3u":
+			s.StoredFiles = append(s.StoredFiles, entry)
+		default:
+			s.warn(WarnExtraFile, name, "")
+		}
+	}
+	sort.SliceStable(volumes, func(i, j int) bool {
+		a := strings.ToLower(RarRootName(volumes[i].Name))
+		b := strings.ToLower(RarRootName(volumes[j].Name))
+		if a != b {
+			return a < b
+		}
+		return volumeNumber(volumes[i].Name) < volumeNumber(volumes[j].Name)
+	})
+	s.Volumes = append(s.Volumes, volumes...)
+	return nil
+}
+
+// scanExtras adds the files of a Sample, Proof or Subs directory and of its
+// subdirectories. Only the SRS and SFV files of Sample are stored, the
+// other directories are stored as they are.
+func (s *releaseScan) scanExtras(prefix, kind string) {
+	filepath.WalkDir(filepath.Join(s.Dir, filepath.FromSlash(prefix)), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			s.failed[p] = err
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Dir, p)
+		if err != nil {
+			s.failed[p] = err
+			return nil
+		}
+		name := filepath.ToSlash(rel)
+		s.files[strings.ToLower(name)] = true
+		entry := s.entry(name)
+		switch ext := strings.ToLower(path.Ext(name)); {
+		case ext == ".sfv":
+			s.addSFV(entry)
+		case kind != "sample" || ext == ".srs":
+			s.StoredFiles = append(s.StoredFiles, entry)
+		}
+		return nil
+	})
+}
+
+func (s *releaseScan) entry(name string) *CreateEntry {
+	return &CreateEntry{Name: name, Path: filepath.Join(s.Dir, filepath.FromSlash(name))}
+}
+
+// addSFV stores an SFV and adds its entries, or adds it to failed when it
+// cannot be read.
+func (s *releaseScan) addSFV(e *CreateEntry) {
+	entries, err := readSFV(e)
+	if err != nil {
+		s.failed[e.Path] = err
+		return
+	}
+	s.StoredFiles = append(s.StoredFiles, e)
+	s.sfvs++
+	for name, crc := range entries {
+		s.sfv[name] = crc
+	}
+}
+
+// readSFV returns the CRCs listed in an SFV by lower case path, relative to
+// the release directory. Comments and malformed lines are skipped.
+func readSFV(e *CreateEntry) (map[string]uint32, error) {
+	file, err := os.Open(e.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	entries := make(map[string]uint32)
+	dir := path.Dir(e.Name)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		l := strings.TrimSpace(scanner.Text())
+		if l == "" || l[0] == ';' {
+			continue
+		}
+		i := strings.LastIndexAny(l, " \t")
+		if i < 0 {
+			continue
+		}
+		crc, err := strconv.ParseUint(l[i+1:], 16, 32)
+		if err != nil {
+			continue
+		}
+		name := path.Join(dir, strings.ReplaceAll(strings.TrimSpace(l[:i]), "\\", "/"))
+		entries[strings.ToLower(name)] = uint32(crc)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,136 @@
+package rescene
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScanReleases(t *testing.T) {
+	root := t.TempDir()
+	a := filepath.Join(root, "Group", "Movie.2020-GRP")
+	movie := testData(150000, 1)
+	volumes := rarSplit(t, a, "movie-grp", 60000, map[string][]byte{"movie.mkv": movie}, "movie.mkv")
+	sfv := "; made by a test\r\n"
+	for _, v := range volumes[:2] {
+		data, err := ioutil.ReadFile(filepath.Join(a, v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sfv += fmt.Sprintf("%s %08x\r\n", v, crc32.ChecksumIEEE(data))
+	}
+	sfv += "movie-grp.r05 00000000\r\n"
+	writeTestFile(t, filepath.Join(a, "movie-grp.sfv"), []byte(sfv))
+	writeTestFile(t, filepath.Join(a, "movie-grp.nfo"), []byte("nfo"))
+	writeTestFile(t, filepath.Join(a, "Sample", "movie-grp-sample.mkv"), testData(1000, 2))
+	writeTestFile(t, filepath.Join(a, "Sample", "movie-grp-sample.srs"), []byte("SRSF"))
+	writeTestFile(t, filepath.Join(a, "Proof", "sub", "proof.jpg"), []byte("jpg"))
+	writeTestFile(t, filepath.Join(a, "readme.txt"), []byte("extra"))
+	if err := os.MkdirAll(filepath.Join(a, "Other"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// a disc layout with an SFV that cannot be read
+	b := filepath.Join(root, "Show.S01-GRP")
+	for _, cd := range []string{"CD1", "CD2"} {
+		rarSplit(t, filepath.Join(b, cd), "show", 1000, map[string][]byte{cd + ".avi": testData(500, 3)}, cd+".avi")
+	}
+	if err := os.Symlink(root, filepath.Join(b, "show.sfv")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(root, "empty", "file.txt"), nil)
+
+	releases, failed, err := ScanReleases(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != 2 {
+		t.Fatalf("found %d releases", len(releases))
+	}
+	if len(failed) != 1 || failed[filepath.Join(b, "show.sfv")] == nil {
+		t.Errorf("failed %v", failed)
+	}
+
+	names := func(entries []*CreateEntry) []string {
+		n := make([]string, len(entries))
+		for i, e := range entries {
+			n[i] = e.Name
+		}
+		return n
+	}
+	warnings := func(r *ScannedRelease) []string {
+		w := make([]string, len(r.Warnings))
+		for i, v := range r.Warnings {
+			w[i] = v.Error()
+		}
+		return w
+	}
+	r := releases[0]
+	if r.Name != "Movie.2020-GRP" || r.Dir != a {
+		t.Errorf("release %s in %s", r.Name, r.Dir)
+	}
+	if got := names(r.Volumes); !reflect.DeepEqual(got, volumes) {
+		t.Errorf("volumes %v, want %v", got, volumes)
+	}
+	want := []string{"Proof/sub/proof.jpg", "Sample/movie-grp-sample.srs", "movie-grp.nfo", "movie-grp.sfv"}
+	if got := names(r.StoredFiles); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored %v, want %v", got, want)
+	}
+	want = []string{
+		"extra file: Other: directory",
+		"extra file: readme.txt",
+		"missing file: movie-grp.r05: listed in sfv",
+		"volume not in sfv: movie-grp.r01",
+	}
+	if got := warnings(r); !reflect.DeepEqual(got, want) {
+		t.Errorf("warnings %q, want %q", got, want)
+	}
+
+	r = releases[1]
+	want = []string{"CD1/show.rar", "CD2/show.rar"}
+	if got := names(r.Volumes); r.Name != "Show.S01-GRP" || !reflect.DeepEqual(got, want) {
+		t.Errorf("release %s: volumes %v, want %v", r.Name, got, want)
+	}
+	if len(r.StoredFiles) != 0 || !reflect.DeepEqual(warnings(r), []string{"no sfv: ."}) {
+		t.Errorf("stored %v, warnings %q", names(r.StoredFiles), warnings(r))
+	}
+
+	if _, _, err = ScanReleases(filepath.Join(root, "missing")); err == nil {
+		t.Error("missing root: no error")
+	}
+}
+
+func TestScannedReleaseCreateSrr(t *testing.T) {
+	dir := t.TempDir()
+	movie := testData(150000, 1)
+	rarSplit(t, dir, "movie", 60000, map[string][]byte{"movie.mkv": movie}, "movie.mkv")
+	writeTestFile(t, filepath.Join(dir, "movie.mkv"), movie)
+	writeTestFile(t, filepath.Join(dir, "Sample", "sample.mkv"), testData(1000, 2))
+	releases, _, err := ScanReleases(dir)
+	if err != nil || len(releases) != 1 {
+		t.Fatalf("%d releases, %v", len(releases), err)
+	}
+	var buf bytes.Buffer
+	if err = releases[0].CreateSrr(&buf, "test"); err != nil {
+		t.Fatal(err)
+	}
+	f := &SrrFile{}
+	if err = f.Unmarshal(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	want, err := OSOHashFile(filepath.Join(dir, "movie.mkv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.OSOHashes) != 1 || *f.OSOHashes[0] != *want {
+		t.Errorf("hashes %+v, want %+v", f.OSOHashes, want)
+	}
+	if len(f.RarFiles) != 3 || f.ApplicationName != "test" {
+		t.Errorf("%d volumes, application %q", len(f.RarFiles), f.ApplicationName)
+	}
+}
@@ -0,0 +1,480 @@
+// Package server serves SRR and SRS inspection over HTTP: the JSON model of
+// uploaded files or of files found under a root directory, stored file
+// downloads, NFO previews and verification reports, plus an srrDB-like API
+// over a store.
+//
+// Routes, paths being relative to the root:
+//
+//	POST /inspect                        model of the uploaded SRR or SRS
+//	GET  /model/{path}                   model of an SRR or SRS
+//	GET  /stored/{path}?name=            stored file of an SRR
+//	GET  /nfo/{path}?name=&format=&scale= NFO of an SRR as PNG (scale 1-8) or text
+//	GET  /verify/{path}?dir=             volumes of dir checked against an SRR
+//	GET  /release/{name}                 release of the store
+//	GET  /search?crc=|oso=|size=|name=   releases of the store
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rescene/rescene"
+	"github.com/rescene/rescene/store"
+)
+
+// Server is an http.Handler. Store may be nil, in which case the release
+// and search routes answer 404. Uploads, and the files of the root that
+// are parsed, are limited to MaxUpload bytes. Parsing that panics or takes
+// longer than ParseTimeout is answered with 422.
+type Server struct {
+	Root         string
+	Store        *store.Store
+	MaxUpload    int64
+	ParseTimeout time.Duration
+	mux          *http.ServeMux
+}
+
+// New returns a server for the files under root.
+func New(root string, st *store.Store) *Server {
+	s := &Server{
+		Root:         root,
+		Store:        st,
+		MaxUpload:    32 << 20,
+		ParseTimeout: 10 * time.Second,
+		mux:          http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/inspect", s.handleInspect)
+	s.mux.HandleFunc("/model/", s.handleModel)
+	s.mux.HandleFunc("/stored/", s.handleStored)
+	s.mux.HandleFunc("/nfo/", s.handleNfo)
+	s.mux.HandleFunc("/verify/", s.handleVerify)
+	s.mux.HandleFunc("/release/", s.handleRelease)
+	s.mux.HandleFunc("/search", s.handleSearch)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// httpError is an error with the status to answer it with.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(err error) error {
+	return &httpError{http.StatusBadRequest, err}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var he *httpError
+	switch {
+	case errors.As(err, &he):
+		status = he.status
+	case errors.Is(err, fs.ErrNotExist), err == rescene.ErrNotFound:
+		status = http.StatusNotFound
+	case errors.Is(err, rescene.ErrBadFile), errors.Is(err, rescene.ErrBadBlock), errors.Is(err, rescene.ErrBadData),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		// io.ErrUnexpectedEOF is a block cut short
+		status = http.StatusUnprocessableEntity
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeModel(w http.ResponseWriter, b []byte, err error) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method || (method == http.MethodGet && r.Method == http.MethodHead) {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, &httpError{http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method)})
+	return false
+}
+
+// file returns the path under Root named by the URL path after prefix.
+func (s *Server) file(r *http.Request, prefix string) (string, error) {
+	name := strings.TrimPrefix(r.URL.Path, prefix)
+	if !fs.ValidPath(name) || name == "." {
+		return "", badRequest(fmt.Errorf("invalid path %q", name))
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(name)), nil
+}
+
+// fileTime returns the modification time of a file, zero when unknown.
+func fileTime(p string) time.Time {
+	if info, err := os.Stat(p); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+// errTooLarge answers uploads and files over MaxUpload.
+var errTooLarge = &httpError{http.StatusRequestEntityTooLarge, errors.New("file too large")}
+
+// readFile reads a file of the root to parse, of at most MaxUpload bytes.
+func (s *Server) readFile(p string) ([]byte, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > s.MaxUpload {
+		return nil, errTooLarge
+	}
+	return ioutil.ReadFile(p)
+}
+
+// parse runs fn, which parses untrusted data, turning a panic into
+// ErrBadData and giving up after ParseTimeout. fn keeps running after a
+// timeout: its results must only be used when parse returns nil.
+func (s *Server) parse(fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				done <- fmt.Errorf("%w: %v", rescene.ErrBadData, v)
+			}
+		}()
+		done <- fn()
+	}()
+	timer := time.NewTimer(s.ParseTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("%w: parsing took over %v", rescene.ErrBadData, s.ParseTimeout)
+	}
+}
+
+func (s *Server) readSrr(p string) (*rescene.SrrFile, error) {
+	b, err := s.readFile(p)
+	if err != nil {
+		return nil, err
+	}
+	f := &rescene.SrrFile{}
+	if err = s.parse(func() error { return f.Unmarshal(b) }); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// exportModel returns the JSON model of an SRR or an SRS, told apart by
+// their signature.
+func (s *Server) exportModel(b []byte, opts rescene.ExportOptions, nested bool) ([]byte, error) {
+	var model []byte
+	err := s.parse(func() (err error) {
+		model, err = exportModel(b, opts, nested)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+func exportModel(b []byte, opts rescene.ExportOptions, nested bool) ([]byte, error) {
+	if rescene.SrrMatcher(b) {
+		f := &rescene.SrrFile{}
+		if err := f.Unmarshal(b); err != nil {
+			return nil, err
+		}
+		if nested {
+			f.ParseNested()
+		}
+		return f.ExportJSON(opts)
+	}
+	f := &rescene.SrsFile{}
+	if err := f.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	return f.ExportJSON()
+}
+
+func exportOptions(r *http.Request) (rescene.ExportOptions, bool) {
+	q := r.URL.Query()
+	return rescene.ExportOptions{
+		StoredData: q.Get("data") != "",
+		Blocks:     q.Get("blocks") != "",
+	}, q.Get("nested") != ""
+}
+
+// handleInspect parses an upload, sent as the request body or as the
+// "file" field of a multipart form.
+func (s *Server) handleInspect(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodPost) {
+		return
+	}
+	if r.ContentLength > s.MaxUpload {
+		writeError(w, errTooLarge)
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, s.MaxUpload)
+	var src io.Reader = body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.Body = body
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			writeError(w, uploadError(err))
+			return
+		}
+		defer file.Close()
+		src = file
+	}
+	b, err := ioutil.ReadAll(src)
+	if err != nil {
+		writeError(w, uploadError(err))
+		return
+	}
+	opts, nested := exportOptions(r)
+	b, err = s.exportModel(b, opts, nested)
+	writeModel(w, b, err)
+}
+
+// uploadError tells an upload over MaxUpload, cut by http.MaxBytesReader,
+// from a bad request.
+func uploadError(err error) error {
+	// http.MaxBytesReader has no error type to check before Go 1.19
+	if strings.Contains(err.Error(), "request body too large") {
+		return errTooLarge
+	}
+	return badRequest(err)
+}
+
+func (s *Server) handleModel(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	p, err := s.file(r, "/model/")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	b, err := s.readFile(p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	opts, nested := exportOptions(r)
+	b, err = s.exportModel(b, opts, nested)
+	writeModel(w, b, err)
+}
+
+func (s *Server) handleStored(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	p, err := s.file(r, "/stored/")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	f, err := s.readSrr(p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	for _, sf := range f.StoredFiles {
+		if sf.Path == name {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(strings.ReplaceAll(sf.Path, "\\", "/"))))
+			http.ServeContent(w, r, sf.Path, fileTime(p), bytes.NewReader(sf.Data))
+			return
+		}
+	}
+	writeError(w, rescene.ErrNotFound)
+}
+
+// handleNfo answers the NFO given by name, or the first stored .nfo file,
+// as PNG unless format is "text".
+func (s *Server) handleNfo(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	q := r.URL.Query()
+	scale := 1
+	if v := q.Get("scale"); v != "" {
+		var err error
+		if scale, err = strconv.Atoi(v); err != nil || scale < 1 || scale > rescene.NfoMaxScale {
+			writeError(w, badRequest(fmt.Errorf("scale must be 1 to %d", rescene.NfoMaxScale)))
+			return
+		}
+	}
+	p, err := s.file(r, "/nfo/")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	f, err := s.readSrr(p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var nfo *rescene.StoredFile
+	for _, sf := range f.StoredFiles {
+		if q.Get("name") == sf.Path || (q.Get("name") == "" && strings.EqualFold(path.Ext(sf.Path), ".nfo")) {
+			nfo = sf
+			break
+		}
+	}
+	if nfo == nil {
+		writeError(w, rescene.ErrNotFound)
+		return
+	}
+	if q.Get("format") == "text" {
+		text, err := rescene.NfoText(nfo)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, text)
+		return
+	}
+	var buf bytes.Buffer
+	if err = rescene.WriteNfoPNG(&buf, nfo, rescene.NfoOptions{Scale: scale}); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(buf.Bytes())
+}
+
+// handleVerify checks the volumes found in dir, relative to the root, or
+// next to the SRR when dir is not given.
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	p, err := s.file(r, "/verify/")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	dir := filepath.Dir(p)
+	if d := r.URL.Query().Get("dir"); d != "" {
+		if !fs.ValidPath(d) {
+			writeError(w, badRequest(fmt.Errorf("invalid path %q", d)))
+			return
+		}
+		dir = filepath.Join(s.Root, filepath.FromSlash(d))
+	}
+	f, err := s.readSrr(p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	results, err := f.Verify(dir)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	report := struct {
+		OK      bool                    `json:"ok"`
+		Volumes []*rescene.VolumeResult `json:"volumes"`
+	}{true, results}
+	for _, v := range results {
+		report.OK = report.OK && v.OK()
+	}
+	writeJSON(w, report)
+}
+
+func (s *Server) handleRelease(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	if s.Store == nil {
+		writeError(w, rescene.ErrNotFound)
+		return
+	}
+	rel, err := s.Store.Get(strings.TrimPrefix(r.URL.Path, "/release/"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, rel)
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	if s.Store == nil {
+		writeError(w, rescene.ErrNotFound)
+		return
+	}
+	q := r.URL.Query()
+	var releases []*store.Release
+	var err error
+	switch {
+	case q.Get("crc") != "":
+		var v uint64
+		if v, err = strconv.ParseUint(q.Get("crc"), 16, 32); err == nil {
+			releases, err = s.Store.ByCRC(uint32(v))
+		} else {
+			err = badRequest(err)
+		}
+	case q.Get("oso") != "":
+		var v uint64
+		if v, err = strconv.ParseUint(q.Get("oso"), 16, 64); err == nil {
+			releases, err = s.Store.ByOSOHash(v)
+		} else {
+			err = badRequest(err)
+		}
+	case q.Get("size") != "":
+		var v uint64
+		if v, err = strconv.ParseUint(q.Get("size"), 10, 64); err == nil {
+			releases, err = s.Store.BySize(v)
+		} else {
+			err = badRequest(err)
+		}
+	case q.Get("name") != "":
+		if releases, err = s.Store.ByName(q.Get("name")); err == path.ErrBadPattern {
+			err = badRequest(err)
+		}
+	default:
+		err = badRequest(errors.New("one of crc, oso, size or name is needed"))
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, struct {
+		Results []*store.Release `json:"results"`
+	}{releases})
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rescene/rescene"
+)
+
+// writeSrr writes x.srr, storing x.nfo, in dir and returns its content.
+func writeSrr(t *testing.T, dir string) []byte {
+	t.Helper()
+	nfo := filepath.Join(dir, "x.nfo")
+	if err := ioutil.WriteFile(nfo, []byte("hello\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err := rescene.CreateSrr(&buf, nil, rescene.CreateOptions{
+		StoredFiles: []*rescene.CreateEntry{{Name: "x.nfo", Path: nfo}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "x.srr"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func serve(s *Server, method, target string, body io.Reader, contentType string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, body)
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestNfoScale(t *testing.T) {
+	dir := t.TempDir()
+	writeSrr(t, dir)
+	s := New(dir, nil)
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{"", http.StatusOK},
+		{"?scale=1", http.StatusOK},
+		{"?scale=8", http.StatusOK},
+		{"?scale=0", http.StatusBadRequest},
+		{"?scale=9", http.StatusBadRequest},
+		{"?scale=100000", http.StatusBadRequest},
+		{"?scale=x", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := serve(s, http.MethodGet, "/nfo/x.srr"+tt.query, nil, "")
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.query, w.Code, tt.status, w.Body)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	dir := t.TempDir()
+	srr := writeSrr(t, dir)
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	fw, _ := mw.CreateFormFile("file", "x.srr")
+	fw.Write(srr)
+	mw.Close()
+
+	s := New(dir, nil)
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		status      int
+		typ         string
+	}{
+		{"SRR", srr, "application/octet-stream", http.StatusOK, "srr"},
+		{"multipart", form.Bytes(), mw.FormDataContentType(), http.StatusOK, "srr"},
+		{"SRS", []byte("SRSF\x08\x00\x00\x00"), "", http.StatusOK, "srs"},
+		{"no file field", form.Bytes(), "multipart/form-data; boundary=other", http.StatusBadRequest, ""},
+		{"truncated SRR", srr[:len(srr)-1], "", http.StatusUnprocessableEntity, ""},
+		{"short SRS", []byte("SRSF\x00"), "", http.StatusUnprocessableEntity, ""},
+		{"empty SRS block", []byte("SRSF\x00\x00\x00\x00"), "", http.StatusUnprocessableEntity, ""},
+	}
+	for _, tt := range tests {
+		w := serve(s, http.MethodPost, "/inspect", bytes.NewReader(tt.body), tt.contentType)
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.status, w.Body)
+			continue
+		}
+		var model struct {
+			Type  string `json:"type"`
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &model); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if model.Type != tt.typ || (tt.status != http.StatusOK) != (model.Error != "") {
+			t.Errorf("%s: answered %s", tt.name, w.Body)
+		}
+	}
+	if w := serve(s, http.MethodGet, "/inspect", nil, ""); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("GET: status %d, Allow %q", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestUploadLimit(t *testing.T) {
+	dir := t.TempDir()
+	srr := writeSrr(t, dir)
+	s := New(dir, nil)
+	s.MaxUpload = int64(len(srr) - 1)
+
+	if w := serve(s, http.MethodPost, "/inspect", bytes.NewReader(srr), ""); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("known length: status %d: %s", w.Code, w.Body)
+	}
+	// no Content-Length: the body is cut while it is read
+	r := httptest.NewRequest(http.MethodPost, "/inspect", io.MultiReader(bytes.NewReader(srr)))
+	r.ContentLength = -1
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("unknown length: status %d: %s", w.Code, w.Body)
+	}
+	for _, route := range []string{"/model/x.srr", "/stored/x.srr?name=x.nfo"} {
+		if w := serve(s, http.MethodGet, route, nil, ""); w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: status %d: %s", route, w.Code, w.Body)
+		}
+	}
+	s.MaxUpload = int64(len(srr))
+	if w := serve(s, http.MethodPost, "/inspect", bytes.NewReader(srr), ""); w.Code != http.StatusOK {
+		t.Errorf("at the limit: status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestModel(t *testing.T) {
+	dir := t.TempDir()
+	writeSrr(t, dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "bad.srr"), []byte("\x69\x69\x69\x00\x00\x14\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := New(dir, nil)
+	tests := []struct {
+		target string
+		status int
+		want   string
+	}{
+		{"/model/x.srr", http.StatusOK, `"stored_files":[{"type":"stored_file","path":"x.nfo","size":7}]`},
+		{"/model/x.srr?data=1", http.StatusOK, `"data":"aGVsbG8NCg=="`},
+		{"/model/x.srr?blocks=1", http.StatusOK, `"blocks":[`},
+		{"/model/missing.srr", http.StatusNotFound, `"error"`},
+		{"/model/bad.srr", http.StatusUnprocessableEntity, `"error"`},
+		{"/model/", http.StatusBadRequest, `"error"`},
+		{"/stored/x.srr?name=x.nfo", http.StatusOK, "hello\r\n"},
+		{"/stored/x.srr?name=y.nfo", http.StatusNotFound, `"error"`},
+		{"/nfo/x.srr?format=text", http.StatusOK, "hello\n"},
+		{"/verify/x.srr", http.StatusOK, `{"ok":true,"volumes":[]}`},
+		{"/release/x", http.StatusNotFound, `"error"`},
+		{"/search?crc=0", http.StatusNotFound, `"error"`},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.URL.Path, r.URL.RawQuery = tt.target, ""
+		if i := strings.IndexByte(tt.target, '?'); i >= 0 {
+			r.URL.Path, r.URL.RawQuery = tt.target[:i], tt.target[i+1:]
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("%s: status %d, want %d with %s: %s", tt.target, w.Code, tt.status, tt.want, w.Body)
+		}
+	}
+	if w := serve(s, http.MethodPost, "/model/x.srr", nil, ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d", w.Code)
+	}
+}
+
+func TestParseBoundary(t *testing.T) {
+	s := New(t.TempDir(), nil)
+	s.ParseTimeout = 10 * time.Millisecond
+	if err := s.parse(func() error { panic("bad input") }); !errors.Is(err, rescene.ErrBadData) {
+		t.Errorf("panic: %v", err)
+	}
+	block := make(chan struct{})
+	defer close(block)
+	if err := s.parse(func() error { <-block; return nil }); !errors.Is(err, rescene.ErrBadData) {
+		t.Errorf("timeout: %v", err)
+	}
+	if err := s.parse(func() error { return os.ErrNotExist }); err != os.ErrNotExist {
+		t.Errorf("error: %v", err)
+	}
+}
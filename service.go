@@ -0,0 +1,193 @@
+package rescene
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"unicode/utf16"
+)
+
+// ServiceData is the data of a comment or of a service block, as stored in
+// the archive: packed unless Method is 0x30.
+type ServiceData struct {
+	Method        uint8
+	UnpackVersion uint8
+	UnpackSize    int
+	CRC           uint32
+	Data          []byte
+	crc16         bool // CommHead keeps the low 16 bits of the CRC only
+}
+
+// Unpack returns the unpacked data. Stored data and data packed with the
+// RAR 1.5 algorithm of old comments are supported, other methods return
+// ErrUnsupported.
+func (d *ServiceData) Unpack() ([]byte, error) {
+	var data []byte
+	switch {
+	case d.Method == 0x30:
+		data = d.Data
+	case d.UnpackVersion == 15:
+		var err error
+		if data, err = unpack15(d.Data, d.UnpackSize); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnsupported
+	}
+	crc := crc32.ChecksumIEEE(data)
+	if d.crc16 {
+		crc &= 0xffff
+	}
+	if crc != d.CRC {
+		return nil, ErrCRC
+	}
+	return data, nil
+}
+
+// RarComment is an archive comment, from a RAR 2.x comment block or a RAR
+// 3.x "CMT" service block. Text is empty when the comment could not be
+// unpacked; Unpack tells why.
+type RarComment struct {
+	ServiceData
+	Text string
+}
+
+// RarStream is an NTFS alternate data stream of a packed file.
+type RarStream struct {
+	ServiceData
+	File string
+	Name string
+}
+
+// RarACL is the NTFS security descriptor of a packed file. Owner, Group and
+// Entries are only known when the descriptor is stored.
+type RarACL struct {
+	ServiceData
+	File    string
+	Owner   string
+	Group   string
+	Entries []*ACLEntry
+}
+
+// ACLEntry is an access control entry of the DACL of a security descriptor.
+type ACLEntry struct {
+	Type  uint8
+	Flags uint8
+	Mask  uint32
+	SID   string
+}
+
+func newComment(d ServiceData) *RarComment {
+	c := &RarComment{ServiceData: d}
+	if text, err := c.Unpack(); err == nil {
+		c.Text = string(text)
+	}
+	return c
+}
+
+func (b *CommHeadBlock) GetComment() *RarComment {
+	return newComment(ServiceData{
+		Method:        b.Method,
+		UnpackVersion: b.UnpackVersion,
+		UnpackSize:    int(b.UnpackSize),
+		CRC:           uint32(b.CommentCRC),
+		Data:          b.Comment,
+		crc16:         true,
+	})
+}
+
+// serviceData returns the data of a service block, found after its header
+// in data.
+func (b *NewSubHeadBlock) serviceData(data []byte) ServiceData {
+	d := ServiceData{
+		Method:        b.Method,
+		UnpackVersion: b.UnpackVersion,
+		UnpackSize:    b.GetUnpackSize(),
+		CRC:           b.FileCRC,
+	}
+	if end := int(b.Size) + b.GetPackSize(); end <= len(data) {
+		d.Data = data[b.Size:end]
+	}
+	return d
+}
+
+func (b *SubHeadBlock) serviceData() ServiceData {
+	return ServiceData{
+		Method:        b.Method,
+		UnpackVersion: b.UnpackVersion,
+		UnpackSize:    int(b.UnpackSize),
+		CRC:           b.DataCRC,
+		Data:          b.Data,
+	}
+}
+
+// GetStreamName returns the name of an "STM" stream, kept as UTF-16.
+func (b *NewSubHeadBlock) GetStreamName() string {
+	u := make([]uint16, len(b.SubData)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b.SubData[2*i:])
+	}
+	return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+}
+
+func newACL(d ServiceData, file string) *RarACL {
+	a := &RarACL{ServiceData: d, File: file}
+	if sd, err := a.Unpack(); err == nil {
+		a.parse(sd)
+	}
+	return a
+}
+
+// parse reads a self-relative security descriptor.
+func (a *RarACL) parse(sd []byte) {
+	if len(sd) < 20 {
+		return
+	}
+	a.Owner = readSID(sd, binary.LittleEndian.Uint32(sd[4:]))
+	a.Group = readSID(sd, binary.LittleEndian.Uint32(sd[8:]))
+	dacl := int(binary.LittleEndian.Uint32(sd[16:]))
+	if dacl == 0 || dacl+8 > len(sd) {
+		return
+	}
+	count := int(binary.LittleEndian.Uint16(sd[dacl+4:]))
+	pos := dacl + 8
+	for i := 0; i < count && pos+8 <= len(sd); i++ {
+		size := int(binary.LittleEndian.Uint16(sd[pos+2:]))
+		if size < 8 || pos+size > len(sd) {
+			return
+		}
+		e := &ACLEntry{
+			Type:  sd[pos],
+			Flags: sd[pos+1],
+			Mask:  binary.LittleEndian.Uint32(sd[pos+4:]),
+		}
+		if e.Type <= 3 {
+			// allowed, denied, audit and alarm entries end with the SID
+			e.SID = readSID(sd[:pos+size], uint32(pos+8))
+		}
+		a.Entries = append(a.Entries, e)
+		pos += size
+	}
+}
+
+// readSID returns the SID found at offset of b as "S-1-5-32-544".
+func readSID(b []byte, offset uint32) string {
+	pos := int(offset)
+	if pos == 0 || pos+8 > len(b) {
+		return ""
+	}
+	count := int(b[pos+1])
+	if pos+8+4*count > len(b) {
+		return ""
+	}
+	var auth uint64
+	for _, c := range b[pos+2 : pos+8] {
+		auth = auth<<8 | uint64(c)
+	}
+	s := fmt.Sprintf("S-%d-%d", b[pos], auth)
+	for i := 0; i < count; i++ {
+		s += fmt.Sprintf("-%d", binary.LittleEndian.Uint32(b[pos+8+4*i:]))
+	}
+	return s
+}
@@ -0,0 +1,83 @@
+package rescene
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"path/filepath"
+	"testing"
+)
+
+// rarCommHead returns a RAR 2.x comment block with stored text.
+func rarCommHead(text []byte, crc uint16) []byte {
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, uint16(len(text)))
+	body.WriteByte(15)
+	body.WriteByte(0x30)
+	binary.Write(&body, binary.LittleEndian, crc)
+	body.Write(text)
+	return rarBlock(CommHead, 0, body.Bytes())
+}
+
+func TestComments(t *testing.T) {
+	text := []byte("Group comment\r\nline two\r\n")
+	crc := crc32.ChecksumIEEE(text)
+	tests := []struct {
+		name  string
+		block []byte
+		text  string
+	}{
+		{"comment block", rarCommHead(text, uint16(crc)), string(text)},
+		{"comment block CRC", rarCommHead(text, uint16(crc)+1), ""},
+		{"CMT block", append(rarFileHead(NewSubHead, 0, "CMT", len(text), len(text), crc, nil), text...), string(text)},
+		{"CMT block CRC", append(rarFileHead(NewSubHead, 0, "CMT", len(text), len(text), crc+1, nil), text...), ""},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		v := rarMainHead(0)
+		v = append(v, tt.block...)
+		v = append(v, rarEndArc(0)...)
+		writeTestFile(t, filepath.Join(dir, "test.rar"), v)
+		f := srrOf(t, dir, []string{"test.rar"}, CreateOptions{})
+		c := f.RarFiles[0].Comment
+		if c == nil {
+			t.Errorf("%s: no comment", tt.name)
+			continue
+		}
+		if c.Text != tt.text {
+			t.Errorf("%s: text %q, want %q", tt.name, c.Text, tt.text)
+		}
+		if _, err := c.Unpack(); tt.text == "" && err != ErrCRC {
+			t.Errorf("%s: Unpack() = %v, want ErrCRC", tt.name, err)
+		}
+	}
+}
+
+func TestServiceDataUnpack(t *testing.T) {
+	d := &ServiceData{Method: 0x33, UnpackVersion: 29, UnpackSize: 10, Data: testData(10, 1)}
+	if _, err := d.Unpack(); err != ErrUnsupported {
+		t.Errorf("RAR 2.9 method: %v, want ErrUnsupported", err)
+	}
+	d = &ServiceData{Method: 0x33, UnpackVersion: 15}
+	if data, err := d.Unpack(); err != nil || len(data) != 0 {
+		t.Errorf("empty RAR 1.5 data: %q, %v", data, err)
+	}
+}
+
+// unpack15 must stop on data it cannot decode: the packed comments of an
+// SRR come from untrusted files.
+func TestUnpack15BadData(t *testing.T) {
+	for seed := byte(0); seed < 32; seed++ {
+		data := testData(64, seed)
+		for _, n := range []int{0, 1, 7, 64} {
+			out, err := unpack15(data[:n], 500)
+			if err == nil && len(out) != 500 {
+				t.Errorf("seed %d, %d bytes: %d bytes unpacked without error", seed, n, len(out))
+			}
+		}
+		d := &ServiceData{Method: 0x33, UnpackVersion: 15, UnpackSize: 500, Data: data}
+		if _, err := d.Unpack(); err == nil {
+			t.Errorf("seed %d: random data unpacks", seed)
+		}
+	}
+}
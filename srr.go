@@ -1,7 +1,7 @@
 package rescene
 
 import (
-	"fmt"
+	"encoding/binary"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -9,9 +9,13 @@ import (
 	"strings"
 )
 
+// StoredFile is a file kept whole in the SRR. Srs or Srr is set by
+// ParseNested when the file is itself an SRS or an SRR.
 type StoredFile struct {
 	Path string
 	Data []byte
+	Srs  *SrsFile
+	Srr  *SrrFile
 }
 
 type OSOHash struct {
@@ -21,17 +25,26 @@ type OSOHash struct {
 }
 
 type RarFile struct {
-	Path     string
-	Size     int
-	CRC      uint32
-	IsFirst  bool
-	IsNewFmt bool
+	Path        string
+	Size        int
+	CRC         uint32
+	IsFirst     bool
+	IsNewFmt    bool
+	HasEndArc   bool
+	Properties  ArchiveProperties
+	PackedFiles []*PackedFile
+	FileHeads   []*FileHeadBlock
+	Comment     *RarComment
+	AuthInfo    []byte
+	Streams     []*RarStream
+	ACLs        []*RarACL
 }
 
 type PackedFile struct {
-	Path string
-	Size uint64
-	CRC  uint32
+	Path       string
+	Size       uint64
+	CRC        uint32
+	Properties FileProperties
 }
 
 type SrrFile struct {
@@ -42,6 +55,20 @@ type SrrFile struct {
 	RarCompressed   bool
 	PackedFiles     []*PackedFile
 	SFVComments     []string
+	Blocks          []Block
+	nested          bool // ParseNested was called
+}
+
+// Block is a header block of the SRR as found in the file. Header holds the
+// parsed block (*FileHeadBlock, *NewSubHeadBlock...) and Raw the bytes of
+// the header followed by the data the SRR keeps for it. Volume is nil for
+// the blocks that do not belong to a RAR volume.
+type Block struct {
+	Offset int
+	Type   RarHeaderType
+	Header interface{}
+	Raw    []byte
+	Volume *RarFile
 }
 
 func (f *SrrFile) Unmarshal(b []byte) (err error) {
@@ -51,23 +78,24 @@ func (f *SrrFile) Unmarshal(b []byte) (err error) {
 	f.RarCompressed = false
 	f.PackedFiles = make([]*PackedFile, 0)
 	f.SFVComments = make([]string, 0)
+	f.Blocks = make([]Block, 0)
 	prevHeader := &RarHeader{}
 	currentRarFile := &RarFile{}
 	currentPackedFile := &PackedFile{}
+	var volume *RarFile
 	offset := 0
 	for offset < len(b) {
-		m := make(map[string]interface{})
-		m["srr_header_offset"] = offset
+		start := offset
+		var parsed interface{}
 
+		if len(b)-offset < 7 {
+			return ErrBadBlock
+		}
 		header := &RarHeader{}
 		err := header.Parse(b[offset : offset+7])
 		if err != nil {
 			return err
 		}
-		m["srr_header_type"] = fmt.Sprintf("%x", header.Type)
-		m["srr_header_flags"] = fmt.Sprintf("%x", header.Flags)
-		m["srr_header_crc"] = fmt.Sprintf("%x", header.CRC)
-		m["srr_header_size"] = header.Size
 
 		switch header.Type {
 		case SrrVolHead: // 0x69
@@ -77,6 +105,7 @@ func (f *SrrFile) Unmarshal(b []byte) (err error) {
 			if err = block.Parse(b[offset:]); err != nil {
 				return err
 			}
+			parsed = block
 			f.ApplicationName = block.GetAppName()
 			offset += int(block.GetSize())
 			prevHeader = header
@@ -87,6 +116,7 @@ func (f *SrrFile) Unmarshal(b []byte) (err error) {
 			if err = block.Parse(b[offset:]); err != nil {
 				return err
 			}
+			parsed = block
 			s := &StoredFile{}
 			if s, err = block.GetStoredFile(); err != nil {
 				return err
@@ -102,6 +132,7 @@ func (f *SrrFile) Unmarshal(b []byte) (err error) {
 			if err = block.Parse(b[offset:]); err != nil {
 				return err
 			}
+			parsed = block
 			h := &OSOHash{}
 			if h, err = block.GetOSOHash(); err != nil {
 				return err
@@ -116,6 +147,7 @@ func (f *SrrFile) Unmarshal(b []byte) (err error) {
 			if err = block.Parse(b[offset:]); err != nil {
 				return err
 			}
+			parsed = block
 			offset += int(block.GetSize())
 			currentRarFile.Size += int(block.PadSize)
 		case SrrRarSubBlockHead: // 0x71
@@ -125,10 +157,14 @@ func (f *SrrFile) Unmarshal(b []byte) (err error) {
 			if err = block.Parse(b[offset:]); err != nil {
 				return err
 			}
+			parsed = block
 			currentRarFile = &RarFile{
-				Size: 0,
-				Path: block.GetRarFileName(),
+				Size:        0,
+				Path:        block.GetRarFileName(),
+				PackedFiles: make([]*PackedFile, 0),
+				FileHeads:   make([]*FileHeadBlock, 0),
 			}
+			volume = currentRarFile
 			f.RarFiles = append(f.RarFiles, currentRarFile)
 			offset += int(block.GetSize())
 			prevHeader = header
@@ -139,6 +175,7 @@ func (f *SrrFile) Unmarshal(b []byte) (err error) {
 			if err = block.Parse(b[offset:]); err != nil {
 				return err
 			}
+			parsed = block
 			if prevHeader.Type != SrrRarSubBlockHead {
 				return ErrBadFile
 			}
@@ -146,7 +183,17 @@ func (f *SrrFile) Unmarshal(b []byte) (err error) {
 			offset += int(header.Size)
 			prevHeader = header
 		case MainHead: // 0x73
-			//nothing to do
+			block := &MainHeadBlock{
+				RarHeader: *header,
+			}
+			if err = block.Parse(b[offset:]); err != nil {
+				return err
+			}
+			parsed = block
+			currentRarFile.Properties = block.GetProperties()
+			if block.Comment != nil {
+				currentRarFile.Comment = block.Comment.GetComment()
+			}
 			currentRarFile.IsFirst = header.Flag(MHD_FIRSTVOLUME)
 			currentRarFile.IsNewFmt = header.Flag(MHD_NEWNUMBERING)
 			currentRarFile.Size += int(header.Size)
@@ -159,12 +206,17 @@ func (f *SrrFile) Unmarshal(b []byte) (err error) {
 			if err = block.Parse(b[offset:]); err != nil {
 				return err
 			}
+			parsed = block
 			if !block.Flag(LHD_SPLIT_BEFORE) || (currentPackedFile.Path == "" && block.GetFileName() != "") {
 				currentPackedFile = &PackedFile{
-					Path: block.GetFileName(),
-					CRC:  block.GetCRC(),
+					Path:       block.GetFileName(),
+					CRC:        block.GetCRC(),
+					Properties: block.GetProperties(),
 				}
 			}
+			if block.Flag(LHD_PASSWORD) {
+				currentPackedFile.Properties.Encrypted = true
+			}
 			if err = block.UpdatePackedFile(currentPackedFile); err != nil {
 				return err
 			}
@@ -178,6 +230,10 @@ func (f *SrrFile) Unmarshal(b []byte) (err error) {
 			if newFile {
 				f.PackedFiles = append(f.PackedFiles, currentPackedFile)
 			}
+			currentRarFile.FileHeads = append(currentRarFile.FileHeads, block)
+			if n := len(currentRarFile.PackedFiles); n == 0 || currentRarFile.PackedFiles[n-1] != currentPackedFile {
+				currentRarFile.PackedFiles = append(currentRarFile.PackedFiles, currentPackedFile)
+			}
 
 			if !f.RarCompressed && block.IsCompressed() {
 				f.RarCompressed = true
@@ -186,19 +242,62 @@ func (f *SrrFile) Unmarshal(b []byte) (err error) {
 			offset += int(header.Size)
 			prevHeader = header
 		case CommHead: // 0x75
-			// nothing to do
+			block := &CommHeadBlock{
+				RarHeader: *header,
+			}
+			if err = block.Parse(b[offset:]); err != nil {
+				return err
+			}
+			parsed = block
+			currentRarFile.Properties.HasComment = true
+			currentRarFile.Comment = block.GetComment()
 			currentRarFile.Size += int(header.Size)
 			offset += int(header.Size)
 			prevHeader = header
 		case AvHead: // 0x76
-			// nothing to do
+			block := &AvHeadBlock{
+				RarHeader: *header,
+			}
+			if err = block.Parse(b[offset:]); err != nil {
+				return err
+			}
+			parsed = block
+			currentRarFile.Properties.HasAuthInfo = true
+			currentRarFile.AuthInfo = block.AVInfo
 			currentRarFile.Size += int(header.Size)
 			offset += int(header.Size)
 			prevHeader = header
 		case SubHead: // 0x77
-			// nothing to do
-			currentRarFile.Size += int(header.Size)
-			offset += int(header.Size)
+			block := &SubHeadBlock{
+				RarHeader: *header,
+			}
+			if err = block.Parse(b[offset:]); err != nil {
+				return err
+			}
+			parsed = block
+			// CreateSrr keeps the data of these blocks, other tools may
+			// strip it as they do for recovery records
+			size := block.GetSize()
+			if block.Data == nil || !srrBlockAt(b[offset+size:]) && srrBlockAt(b[offset+int(header.Size):]) {
+				block.Data = nil
+				size = int(header.Size)
+			}
+			file := ""
+			if n := len(currentRarFile.FileHeads); n > 0 {
+				file = currentRarFile.FileHeads[n-1].GetFileName()
+			}
+			switch block.SubType {
+			case NTACL_HEAD:
+				currentRarFile.ACLs = append(currentRarFile.ACLs, newACL(block.serviceData(), file))
+			case STREAM_HEAD:
+				currentRarFile.Streams = append(currentRarFile.Streams, &RarStream{
+					ServiceData: block.serviceData(),
+					File:        file,
+					Name:        string(block.StreamName),
+				})
+			}
+			currentRarFile.Size += block.GetSize()
+			offset += size
 			prevHeader = header
 		case ProtectHead: // 0x78
 			block := &ProtectHeadBlock{
@@ -207,11 +306,14 @@ func (f *SrrFile) Unmarshal(b []byte) (err error) {
 			if err = block.Parse(b[offset:]); err != nil {
 				return err
 			}
+			parsed = block
+			currentRarFile.Properties.HasRecovery = true
 			currentRarFile.Size += block.GetSize()
 			offset += int(header.Size)
 			prevHeader = header
 		case SignHead: // 0x79
 			// nothing to do
+			parsed = &SignHeadBlock{RarHeader: *header}
 			currentRarFile.Size += int(header.Size)
 			offset += int(header.Size)
 			prevHeader = header
@@ -222,7 +324,31 @@ func (f *SrrFile) Unmarshal(b []byte) (err error) {
 			if err = block.Parse(b[offset:]); err != nil {
 				return err
 			}
+			parsed = block
 			currentRarFile.Size += block.GetSize()
+			file := ""
+			if n := len(currentRarFile.FileHeads); n > 0 {
+				// file service blocks follow the file they belong to
+				file = currentRarFile.FileHeads[n-1].GetFileName()
+			}
+			switch block.GetFileName() {
+			case "RR":
+				currentRarFile.Properties.HasRecovery = true
+			case "CMT":
+				currentRarFile.Properties.HasComment = true
+				currentRarFile.Comment = newComment(block.serviceData(b[offset:]))
+			case "AV":
+				currentRarFile.Properties.HasAuthInfo = true
+				currentRarFile.AuthInfo = block.serviceData(b[offset:]).Data
+			case "STM":
+				currentRarFile.Streams = append(currentRarFile.Streams, &RarStream{
+					ServiceData: block.serviceData(b[offset:]),
+					File:        file,
+					Name:        block.GetStreamName(),
+				})
+			case "ACL":
+				currentRarFile.ACLs = append(currentRarFile.ACLs, newACL(block.serviceData(b[offset:]), file))
+			}
 			if block.GetFileName() == "RR" {
 				// stripped data
 				offset += int(header.Size)
@@ -231,18 +357,53 @@ func (f *SrrFile) Unmarshal(b []byte) (err error) {
 			}
 			prevHeader = header
 		case EndArcHead: // 0x7B
-			// Terminator, nothing to do
+			// Terminator
+			parsed = &EndArcHeadBlock{RarHeader: *header}
+			currentRarFile.HasEndArc = true
 			currentRarFile.Size += int(header.Size)
 			offset += int(header.Size)
 			prevHeader = header
 		case EmptyHead: // 0x00
 			// for P0W4 releases, cleared header, add to rarfile size
+			parsed = header
 			currentRarFile.Size += int(header.Size)
 			offset += int(header.Size)
 			prevHeader = header
 		default:
-			return nil
+			// unknown block, kept as is
+			size := header.GetSize()
+			if header.Size < 7 || offset+size > len(b) {
+				return ErrBadBlock
+			}
+			if header.Flag(HAS_DATA) && size >= 11 {
+				size += int(binary.LittleEndian.Uint32(b[offset+7 : offset+11]))
+				if offset+size > len(b) {
+					return ErrBadBlock
+				}
+			}
+			parsed = header
+			if header.Type >= MarkHead {
+				currentRarFile.Size += size
+			}
+			offset += size
+			prevHeader = header
+		}
+
+		if offset < start+7 || offset > len(b) {
+			// a block smaller than a header or running past the end
+			return ErrBadBlock
 		}
+		block := Block{
+			Offset: start,
+			Type:   header.Type,
+			Header: parsed,
+			Raw:    b[start:offset],
+			Volume: volume,
+		}
+		if header.Type != EmptyHead && header.Type < SrrRarSubBlockHead && header.Type != SrrRarPadHead {
+			block.Volume = nil
+		}
+		f.Blocks = append(f.Blocks, block)
 	}
 
 	sfv := make(map[string]uint32, 0)
@@ -334,32 +495,24 @@ func (f *SrrFile) Unmarshal(b []byte) (err error) {
 	return nil
 }
 
-func RarRootName(path string) string {
-	var re *regexp.Regexp
-	reOld := regexp.MustCompile("^(?P<Base>.*)(\\.[rstu]{1}[0-9]{2})$")
-	re = reOld
-	if re.MatchString(path) {
-		return strings.ToLower(re.ReplaceAllString(path, "${Base}"))
+// srrBlockAt tells whether b is empty or starts with what looks like the
+// header of an SRR or RAR block.
+func srrBlockAt(b []byte) bool {
+	if len(b) == 0 {
+		return true
 	}
-	reOld2 := regexp.MustCompile("^(?P<Base>.*)(\\.[0-9]{3})$")
-	re = reOld2
-	if re.MatchString(path) {
-		return strings.ToLower(re.ReplaceAllString(path, "${Base}"))
+	if len(b) < 7 {
+		return false
 	}
-	reNew := regexp.MustCompile("^(?P<Base>.*)(\\.part[0-9]+\\.rar)$")
-	re = reNew
-	if re.MatchString(path) {
-		return strings.ToLower(re.ReplaceAllString(path, "${Base}"))
-	}
-	reOld3 := regexp.MustCompile("^(?P<Base>.*)([0-9]{2,3}.rar)$")
-	re = reOld3
-	if re.MatchString(path) {
-		return strings.ToLower(re.ReplaceAllString(path, "${Base}"))
-	}
-	reOldInit := regexp.MustCompile("^(?P<Base>.*)(\\.rar)$")
-	re = reOldInit
-	if re.MatchString(path) {
-		return strings.ToLower(re.ReplaceAllString(path, "${Base}"))
-	}
-	return ""
+	t := RarHeaderType(b[2])
+	size := int(binary.LittleEndian.Uint16(b[5:7]))
+	return (t == EmptyHead || t >= SrrVolHead && t <= EndArcHead) && size >= 7 && size <= len(b)
+}
+
+// RarRootName returns the name shared by the volumes of the RAR set path
+// belongs to, in its original case, or "" when path is not a volume name.
+// It is the root returned by ParseVolumeName.
+func RarRootName(path string) string {
+	root, _, _, _ := ParseVolumeName(path)
+	return root
 }
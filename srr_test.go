@@ -0,0 +1,131 @@
+package rescene
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"path/filepath"
+	"testing"
+)
+
+// rarSubHead returns a RAR 2.x NT ACL block with its stored data.
+func rarSubHead(data []byte) []byte {
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, uint32(len(data)))
+	binary.Write(&body, binary.LittleEndian, NTACL_HEAD)
+	body.WriteByte(0)
+	binary.Write(&body, binary.LittleEndian, uint32(len(data)))
+	body.WriteByte(20)
+	body.WriteByte(0x30)
+	binary.Write(&body, binary.LittleEndian, crc32.ChecksumIEEE(data))
+	return append(rarBlock(SubHead, HAS_DATA, body.Bytes()), data...)
+}
+
+func TestSubHeadData(t *testing.T) {
+	dir := t.TempDir()
+	data := testData(100, 1)
+	acl := []byte("stored ACL data")
+	head := rarSubHead(acl)
+	v := rarMainHead(0)
+	v = append(v, rarFileHead(FileHead, 0, "file.bin", len(data), len(data), crc32.ChecksumIEEE(data), nil)...)
+	v = append(v, data...)
+	v = append(v, head...)
+	v = append(v, rarEndArc(0)...)
+	writeTestFile(t, filepath.Join(dir, "test.rar"), v)
+
+	var buf bytes.Buffer
+	if err := CreateSrr(&buf, []string{filepath.Join(dir, "test.rar")}, CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	kept := buf.Bytes()
+	i := bytes.Index(kept, head)
+	if i < 0 {
+		t.Fatal("CreateSrr does not keep the block data")
+	}
+	header := len(head) - len(acl)
+	stripped := append(append([]byte(nil), kept[:i+header]...), kept[i+len(head):]...)
+
+	for _, tt := range []struct {
+		name string
+		srr  []byte
+		data []byte
+	}{
+		{"kept", kept, acl},
+		{"stripped", stripped, nil},
+	} {
+		f := &SrrFile{}
+		if err := f.Unmarshal(tt.srr); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		r := f.RarFiles[0]
+		if r.Size != len(v) || !r.HasEndArc {
+			t.Errorf("%s: volume of %d bytes, end %v; want %d", tt.name, r.Size, r.HasEndArc, len(v))
+		}
+		if len(r.ACLs) != 1 || !bytes.Equal(r.ACLs[0].Data, tt.data) || r.ACLs[0].File != "file.bin" {
+			t.Errorf("%s: ACLs %+v", tt.name, r.ACLs)
+		}
+	}
+}
+
+func TestUnmarshalBlocks(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{"movie.mkv": testData(2500, 1)}
+	volumes := rarSplit(t, dir, "movie", 1000, files, "movie.mkv")
+	writeTestFile(t, filepath.Join(dir, "movie.nfo"), []byte("nfo"))
+	writeTestFile(t, filepath.Join(dir, "movie.mkv"), files["movie.mkv"])
+	paths := make([]string, len(volumes))
+	for i, v := range volumes {
+		paths[i] = filepath.Join(dir, v)
+	}
+	var buf bytes.Buffer
+	err := CreateSrr(&buf, paths, CreateOptions{
+		StoredFiles: []*CreateEntry{{Name: "movie.nfo", Path: filepath.Join(dir, "movie.nfo")}},
+		HashedFiles: []*CreateEntry{{Name: "movie.mkv", Path: filepath.Join(dir, "movie.mkv")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &SrrFile{}
+	if err = f.Unmarshal(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	var raw []byte
+	for i, block := range f.Blocks {
+		if block.Offset != len(raw) {
+			t.Errorf("block %d at %d, want %d", i, block.Offset, len(raw))
+		}
+		if block.Type == FileHead && block.Volume == nil {
+			t.Errorf("block %d has no volume", i)
+		}
+		raw = append(raw, block.Raw...)
+	}
+	if !bytes.Equal(raw, buf.Bytes()) {
+		t.Error("the raw blocks do not give the SRR back")
+	}
+}
+
+func TestUnmarshalTruncated(t *testing.T) {
+	vol := rarBlock(SrrVolHead, 0, nil)
+	vol[0], vol[1] = 0x69, 0x69
+	sizes := func(b []byte, size uint16) []byte {
+		b = append([]byte(nil), b...)
+		binary.LittleEndian.PutUint16(b[5:], size)
+		return b
+	}
+	tests := []struct {
+		name string
+		srr  []byte
+	}{
+		{"short header", append(append([]byte(nil), vol...), 0x7b, 0x00)},
+		{"end block past the end", append(append([]byte(nil), vol...), sizes(rarEndArc(0), 20)...)},
+		{"empty block of size 0", append(append([]byte(nil), vol...), make([]byte, 7)...)},
+		{"unknown block past the end", append(append([]byte(nil), vol...), sizes(rarBlock(0x7f, HAS_DATA, []byte{0xff, 0}), 20)...)},
+		{"unknown block data past the end", append(append([]byte(nil), vol...), rarBlock(0x7f, HAS_DATA, []byte{0xff, 0, 0, 0})...)},
+	}
+	for _, tt := range tests {
+		if err := (&SrrFile{}).Unmarshal(tt.srr); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
@@ -3,16 +3,12 @@ package rescene
 import (
 	"bytes"
 	"encoding/binary"
-	"io"
 	"log"
-	"strconv"
 
 	"github.com/rescene/mkvparse"
 
 	"github.com/h2non/filetype"
 	"github.com/h2non/filetype/matchers"
-	id3v1 "github.com/mikkyang/id3-go/v1"
-	id3v2 "github.com/mikkyang/id3-go/v2"
 	"golang.org/x/image/riff"
 )
 
@@ -20,21 +16,6 @@ type SrsFile struct {
 	Blocks []interface{}
 }
 
-type ID3v1Block struct {
-	Size int
-	Data []byte
-}
-
-type ID3v2Block struct {
-	Size int
-	Data []byte
-}
-
-type Lyrics200Block struct {
-	Size int
-	Data []byte
-}
-
 type Lyrics200SubBlock struct {
 	Lyrics200SubHeader
 	Data []byte
@@ -65,26 +46,45 @@ type SrsHeader struct {
 	Length uint32
 }
 
-func (sb *Lyrics200SubBlock) Size() (int, error) {
-	i, err := strconv.Atoi(string(sb.Lyrics200SubHeader.Len[:]))
-	if err != nil {
-		return 0, err
-	} else {
-		return 8 + i, nil
-	}
-}
-
 func (f *SrsFile) Unmarshal(b []byte) (err error) {
 	f.Blocks = make([]interface{}, 0)
 	offset := 0
+	apeStart, apeEnd := findApeTag(b)
 	for offset < len(b) {
+		start := offset
+		if offset == apeStart {
+			block := &ApeBlock{}
+			if err = block.UnmarshalFooter(b[apeStart:apeEnd]); err != nil {
+				return err
+			}
+			f.Blocks = append(f.Blocks, block)
+			offset += block.Size
+			continue
+		}
 		t, err := filetype.Get(b[offset:])
 		if err != nil {
 			return err
 		}
-		log.Printf("Offset %.5x (%.5d): %x (%s): %v (len : %d)\n", offset, offset, b[offset:offset+4], string(b[offset:offset+4]), t, len(b))
+		log.Printf("Offset %.5x (%.5d): %v (len : %d)\n", offset, offset, t, len(b))
+
+		if t == matchers.TypeMp3 && MpegMatcher(b[offset:]) {
+			// audio frames, not an ID3v2 tag
+			t = TypeMpeg
+		}
 
 		switch t {
+		case TypeMpeg:
+			block := &MpegBlock{}
+			end := len(b)
+			if apeStart > offset {
+				end = apeStart
+			}
+			err = block.Unmarshal(b[offset:end])
+			if err != nil {
+				return err
+			}
+			f.Blocks = append(f.Blocks, block)
+			offset += block.Size
 		case matchers.TypeMp3:
 			block := &ID3v2Block{}
 			err = block.Unmarshal(b[offset:])
@@ -118,6 +118,14 @@ func (f *SrsFile) Unmarshal(b []byte) (err error) {
 			}
 			f.Blocks = append(f.Blocks, block)
 			offset += block.Size
+		case TypeApe:
+			block := &ApeBlock{}
+			err = block.Unmarshal(b[offset:])
+			if err != nil {
+				return err
+			}
+			f.Blocks = append(f.Blocks, block)
+			offset += block.Size
 		case matchers.TypeMkv:
 			block := MkvBlock{}
 			err = block.Unmarshal(b[offset:])
@@ -139,80 +147,34 @@ func (f *SrsFile) Unmarshal(b []byte) (err error) {
 		default:
 			return nil
 		}
-
-	}
-	return nil
-}
-
-func (block *ID3v2Block) Unmarshal(b []byte) (err error) {
-	buf := bytes.NewBuffer(b)
-	readSeeker := bytes.NewReader(buf.Bytes())
-
-	if v2Tag := id3v2.ParseTag(readSeeker); v2Tag != nil {
-		block.Size = v2Tag.Size() + 10
-		for _, f := range v2Tag.AllFrames() {
-			log.Printf("id3v2 - Tag : %s : %s\n", f.Id(), f.String())
+		if offset <= start {
+			// a block that does not move on would be read forever
+			return ErrBadData
 		}
 	}
 	return nil
 }
 
-func (block *ID3v1Block) Unmarshal(b []byte) (err error) {
-	buf := bytes.NewBuffer(b)
-	readSeeker := bytes.NewReader(buf.Bytes())
-
-	if v1Tag := id3v1.ParseTag(readSeeker); v1Tag != nil {
-		block.Size = v1Tag.Size()
-		log.Printf("id3v1 - Tag : Title : %s\n", v1Tag.Title())
-		log.Printf("id3v1 - Tag : Album : %s\n", v1Tag.Album())
-		log.Printf("id3v1 - Tag : Artist : %s\n", v1Tag.Artist())
-		log.Printf("id3v1 - Tag : Year : %s\n", v1Tag.Year())
-		log.Printf("id3v1 - Tag : Genre : %s\n", v1Tag.Genre())
-		log.Printf("id3v1 - Tag : Comments : %s\n", v1Tag.Comments())
-	}
-	return nil
-}
-
+// Unmarshal reads the SRS block header at the start of b. The block must
+// hold at least its header and fit in b.
 func (block *SrsBlock) Unmarshal(b []byte) (err error) {
+	if len(b) < 8 {
+		return ErrBadData
+	}
 	buffer := bytes.NewBuffer(b[0:8])
 	header := &SrsHeader{}
 	err = binary.Read(buffer, binary.LittleEndian, header)
 	if err != nil {
 		return err
 	}
+	if header.Length < 8 || int64(header.Length) > int64(len(b)) {
+		return ErrBadData
+	}
 	block.SrsHeader = *header
 	block.Size = int(header.Length)
 	return nil
 }
 
-func (block *Lyrics200Block) Unmarshal(b []byte) (err error) {
-	offset := 11
-	for offset < len(b) {
-		if len(b[offset:]) < 15 {
-			return io.ErrUnexpectedEOF
-		}
-		if b[offset+6] == 'L' && b[offset+7] == 'Y' && b[offset+8] == 'R' && b[offset+9] == 'I' && b[offset+10] == 'C' && b[offset+11] == 'S' && b[offset+12] == '2' && b[offset+13] == '0' && b[offset+14] == '0' {
-			block.Data = b[0 : offset+15]
-			block.Size = len(block.Data)
-			return nil
-		}
-		buffer := bytes.NewBuffer(b[offset : offset+8])
-		header := &Lyrics200SubHeader{}
-		err = binary.Read(buffer, binary.LittleEndian, header)
-		subblock := &Lyrics200SubBlock{
-			Lyrics200SubHeader: *header,
-		}
-		s, err := subblock.Size()
-		if err != nil {
-			return err
-		}
-		subblock.Data = b[offset+8 : offset+s]
-		offset += s
-		log.Printf("Lyrics3v2 - Tag : %s : %s\n", string(subblock.Head[:]), string(subblock.Data[:]))
-	}
-	return nil
-}
-
 func (block *MkvBlock) Unmarshal(b []byte) (err error) {
 	handler := MyParser{}
 	buf := bytes.NewBuffer(b)
@@ -222,7 +184,18 @@ func (block *MkvBlock) Unmarshal(b []byte) (err error) {
 }
 
 func (block *AviBlock) Unmarshal(b []byte) (err error) {
-	buf := bytes.NewBuffer(b)
+	if len(b) < 12 {
+		return ErrBadData
+	}
+	// the RIFF chunk, padded to an even size
+	size := 8 + int(binary.LittleEndian.Uint32(b[4:8]))
+	size += size & 1
+	if size > len(b) {
+		size = len(b)
+	}
+	block.Size = size
+	block.Data = b[:size]
+	buf := bytes.NewBuffer(block.Data)
 	formType, r, err := riff.NewReader(buf)
 	if err != nil {
 		return err
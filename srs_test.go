@@ -0,0 +1,41 @@
+package rescene
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// srsOf returns an SRS file holding the file data of a sample.
+func srsOf(name string, sample []byte) []byte {
+	fd := srsFileData(0, name, sample)
+	srs := append([]byte("SRSF"), make([]byte, 4)...)
+	binary.LittleEndian.PutUint32(srs[4:], uint32(8+len(fd)))
+	return append(srs, fd...)
+}
+
+func TestSrsBlockBounds(t *testing.T) {
+	long := srsOf("sample.mp3", testData(10, 1))
+	binary.LittleEndian.PutUint32(long[4:], uint32(len(long)+1))
+	tests := []struct {
+		name string
+		srs  []byte
+	}{
+		{"short header", []byte("SRSF\x00")},
+		{"length 0", []byte("SRSF\x00\x00\x00\x00")},
+		{"length below the header", []byte("SRSF\x07\x00\x00\x00")},
+		{"length past the end", long},
+	}
+	for _, tt := range tests {
+		if err := (&SrsFile{}).Unmarshal(tt.srs); err != ErrBadData {
+			t.Errorf("%s: %v, want ErrBadData", tt.name, err)
+		}
+	}
+
+	f := &SrsFile{}
+	if err := f.Unmarshal(srsOf("sample.mp3", testData(10, 1))); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Blocks) != 1 {
+		t.Errorf("got %d blocks, want 1", len(f.Blocks))
+	}
+}
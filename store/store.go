@@ -0,0 +1,599 @@
+// Package store keeps a searchable index of a directory tree of SRR files,
+// the way srrDB lists releases: by release name, with the names, sizes and
+// CRCs of what the SRRs describe.
+//
+// The index lives in a single bbolt database file. Releases are kept as
+// JSON, with secondary indexes for CRC, OSO hash and size lookups.
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rescene/rescene"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketReleases = []byte("releases")
+	bucketFiles    = []byte("files")
+	bucketCRC      = []byte("crc")
+	bucketOSO      = []byte("oso")
+	bucketSize     = []byte("size")
+)
+
+// Release is what the store keeps of an SRR. Name is the release name, the
+// base name of the SRR without its extension. SRRs of the same name found
+// in several directories are kept apart, by Path.
+type Release struct {
+	Name            string     `json:"name"`
+	Path            string     `json:"path"`
+	Size            int64      `json:"size"`
+	ModTime         time.Time  `json:"mod_time"`
+	ApplicationName string     `json:"application_name"`
+	Compressed      bool       `json:"compressed"`
+	StoredFiles     []*File    `json:"stored_files"`
+	RarFiles        []*File    `json:"rar_files"`
+	PackedFiles     []*File    `json:"packed_files"`
+	OSOHashes       []*OSOHash `json:"oso_hashes"`
+}
+
+// File is a stored file, a RAR volume or a packed file of a release. CRC is
+// 0 for stored files and for volumes missing from the SFV.
+type File struct {
+	Name string `json:"name"`
+	Size uint64 `json:"size"`
+	CRC  uint32 `json:"crc,omitempty"`
+}
+
+// OSOHash is an OpenSubtitles hash kept in the SRR.
+type OSOHash struct {
+	Name string `json:"name"`
+	Size uint64 `json:"size"`
+	Hash uint64 `json:"hash"`
+}
+
+// IndexResult tells what Index did. Errors holds the SRRs that could not be
+// read or parsed, by path; they are left out of the store. Duplicates lists
+// the paths of the SRRs sharing a release name, by name.
+type IndexResult struct {
+	Added      int
+	Updated    int
+	Removed    int
+	Unchanged  int
+	Errors     map[string]error
+	Duplicates map[string][]string
+}
+
+// Store is an index of SRR files.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens the store kept in the database file path, creating it when
+// needed.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketReleases, bucketFiles, bucketCRC, bucketOSO, bucketSize} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// NewRelease returns what the store keeps of an SRR.
+func NewRelease(name string, f *rescene.SrrFile) *Release {
+	r := &Release{
+		Name:            name,
+		ApplicationName: f.ApplicationName,
+		Compressed:      f.RarCompressed,
+		StoredFiles:     make([]*File, 0, len(f.StoredFiles)),
+		RarFiles:        make([]*File, 0, len(f.RarFiles)),
+		PackedFiles:     make([]*File, 0, len(f.PackedFiles)),
+		OSOHashes:       make([]*OSOHash, 0, len(f.OSOHashes)),
+	}
+	for _, v := range f.StoredFiles {
+		r.StoredFiles = append(r.StoredFiles, &File{Name: v.Path, Size: uint64(len(v.Data))})
+	}
+	for _, v := range f.RarFiles {
+		r.RarFiles = append(r.RarFiles, &File{Name: v.Path, Size: uint64(v.Size), CRC: v.CRC})
+	}
+	for _, v := range f.PackedFiles {
+		r.PackedFiles = append(r.PackedFiles, &File{Name: v.Path, Size: v.Size, CRC: v.CRC})
+	}
+	for _, v := range f.OSOHashes {
+		r.OSOHashes = append(r.OSOHashes, &OSOHash{Name: v.Path, Size: v.Size, Hash: v.Hash})
+	}
+	return r
+}
+
+// ReleaseName returns the release name of an SRR file.
+func ReleaseName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// releaseKey is the key of a release: its name followed by the path of its
+// SRR.
+func releaseKey(name, path string) string {
+	return name + "\x00" + path
+}
+
+func (r *Release) key() string {
+	return releaseKey(r.Name, r.Path)
+}
+
+// indexKey is the key of a secondary index entry: the value followed by
+// the release key.
+func indexKey(value []byte, key string) []byte {
+	return append(append(value, 0), key...)
+}
+
+func crcKey(crc uint32) []byte {
+	return []byte(fmt.Sprintf("%08x", crc))
+}
+
+func osoKey(hash uint64) []byte {
+	return []byte(fmt.Sprintf("%016x", hash))
+}
+
+func sizeKey(size uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, size)
+	return b
+}
+
+// keys returns the secondary index keys of a release.
+func (r *Release) keys() map[string][][]byte {
+	keys := map[string][][]byte{}
+	add := func(bucket []byte, value []byte) {
+		keys[string(bucket)] = append(keys[string(bucket)], indexKey(value, r.key()))
+	}
+	for _, v := range r.PackedFiles {
+		if v.CRC != 0 {
+			add(bucketCRC, crcKey(v.CRC))
+		}
+		add(bucketSize, sizeKey(v.Size))
+	}
+	for _, v := range r.RarFiles {
+		if v.CRC != 0 {
+			add(bucketCRC, crcKey(v.CRC))
+		}
+	}
+	for _, v := range r.OSOHashes {
+		add(bucketOSO, osoKey(v.Hash))
+		add(bucketSize, sizeKey(v.Size))
+	}
+	return keys
+}
+
+// put stores a release, replacing the one of the same name and path.
+func put(tx *bolt.Tx, r *Release) error {
+	if err := remove(tx, r.key()); err != nil {
+		return err
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err = tx.Bucket(bucketReleases).Put([]byte(r.key()), b); err != nil {
+		return err
+	}
+	for bucket, keys := range r.keys() {
+		for _, k := range keys {
+			if err = tx.Bucket([]byte(bucket)).Put(k, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// remove deletes a release and its index entries.
+func remove(tx *bolt.Tx, key string) error {
+	old, err := get(tx, key)
+	if err != nil || old == nil {
+		return err
+	}
+	for bucket, keys := range old.keys() {
+		for _, k := range keys {
+			if err = tx.Bucket([]byte(bucket)).Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Bucket(bucketReleases).Delete([]byte(key))
+}
+
+func get(tx *bolt.Tx, key string) (*Release, error) {
+	b := tx.Bucket(bucketReleases).Get([]byte(key))
+	if b == nil {
+		return nil, nil
+	}
+	r := &Release{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Put adds or replaces a release.
+func (s *Store) Put(r *Release) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, r)
+	})
+}
+
+// byName returns the releases of a name, ordered by path.
+func byName(tx *bolt.Tx, name string) ([]*Release, error) {
+	releases := make([]*Release, 0)
+	prefix := []byte(releaseKey(name, ""))
+	c := tx.Bucket(bucketReleases).Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		r := &Release{}
+		if err := json.Unmarshal(v, r); err != nil {
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+	return releases, nil
+}
+
+// Delete removes the releases of a name, if present.
+func (s *Store) Delete(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		releases, err := byName(tx, name)
+		if err != nil {
+			return err
+		}
+		for _, r := range releases {
+			if err = remove(tx, r.key()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Get returns a release by name, rescene.ErrNotFound when it is unknown.
+// When several SRRs share the name, the first by path is returned; see
+// Releases.
+func (s *Store) Get(name string) (*Release, error) {
+	releases, err := s.Releases(name)
+	if err == nil && len(releases) == 0 {
+		err = rescene.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return releases[0], nil
+}
+
+// Releases returns the releases of a name, one by SRR, ordered by path.
+func (s *Store) Releases(name string) ([]*Release, error) {
+	var releases []*Release
+	err := s.db.View(func(tx *bolt.Tx) (err error) {
+		releases, err = byName(tx, name)
+		return err
+	})
+	return releases, err
+}
+
+// Index adds the SRR files found under root to the store. Files already
+// indexed are only parsed again when their size or modification time
+// changed, and the releases whose SRR is gone from root are removed. SRRs
+// of the same release name are all kept and reported as duplicates.
+func (s *Store) Index(root string) (*IndexResult, error) {
+	result := &IndexResult{
+		Errors:     make(map[string]error),
+		Duplicates: make(map[string][]string),
+	}
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			result.Errors[p] = err
+			return nil
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(p), ".srr") {
+			return nil
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		seen[abs] = true
+		info, err := d.Info()
+		if err != nil {
+			result.Errors[p] = err
+			return nil
+		}
+		return s.indexFile(abs, info, result)
+	})
+	if err != nil {
+		return result, err
+	}
+	if err = s.prune(root, seen, result); err != nil {
+		return result, err
+	}
+	return result, s.duplicates(seen, result)
+}
+
+// duplicates lists the release names shared by several SRRs, one of them
+// at least among those seen.
+func (s *Store) duplicates(seen map[string]bool, result *IndexResult) error {
+	paths := make(map[string][]string)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketReleases).ForEach(func(k, v []byte) error {
+			if i := bytes.IndexByte(k, 0); i >= 0 {
+				name := string(k[:i])
+				paths[name] = append(paths[name], string(k[i+1:]))
+			}
+			return nil
+		})
+	})
+	for name, p := range paths {
+		if len(p) < 2 {
+			continue
+		}
+		for _, v := range p {
+			if seen[v] {
+				result.Duplicates[name] = p
+				break
+			}
+		}
+	}
+	return err
+}
+
+// indexFile parses an SRR again unless it did not change since the last
+// Index.
+func (s *Store) indexFile(p string, info fs.FileInfo, result *IndexResult) error {
+	name := ReleaseName(p)
+	var old *Release
+	err := s.db.View(func(tx *bolt.Tx) (err error) {
+		if k := tx.Bucket(bucketFiles).Get([]byte(p)); k != nil {
+			old, err = get(tx, string(k))
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if old != nil && old.Size == info.Size() && old.ModTime.Equal(info.ModTime()) {
+		result.Unchanged++
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		result.Errors[p] = err
+		return nil
+	}
+	f := &rescene.SrrFile{}
+	if err = f.Unmarshal(b); err != nil {
+		result.Errors[p] = err
+		return nil
+	}
+	r := NewRelease(name, f)
+	r.Path = p
+	r.Size = info.Size()
+	r.ModTime = info.ModTime()
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		if err := put(tx, r); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketFiles).Put([]byte(p), []byte(r.key()))
+	})
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		result.Updated++
+	} else {
+		result.Added++
+	}
+	return nil
+}
+
+// prune removes the releases of the SRRs under root that were not seen.
+func (s *Store) prune(root string, seen map[string]bool, result *IndexResult) error {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	prefix := abs + string(filepath.Separator)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		files := tx.Bucket(bucketFiles)
+		gone := make([][]byte, 0)
+		err := files.ForEach(func(k, v []byte) error {
+			p := string(k)
+			if (p == abs || strings.HasPrefix(p, prefix)) && !seen[p] {
+				gone = append(gone, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range gone {
+			key := string(files.Get(k))
+			if r, err := get(tx, key); err == nil && r != nil {
+				if err = remove(tx, key); err != nil {
+					return err
+				}
+				result.Removed++
+			}
+			if err = files.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// lookup returns the releases listed in an index bucket under value.
+func (s *Store) lookup(bucket, value []byte) ([]*Release, error) {
+	releases := make([]*Release, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := append(value, 0)
+		c := tx.Bucket(bucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			r, err := get(tx, string(k[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			if r != nil {
+				releases = append(releases, r)
+			}
+		}
+		return nil
+	})
+	return releases, err
+}
+
+// ByCRC returns the releases with a packed file or a volume of this CRC.
+func (s *Store) ByCRC(crc uint32) ([]*Release, error) {
+	return s.lookup(bucketCRC, crcKey(crc))
+}
+
+// ByOSOHash returns the releases with this OSO hash.
+func (s *Store) ByOSOHash(hash uint64) ([]*Release, error) {
+	return s.lookup(bucketOSO, osoKey(hash))
+}
+
+// BySize returns the releases with a packed file, or a file with an OSO
+// hash, of this size.
+func (s *Store) BySize(size uint64) ([]*Release, error) {
+	return s.lookup(bucketSize, sizeKey(size))
+}
+
+// ByName returns the releases with a packed or stored file whose name, or
+// base name, matches the path.Match pattern, case being ignored. The
+// pattern is tried against the release name too.
+func (s *Store) ByName(pattern string) ([]*Release, error) {
+	pattern = strings.ToLower(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	match := func(name string) bool {
+		name = strings.ToLower(strings.ReplaceAll(name, "\\", "/"))
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	releases := make([]*Release, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketReleases).ForEach(func(k, v []byte) error {
+			r := &Release{}
+			if err := json.Unmarshal(v, r); err != nil {
+				return err
+			}
+			found := match(r.Name)
+			for _, files := range [][]*File{r.PackedFiles, r.StoredFiles} {
+				for _, f := range files {
+					found = found || match(f.Name)
+				}
+			}
+			if found {
+				releases = append(releases, r)
+			}
+			return nil
+		})
+	})
+	return releases, err
+}
+
+// Names returns the names of all the releases, sorted, once each.
+func (s *Store) Names() ([]string, error) {
+	names := make([]string, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketReleases).ForEach(func(k, v []byte) error {
+			if i := bytes.IndexByte(k, 0); i >= 0 {
+				k = k[:i]
+			}
+			if n := len(names); n == 0 || names[n-1] != string(k) {
+				names = append(names, string(k))
+			}
+			return nil
+		})
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// Identify hashes a file and looks for it in the store, see Match.
+func (s *Store) Identify(path string) (*rescene.FileHashes, []*rescene.FileMatch, error) {
+	h, err := rescene.HashFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	matches, err := s.Match(h)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h, matches, nil
+}
+
+// Match looks for the file of the hashes in the releases of the store with
+// a file of the same CRC or OSO hash, see rescene.FileHashes.Match.
+func (s *Store) Match(h *rescene.FileHashes) ([]*rescene.FileMatch, error) {
+	byCRC, err := s.ByCRC(h.CRC)
+	if err != nil {
+		return nil, err
+	}
+	byOSO, err := s.ByOSOHash(h.OSOHash)
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]*rescene.FileMatch, 0)
+	seen := make(map[string]bool)
+	for _, r := range append(byCRC, byOSO...) {
+		if seen[r.key()] {
+			continue
+		}
+		seen[r.key()] = true
+		matches = append(matches, h.Match(r.Name, r.srr())...)
+	}
+	return matches, nil
+}
+
+// srr returns what Match needs of the release as an SRR.
+func (r *Release) srr() *rescene.SrrFile {
+	f := &rescene.SrrFile{}
+	for _, v := range r.RarFiles {
+		f.RarFiles = append(f.RarFiles, &rescene.RarFile{Path: v.Name, Size: int(v.Size), CRC: v.CRC})
+	}
+	for _, v := range r.PackedFiles {
+		f.PackedFiles = append(f.PackedFiles, &rescene.PackedFile{Path: v.Name, Size: v.Size, CRC: v.CRC})
+	}
+	for _, v := range r.OSOHashes {
+		f.OSOHashes = append(f.OSOHashes, &rescene.OSOHash{Path: v.Name, Size: v.Size, Hash: v.Hash})
+	}
+	return f
+}
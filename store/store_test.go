@@ -0,0 +1,238 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rescene/rescene"
+)
+
+func rarBlock(t rescene.RarHeaderType, flags rescene.RarHeaderFlag, body []byte) []byte {
+	b := make([]byte, 7, 7+len(body))
+	b[2] = byte(t)
+	binary.LittleEndian.PutUint16(b[3:], uint16(flags))
+	binary.LittleEndian.PutUint16(b[5:], uint16(7+len(body)))
+	b = append(b, body...)
+	binary.LittleEndian.PutUint16(b, uint16(crc32.ChecksumIEEE(b[2:])))
+	return b
+}
+
+// storedRar returns a single volume storing one file.
+func storedRar(name string, data []byte) []byte {
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, uint32(len(data)))
+	binary.Write(&body, binary.LittleEndian, uint32(len(data)))
+	body.WriteByte(2)
+	binary.Write(&body, binary.LittleEndian, crc32.ChecksumIEEE(data))
+	binary.Write(&body, binary.LittleEndian, uint32(0x5a000000))
+	body.WriteByte(29)
+	body.WriteByte(0x30)
+	binary.Write(&body, binary.LittleEndian, uint16(len(name)))
+	binary.Write(&body, binary.LittleEndian, uint32(0x20))
+	body.WriteString(name)
+	v := []byte{0x52, 0x61, 0x72, 0x21, 0x1A, 0x07, 0x00}
+	v = append(v, rarBlock(rescene.MainHead, 0, make([]byte, 6))...)
+	v = append(v, rarBlock(rescene.FileHead, rescene.HAS_DATA, body.Bytes())...)
+	v = append(v, data...)
+	return append(v, rarBlock(rescene.EndArcHead, 0, nil)...)
+}
+
+func testData(n int, seed byte) []byte {
+	b := make([]byte, n)
+	x := uint32(seed) + 1
+	for i := range b {
+		x = x*1664525 + 1013904223
+		b[i] = byte(x >> 24)
+	}
+	return b
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeSrr writes the SRR of a release storing data as name.mkv, with an
+// NFO and an OSO hash of the packed file, and returns its path.
+func writeSrr(t *testing.T, dir, srrDir, name string, data []byte) string {
+	t.Helper()
+	rel := filepath.Join(dir, "releases", filepath.Base(srrDir), name)
+	writeFile(t, filepath.Join(rel, name+".rar"), storedRar(name+".mkv", data))
+	writeFile(t, filepath.Join(rel, name+".nfo"), []byte("nfo of "+name))
+	writeFile(t, filepath.Join(rel, name+".mkv"), data)
+	var buf bytes.Buffer
+	err := rescene.CreateSrr(&buf, []string{filepath.Join(rel, name+".rar")}, rescene.CreateOptions{
+		StoredFiles: []*rescene.CreateEntry{{Name: name + ".nfo", Path: filepath.Join(rel, name+".nfo")}},
+		HashedFiles: []*rescene.CreateEntry{{Name: name + ".mkv", Path: filepath.Join(rel, name+".mkv")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(srrDir, name+".srr")
+	writeFile(t, path, buf.Bytes())
+	return path
+}
+
+func openStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func names(releases []*Release) []string {
+	n := make([]string, len(releases))
+	for i, r := range releases {
+		n[i] = r.Name
+	}
+	return n
+}
+
+func TestIndex(t *testing.T) {
+	dir := t.TempDir()
+	srrs := filepath.Join(dir, "srrs")
+	one := testData(3000, 1)
+	two := testData(5000, 2)
+	writeSrr(t, dir, srrs, "Group.One", one)
+	twoPath := writeSrr(t, dir, srrs, "Group.Two", two)
+	s := openStore(t)
+
+	result, err := s.Index(srrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Added != 2 || len(result.Errors) != 0 || len(result.Duplicates) != 0 {
+		t.Fatalf("first index: %+v", result)
+	}
+	if n, err := s.Names(); err != nil || len(n) != 2 || n[0] != "Group.One" || n[1] != "Group.Two" {
+		t.Errorf("Names() = %v, %v", n, err)
+	}
+	r, err := s.Get("Group.Two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Path != twoPath || len(r.RarFiles) != 1 || len(r.PackedFiles) != 1 || len(r.StoredFiles) != 1 || len(r.OSOHashes) != 1 {
+		t.Errorf("release %+v", r)
+	}
+
+	lookups := []struct {
+		name string
+		find func() ([]*Release, error)
+		want string
+	}{
+		{"crc", func() ([]*Release, error) { return s.ByCRC(crc32.ChecksumIEEE(one)) }, "Group.One"},
+		{"size", func() ([]*Release, error) { return s.BySize(5000) }, "Group.Two"},
+		{"oso", func() ([]*Release, error) { return s.ByOSOHash(r.OSOHashes[0].Hash) }, "Group.Two"},
+		{"stored name", func() ([]*Release, error) { return s.ByName("group.one.NFO") }, "Group.One"},
+		{"release name", func() ([]*Release, error) { return s.ByName("*.two") }, "Group.Two"},
+	}
+	for _, l := range lookups {
+		found, err := l.find()
+		if err != nil || len(found) != 1 || found[0].Name != l.want {
+			t.Errorf("%s: found %v, %v; want %s", l.name, names(found), err, l.want)
+		}
+	}
+	if found, err := s.ByCRC(0x12345678); err != nil || len(found) != 0 {
+		t.Errorf("unknown CRC: found %v, %v", names(found), err)
+	}
+	if _, err := s.Get("Group.Three"); err != rescene.ErrNotFound {
+		t.Errorf("unknown release: %v", err)
+	}
+
+	if result, err = s.Index(srrs); err != nil || result.Unchanged != 2 || result.Added+result.Updated+result.Removed != 0 {
+		t.Errorf("second index: %+v, %v", result, err)
+	}
+	if err = os.Remove(twoPath); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = s.Index(srrs); err != nil || result.Removed != 1 || result.Unchanged != 1 {
+		t.Errorf("index after a removal: %+v, %v", result, err)
+	}
+	if found, err := s.BySize(5000); err != nil || len(found) != 0 {
+		t.Errorf("removed release still found: %v, %v", names(found), err)
+	}
+}
+
+func TestIndexDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	srrs := filepath.Join(dir, "srrs")
+	a := writeSrr(t, dir, filepath.Join(srrs, "a"), "Group.Same", testData(3000, 1))
+	b := writeSrr(t, dir, filepath.Join(srrs, "b"), "Group.Same", testData(4000, 2))
+	s := openStore(t)
+
+	result, err := s.Index(srrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Added != 2 {
+		t.Errorf("added %d releases, want 2", result.Added)
+	}
+	if d := result.Duplicates["Group.Same"]; len(d) != 2 || d[0] != a || d[1] != b {
+		t.Errorf("duplicates %v", result.Duplicates)
+	}
+	releases, err := s.Releases("Group.Same")
+	if err != nil || len(releases) != 2 {
+		t.Fatalf("Releases() = %d, %v", len(releases), err)
+	}
+	for i, size := range []uint64{3000, 4000} {
+		found, err := s.BySize(size)
+		if err != nil || len(found) != 1 || found[0].Path != releases[i].Path {
+			t.Errorf("size %d: found %v, %v", size, found, err)
+		}
+	}
+	if n, err := s.Names(); err != nil || len(n) != 1 {
+		t.Errorf("Names() = %v, %v", n, err)
+	}
+
+	if err = os.Remove(b); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = s.Index(srrs); err != nil || result.Removed != 1 || len(result.Duplicates) != 0 {
+		t.Errorf("index after a removal: %+v, %v", result, err)
+	}
+	if r, err := s.Get("Group.Same"); err != nil || r.Path != a {
+		t.Errorf("Get() = %+v, %v", r, err)
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	dir := t.TempDir()
+	srrs := filepath.Join(dir, "srrs")
+	data := testData(100, 1)
+	writeSrr(t, dir, srrs, "Group.One", data)
+	writeSrr(t, dir, srrs, "Group.Two", testData(200, 2))
+	s := openStore(t)
+	if _, err := s.Index(srrs); err != nil {
+		t.Fatal(err)
+	}
+
+	movie := filepath.Join(dir, "releases", "srrs", "Group.One", "Group.One.mkv")
+	h, matches, err := s.Identify(movie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Size != 100 || len(matches) != 2 {
+		t.Fatalf("%+v: %d matches, want 2", h, len(matches))
+	}
+	for i, role := range []string{rescene.RolePackedFile, rescene.RoleOSOHash} {
+		if m := matches[i]; m.Release != "Group.One" || m.Role != role || m.Name != "Group.One.mkv" {
+			t.Errorf("match %d is %+v, want %s", i, m, role)
+		}
+	}
+	if _, matches, err = s.Identify(filepath.Join(dir, "releases", "srrs", "Group.One", "Group.One.nfo")); err != nil || len(matches) != 0 {
+		t.Errorf("NFO: %d matches, %v", len(matches), err)
+	}
+}
@@ -0,0 +1,339 @@
+package rescene
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// ID3v1Block is an ID3v1 tag, the last 128 bytes of an MP3. Track is only
+// set by ID3v1.1 tags, which take the last two bytes of the comment for it.
+type ID3v1Block struct {
+	Size    int
+	Data    []byte
+	Title   string
+	Artist  string
+	Album   string
+	Year    string
+	Comment string
+	Track   uint8
+	Genre   uint8
+}
+
+// Lyrics200Block is a Lyrics3 v2.00 tag, found before the ID3v1 tag.
+type Lyrics200Block struct {
+	Size        int
+	Data        []byte
+	Fields      []*Lyrics200SubBlock
+	Indications string // IND
+	Lyrics      string // LYR
+	Info        string // INF
+	Author      string // AUT
+	Album       string // EAL
+	Artist      string // EAR
+	Title       string // ETT
+}
+
+const (
+	APE_HAS_HEADER uint32 = 1 << 31
+	APE_NO_FOOTER  uint32 = 1 << 30
+	APE_IS_HEADER  uint32 = 1 << 29
+	APE_READ_ONLY  uint32 = 1
+	APE_TYPE_MASK  uint32 = 6
+	APE_UTF8       uint32 = 0
+	APE_BINARY     uint32 = 2
+	APE_LOCATOR    uint32 = 4
+)
+
+// ApeBlock is an APE tag, header included when it has one. Flags are the
+// tag flags of the footer or header (APE_HAS_HEADER...). Version is 1000
+// for APEv1 and 2000 for APEv2.
+type ApeBlock struct {
+	Size    int
+	Data    []byte
+	Version uint32
+	Flags   uint32
+	Items   []*ApeItem
+}
+
+// ApeItem is an item of an APE tag. The value is UTF-8 text unless the
+// type of Flags is APE_BINARY.
+type ApeItem struct {
+	Key   string
+	Flags uint32
+	Value []byte
+}
+
+type apeHeader struct {
+	Preamble [8]byte
+	Version  uint32
+	Size     uint32
+	Count    uint32
+	Flags    uint32
+	Reserved [8]byte
+}
+
+// id3v1Genres are the genre names of ID3v1, Winamp extensions included.
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge",
+	"Hip-Hop", "Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B",
+	"Rap", "Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska",
+	"Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient",
+	"Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical",
+	"Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative",
+	"Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic", "Darkwave",
+	"Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap",
+	"Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave",
+	"Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi", "Tribal",
+	"Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll",
+	"Hard Rock", "Folk", "Folk-Rock", "National Folk", "Swing",
+	"Fast Fusion", "Bebob", "Latin", "Revival", "Celtic", "Bluegrass",
+	"Avantgarde", "Gothic Rock", "Progressive Rock", "Psychedelic Rock",
+	"Symphonic Rock", "Slow Rock", "Big Band", "Chorus", "Easy Listening",
+	"Acoustic", "Humour", "Speech", "Chanson", "Opera", "Chamber Music",
+	"Sonata", "Symphony", "Booty Bass", "Primus", "Porn Groove", "Satire",
+	"Slow Jam", "Club", "Tango", "Samba", "Folklore", "Ballad",
+	"Power Ballad", "Rhythmic Soul", "Freestyle", "Duet", "Punk Rock",
+	"Drum Solo", "A capella", "Euro-House", "Dance Hall", "Goa",
+	"Drum & Bass", "Club-House", "Hardcore", "Terror", "Indie", "BritPop",
+	"Negerpunk", "Polsk Punk", "Beat", "Christian Gangsta Rap",
+	"Heavy Metal", "Black Metal", "Crossover", "Contemporary Christian",
+	"Christian Rock", "Merengue", "Salsa", "Thrash Metal", "Anime", "JPop",
+	"Synthpop", "Abstract", "Art Rock", "Baroque", "Bhangra", "Big Beat",
+	"Breakbeat", "Chillout", "Downtempo", "Dub", "EBM", "Eclectic",
+	"Electro", "Electroclash", "Emo", "Experimental", "Garage", "Global",
+	"IDM", "Illbient", "Industro-Goth", "Jam Band", "Krautrock", "Leftfield",
+	"Lounge", "Math Rock", "New Romantic", "Nu-Breakz", "Post-Punk",
+	"Post-Rock", "Psytrance", "Shoegaze", "Space Rock", "Trop Rock",
+	"World Music", "Neoclassical", "Audiobook", "Audio Theatre",
+	"Neue Deutsche Welle", "Podcast", "Indie Rock", "G-Funk", "Dubstep",
+	"Garage Rock", "Psybient",
+}
+
+func id3v1String(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	s, err := charmap.ISO8859_1.NewDecoder().Bytes(b)
+	if err != nil {
+		s = b
+	}
+	return strings.TrimRight(string(s), " ")
+}
+
+func (block *ID3v1Block) Unmarshal(b []byte) (err error) {
+	if len(b) < 128 || string(b[0:3]) != "TAG" {
+		return ErrBadData
+	}
+	block.Size = 128
+	block.Data = b[:128]
+	block.Title = id3v1String(b[3:33])
+	block.Artist = id3v1String(b[33:63])
+	block.Album = id3v1String(b[63:93])
+	block.Year = id3v1String(b[93:97])
+	comment := b[97:127]
+	if comment[28] == 0 && comment[29] != 0 {
+		block.Track = comment[29]
+		comment = comment[:28]
+	}
+	block.Comment = id3v1String(comment)
+	block.Genre = b[127]
+	return nil
+}
+
+// GenreName returns the name of the genre, "" for 255 (none) and the
+// numbers without a name.
+func (block *ID3v1Block) GenreName() string {
+	if int(block.Genre) < len(id3v1Genres) {
+		return id3v1Genres[block.Genre]
+	}
+	return ""
+}
+
+func (sb *Lyrics200SubBlock) Size() (int, error) {
+	i, err := strconv.Atoi(string(sb.Lyrics200SubHeader.Len[:]))
+	if err != nil {
+		return 0, err
+	} else {
+		return 8 + i, nil
+	}
+}
+
+func (block *Lyrics200Block) Unmarshal(b []byte) (err error) {
+	block.Fields = make([]*Lyrics200SubBlock, 0)
+	offset := 11
+	for offset < len(b) {
+		if len(b[offset:]) < 15 {
+			return io.ErrUnexpectedEOF
+		}
+		if string(b[offset+6:offset+15]) == "LYRICS200" {
+			block.Data = b[0 : offset+15]
+			block.Size = len(block.Data)
+			return nil
+		}
+		buffer := bytes.NewBuffer(b[offset : offset+8])
+		header := &Lyrics200SubHeader{}
+		err = binary.Read(buffer, binary.LittleEndian, header)
+		if err != nil {
+			return err
+		}
+		subblock := &Lyrics200SubBlock{
+			Lyrics200SubHeader: *header,
+		}
+		s, err := subblock.Size()
+		if err != nil {
+			return err
+		}
+		if offset+s > len(b) {
+			return io.ErrUnexpectedEOF
+		}
+		subblock.Data = b[offset+8 : offset+s]
+		offset += s
+		block.Fields = append(block.Fields, subblock)
+		value := string(subblock.Data)
+		switch string(subblock.Head[:]) {
+		case "IND":
+			block.Indications = value
+		case "LYR":
+			block.Lyrics = value
+		case "INF":
+			block.Info = value
+		case "AUT":
+			block.Author = value
+		case "EAL":
+			block.Album = value
+		case "EAR":
+			block.Artist = value
+		case "ETT":
+			block.Title = value
+		}
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// Unmarshal reads an APE tag starting with its header. APEv1 tags and APEv2
+// tags without header can not be told from audio data when reading forward:
+// they are found from their footer by UnmarshalFooter.
+func (block *ApeBlock) Unmarshal(b []byte) (err error) {
+	header, err := readApeHeader(b)
+	if err != nil {
+		return err
+	}
+	if header.Flags&APE_IS_HEADER == 0 {
+		return ErrBadData
+	}
+	// the size counts the items and the footer, not the header
+	size := 32 + int(header.Size)
+	if size > len(b) {
+		return ErrBadData
+	}
+	items := b[32:size]
+	if header.Flags&APE_NO_FOOTER == 0 && len(items) >= 32 {
+		items = items[:len(items)-32]
+	}
+	return block.readItems(b[:size], header, items)
+}
+
+// UnmarshalFooter reads the APE tag that ends b with its footer, going
+// backwards to its first item or to its header.
+func (block *ApeBlock) UnmarshalFooter(b []byte) (err error) {
+	if len(b) < 32 {
+		return ErrBadData
+	}
+	footer, err := readApeHeader(b[len(b)-32:])
+	if err != nil {
+		return err
+	}
+	if footer.Flags&APE_IS_HEADER != 0 || footer.Size < 32 {
+		return ErrBadData
+	}
+	size := int(footer.Size)
+	if footer.Version >= 2000 && footer.Flags&APE_HAS_HEADER != 0 {
+		size += 32
+	}
+	if size > len(b) {
+		return ErrBadData
+	}
+	items := b[len(b)-int(footer.Size) : len(b)-32]
+	return block.readItems(b[len(b)-size:], footer, items)
+}
+
+func readApeHeader(b []byte) (*apeHeader, error) {
+	if len(b) < 32 {
+		return nil, ErrBadData
+	}
+	header := &apeHeader{}
+	if err := binary.Read(bytes.NewReader(b[:32]), binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+	if string(header.Preamble[:]) != "APETAGEX" {
+		return nil, ErrBadData
+	}
+	return header, nil
+}
+
+// readItems sets the block from the whole tag in data and its items.
+func (block *ApeBlock) readItems(data []byte, header *apeHeader, items []byte) error {
+	block.Size = len(data)
+	block.Data = data
+	block.Version = header.Version
+	block.Flags = header.Flags
+	// Count is not trusted: the loop stops when the items run out
+	block.Items = make([]*ApeItem, 0)
+	for i := 0; i < int(header.Count) && len(items) >= 8; i++ {
+		n := int(binary.LittleEndian.Uint32(items))
+		item := &ApeItem{Flags: binary.LittleEndian.Uint32(items[4:])}
+		end := bytes.IndexByte(items[8:], 0)
+		if end < 0 || n < 0 || 8+end+1+n > len(items) {
+			return ErrBadData
+		}
+		item.Key = string(items[8 : 8+end])
+		item.Value = items[8+end+1 : 8+end+1+n]
+		block.Items = append(block.Items, item)
+		items = items[8+end+1+n:]
+	}
+	return nil
+}
+
+// findApeTag locates an APE tag by its footer, which ends b or comes before
+// the Lyrics3 v2.00 and ID3v1 tags ending b. It returns the bounds of the
+// tag, header included, or -1 when there is none.
+func findApeTag(b []byte) (start, end int) {
+	end = len(b)
+	if end >= 128 && string(b[end-128:end-125]) == "TAG" {
+		end -= 128
+	}
+	if end >= 15 && string(b[end-9:end]) == "LYRICS200" {
+		n, err := strconv.Atoi(string(b[end-15 : end-9]))
+		if err == nil && n >= 11 && n+15 <= end && string(b[end-15-n:end-15-n+11]) == "LYRICSBEGIN" {
+			end -= n + 15
+		}
+	}
+	if end < 32 {
+		return -1, -1
+	}
+	footer, err := readApeHeader(b[end-32 : end])
+	if err != nil || footer.Flags&APE_IS_HEADER != 0 || footer.Size < 32 {
+		return -1, -1
+	}
+	start = end - int(footer.Size)
+	if footer.Version >= 2000 && footer.Flags&APE_HAS_HEADER != 0 {
+		start -= 32
+	}
+	if start < 0 {
+		return -1, -1
+	}
+	return start, end
+}
+
+// Text returns the value of a text item, the values of a list being
+// separated by zero bytes.
+func (i *ApeItem) Text() string {
+	return string(i.Value)
+}
@@ -0,0 +1,129 @@
+package rescene
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+// apeTag returns an APE tag of the given version holding one text item per
+// key, with a header when flags has APE_HAS_HEADER.
+func apeTag(version, flags uint32, items ...string) []byte {
+	var body []byte
+	for _, key := range items {
+		item := make([]byte, 8)
+		binary.LittleEndian.PutUint32(item, uint32(len("value of "+key)))
+		item = append(append(item, key...), 0)
+		body = append(body, append(item, "value of "+key...)...)
+	}
+	head := func(flags uint32) []byte {
+		h := append([]byte("APETAGEX"), make([]byte, 24)...)
+		binary.LittleEndian.PutUint32(h[8:], version)
+		binary.LittleEndian.PutUint32(h[12:], uint32(len(body)+32))
+		binary.LittleEndian.PutUint32(h[16:], uint32(len(items)))
+		binary.LittleEndian.PutUint32(h[20:], flags)
+		return h
+	}
+	var tag []byte
+	if flags&APE_HAS_HEADER != 0 {
+		tag = head(flags | APE_IS_HEADER)
+	}
+	tag = append(tag, body...)
+	return append(tag, head(flags)...)
+}
+
+func lyrics3Tag(lyrics string) []byte {
+	tag := []byte("LYRICSBEGIN")
+	tag = append(tag, fmt.Sprintf("LYR%05d%s", len(lyrics), lyrics)...)
+	return append(tag, fmt.Sprintf("%06dLYRICS200", len(tag))...)
+}
+
+func id3v1Tag() []byte {
+	return append([]byte("TAG"), make([]byte, 125)...)
+}
+
+func TestFindApeTag(t *testing.T) {
+	audio := testData(500, 1)
+	tests := []struct {
+		name   string
+		tag    []byte
+		after  []byte
+		header bool
+	}{
+		{"APEv2 footer only", apeTag(2000, 0, "Artist", "Title"), nil, false},
+		{"APEv2 with header", apeTag(2000, APE_HAS_HEADER, "Artist"), nil, true},
+		{"APEv1", apeTag(1000, 0, "Title"), nil, false},
+		{"before ID3v1", apeTag(2000, 0, "Artist", "Title"), id3v1Tag(), false},
+		{"before Lyrics3", apeTag(1000, 0, "Title"), lyrics3Tag("la la"), false},
+		{"before Lyrics3 and ID3v1", apeTag(2000, APE_HAS_HEADER, "Artist", "Title"),
+			append(lyrics3Tag("la la"), id3v1Tag()...), true},
+	}
+	for _, tt := range tests {
+		b := append(append(append([]byte(nil), audio...), tt.tag...), tt.after...)
+		start, end := findApeTag(b)
+		if start != len(audio) || end != len(audio)+len(tt.tag) {
+			t.Errorf("%s: tag at %d-%d, want %d-%d", tt.name, start, end, len(audio), len(audio)+len(tt.tag))
+			continue
+		}
+		block := &ApeBlock{}
+		if err := block.UnmarshalFooter(b[start:end]); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if block.Size != len(tt.tag) || (block.Flags&APE_HAS_HEADER != 0) != tt.header {
+			t.Errorf("%s: size %d, flags %x", tt.name, block.Size, block.Flags)
+		}
+		if n := len(block.Items); n == 0 || block.Items[n-1].Text() != "value of "+block.Items[n-1].Key {
+			t.Errorf("%s: items %+v", tt.name, block.Items)
+		}
+		if tt.header {
+			forward := &ApeBlock{}
+			if err := forward.Unmarshal(b[start:]); err != nil || forward.Size != block.Size || len(forward.Items) != len(block.Items) {
+				t.Errorf("%s: read forward %+v, %v", tt.name, forward, err)
+			}
+		}
+	}
+	if start, end := findApeTag(append(audio, id3v1Tag()...)); start != -1 || end != -1 {
+		t.Errorf("found a tag at %d-%d in untagged data", start, end)
+	}
+}
+
+func TestSrsFileApeFooter(t *testing.T) {
+	fd := srsFileData(0, "sample.mp3", testData(100, 1))
+	srs := append([]byte("SRSF"), make([]byte, 4)...)
+	binary.LittleEndian.PutUint32(srs[4:], uint32(8+len(fd)))
+	srs = append(srs, fd...)
+	srs = append(srs, apeTag(2000, 0, "Artist")...)
+	srs = append(srs, id3v1Tag()...)
+
+	f := &SrsFile{}
+	if err := f.Unmarshal(srs); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Blocks) != 3 {
+		t.Fatalf("got %d blocks, want 3", len(f.Blocks))
+	}
+	if ape, ok := f.Blocks[1].(*ApeBlock); !ok || ape.Version != 2000 || len(ape.Items) != 1 {
+		t.Errorf("block 1 is %+v", f.Blocks[1])
+	}
+	if _, ok := f.Blocks[2].(*ID3v1Block); !ok {
+		t.Errorf("block 2 is %T", f.Blocks[2])
+	}
+}
+
+func TestApeTagCount(t *testing.T) {
+	tag := apeTag(2000, APE_HAS_HEADER)
+	binary.LittleEndian.PutUint32(tag[16:], 0xffffffff)
+	binary.LittleEndian.PutUint32(tag[48:], 0xffffffff)
+
+	f := &SrsFile{}
+	if err := f.Unmarshal(tag); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Blocks) != 1 {
+		t.Fatalf("got %d blocks, want 1", len(f.Blocks))
+	}
+	if ape, ok := f.Blocks[0].(*ApeBlock); !ok || len(ape.Items) != 0 {
+		t.Errorf("block 0 is %+v", f.Blocks[0])
+	}
+}
@@ -0,0 +1,461 @@
+package rescene
+
+// unpack15 decodes data packed with the RAR 1.5 algorithm, which RAR 2.x
+// still uses for archive comments. It follows Unpack15 of unrar.
+
+var (
+	decL1  = []uint{0x8000, 0xa000, 0xc000, 0xd000, 0xe000, 0xea00, 0xee00, 0xf000, 0xf200, 0xf200, 0xffff}
+	posL1  = []uint{0, 0, 0, 2, 3, 5, 7, 11, 16, 20, 24, 32, 32}
+	decL2  = []uint{0xa000, 0xc000, 0xd000, 0xe000, 0xea00, 0xee00, 0xf000, 0xf200, 0xf240, 0xffff}
+	posL2  = []uint{0, 0, 0, 0, 5, 7, 9, 13, 18, 22, 26, 34, 36}
+	decHf0 = []uint{0x8000, 0xc000, 0xe000, 0xf200, 0xf200, 0xf200, 0xf200, 0xf200, 0xffff}
+	posHf0 = []uint{0, 0, 0, 0, 0, 8, 16, 24, 33, 33, 33, 33, 33}
+	decHf1 = []uint{0x2000, 0xc000, 0xe000, 0xf000, 0xf200, 0xf200, 0xf7e0, 0xffff}
+	posHf1 = []uint{0, 0, 0, 0, 0, 0, 4, 44, 60, 76, 80, 80, 127}
+	decHf2 = []uint{0x1000, 0x2400, 0x8000, 0xc000, 0xfa00, 0xffff, 0xffff, 0xffff}
+	posHf2 = []uint{0, 0, 0, 0, 0, 0, 2, 7, 53, 117, 233, 0, 0}
+	decHf3 = []uint{0x800, 0x2400, 0xee00, 0xfe80, 0xffff, 0xffff, 0xffff}
+	posHf3 = []uint{0, 0, 0, 0, 0, 0, 0, 2, 16, 218, 251, 0, 0}
+	decHf4 = []uint{0xff00, 0xffff, 0xffff, 0xffff, 0xffff, 0xffff}
+	posHf4 = []uint{0, 0, 0, 0, 0, 0, 0, 0, 0, 255, 0, 0, 0}
+
+	shortLen1 = []uint{1, 3, 4, 4, 5, 6, 7, 8, 8, 4, 4, 5, 6, 6, 4, 0}
+	shortXor1 = []uint{0, 0xa0, 0xd0, 0xe0, 0xf0, 0xf8, 0xfc, 0xfe, 0xff, 0xc0, 0x80, 0x90, 0x98, 0x9c, 0xb0}
+	shortLen2 = []uint{2, 3, 3, 3, 4, 4, 5, 6, 6, 4, 4, 5, 6, 6, 4, 0}
+	shortXor2 = []uint{0, 0x40, 0x60, 0xa0, 0xd0, 0xe0, 0xf0, 0xf8, 0xfc, 0xc0, 0x80, 0x90, 0x98, 0x9c, 0xb0}
+)
+
+const (
+	startL1  = 2
+	startL2  = 3
+	startHf0 = 4
+	startHf1 = 5
+	startHf2 = 5
+	startHf3 = 6
+	startHf4 = 8
+
+	window15Mask = 0xffff
+)
+
+type unpacker15 struct {
+	in     []byte
+	inBits uint
+
+	window [window15Mask + 1]byte
+	ptr    uint
+	out    []byte
+	size   int // bytes left to write, minus one
+
+	chSet, chSetA, chSetB, chSetC [256]uint16
+	nToPl, nToPlB, nToPlC         [256]byte
+
+	avrPlc, avrPlcB, avrLn1, avrLn2, avrLn3 uint
+	numHuf, nhfb, nlzb, maxDist3            uint
+	buf60, lCount                           uint
+	flagBuf                                 uint
+	flagsCnt                                int
+	stMode                                  bool
+	oldDist                                 [4]uint
+	oldDistPtr                              uint
+	lastDist, lastLength                    uint
+}
+
+func unpack15(data []byte, size int) ([]byte, error) {
+	u := &unpacker15{
+		in:       data,
+		out:      make([]byte, 0, size),
+		size:     size - 1,
+		avrPlc:   0x3500,
+		maxDist3: 0x2001,
+		nhfb:     0x80,
+		nlzb:     0x80,
+	}
+	u.initHuff()
+	if u.size >= 0 {
+		u.getFlagsBuf()
+		u.flagsCnt = 8
+	}
+	for u.size >= 0 {
+		if u.inBits/8 > uint(len(u.in))+4 {
+			// the packed data ends too early
+			return nil, ErrBadData
+		}
+		if u.stMode {
+			u.huffDecode()
+			continue
+		}
+		if u.flagsCnt--; u.flagsCnt < 0 {
+			u.getFlagsBuf()
+			u.flagsCnt = 7
+		}
+		if u.flagBuf&0x80 != 0 {
+			u.flagBuf <<= 1
+			if u.nlzb > u.nhfb {
+				u.longLZ()
+			} else {
+				u.huffDecode()
+			}
+			continue
+		}
+		u.flagBuf <<= 1
+		if u.flagsCnt--; u.flagsCnt < 0 {
+			u.getFlagsBuf()
+			u.flagsCnt = 7
+		}
+		if u.flagBuf&0x80 != 0 {
+			u.flagBuf <<= 1
+			if u.nlzb > u.nhfb {
+				u.huffDecode()
+			} else {
+				u.longLZ()
+			}
+		} else {
+			u.flagBuf <<= 1
+			if err := u.shortLZ(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(u.out) > size {
+		u.out = u.out[:size]
+	}
+	return u.out, nil
+}
+
+// getBits returns the next 16 bits of input without consuming them.
+func (u *unpacker15) getBits() uint {
+	var v uint
+	pos := u.inBits / 8
+	for i := uint(0); i < 3; i++ {
+		v <<= 8
+		if int(pos+i) < len(u.in) {
+			v |= uint(u.in[pos+i])
+		}
+	}
+	return (v >> (8 - u.inBits%8)) & 0xffff
+}
+
+func (u *unpacker15) addBits(n uint) {
+	u.inBits += n
+}
+
+func (u *unpacker15) decodeNum(num, startPos uint, decTab, posTab []uint) uint {
+	num &= 0xfff0
+	i := 0
+	for ; decTab[i] <= num; i++ {
+		startPos++
+	}
+	u.addBits(startPos)
+	prev := uint(0)
+	if i > 0 {
+		prev = decTab[i-1]
+	}
+	return ((num - prev) >> (16 - startPos)) + posTab[startPos]
+}
+
+func (u *unpacker15) putByte(c byte) {
+	u.window[u.ptr] = c
+	u.ptr = (u.ptr + 1) & window15Mask
+	u.out = append(u.out, c)
+}
+
+func (u *unpacker15) copyString(distance, length uint) {
+	u.size -= int(length)
+	for ; length > 0; length-- {
+		u.putByte(u.window[(u.ptr-distance)&window15Mask])
+	}
+}
+
+func (u *unpacker15) shortLZ() error {
+	u.numHuf = 0
+	bitField := u.getBits()
+	if u.lCount == 2 {
+		u.addBits(1)
+		if bitField >= 0x8000 {
+			u.copyString(u.lastDist, u.lastLength)
+			return nil
+		}
+		bitField <<= 1
+		u.lCount = 0
+	}
+	bitField >>= 8
+
+	lens, xors := shortLen1, shortXor1
+	special := uint(1)
+	if u.avrLn1 >= 37 {
+		lens, xors = shortLen2, shortXor2
+		special = 3
+	}
+	shortLen := func(pos uint) uint {
+		if pos == special {
+			return u.buf60 + 3
+		}
+		return lens[pos]
+	}
+	length := uint(0)
+	for ; ; length++ {
+		if int(length) >= len(xors) {
+			return ErrBadData
+		}
+		if (bitField^xors[length])&^(0xff>>shortLen(length))&0xff == 0 {
+			break
+		}
+	}
+	u.addBits(shortLen(length))
+
+	if length >= 9 {
+		if length == 9 {
+			u.lCount++
+			u.copyString(u.lastDist, u.lastLength)
+			return nil
+		}
+		if length == 14 {
+			u.lCount = 0
+			length = u.decodeNum(u.getBits(), startL2, decL2, posL2) + 5
+			distance := (u.getBits() >> 1) | 0x8000
+			u.addBits(15)
+			u.lastLength = length
+			u.lastDist = distance
+			u.copyString(distance, length)
+			return nil
+		}
+		u.lCount = 0
+		saveLength := length
+		distance := u.oldDist[(u.oldDistPtr-(length-9))&3]
+		length = u.decodeNum(u.getBits(), startL1, decL1, posL1) + 2
+		if length == 0x101 && saveLength == 10 {
+			u.buf60 ^= 1
+			return nil
+		}
+		if distance > 256 {
+			length++
+		}
+		if distance >= u.maxDist3 {
+			length++
+		}
+		u.oldDist[u.oldDistPtr] = distance
+		u.oldDistPtr = (u.oldDistPtr + 1) & 3
+		u.lastLength = length
+		u.lastDist = distance
+		u.copyString(distance, length)
+		return nil
+	}
+
+	u.lCount = 0
+	u.avrLn1 += length
+	u.avrLn1 -= u.avrLn1 >> 4
+
+	place := int(u.decodeNum(u.getBits(), startHf2, decHf2, posHf2) & 0xff)
+	distance := uint(u.chSetA[place])
+	if place--; place != -1 {
+		u.chSetA[place+1] = u.chSetA[place]
+		u.chSetA[place] = uint16(distance)
+	}
+	length += 2
+	distance++
+	u.oldDist[u.oldDistPtr] = distance
+	u.oldDistPtr = (u.oldDistPtr + 1) & 3
+	u.lastLength = length
+	u.lastDist = distance
+	u.copyString(distance, length)
+	return nil
+}
+
+func (u *unpacker15) longLZ() {
+	var length, place uint
+	u.numHuf = 0
+	u.nlzb += 16
+	if u.nlzb > 0xff {
+		u.nlzb = 0x90
+		u.nhfb >>= 1
+	}
+	oldAvr2 := u.avrLn2
+
+	bitField := u.getBits()
+	switch {
+	case u.avrLn2 >= 122:
+		length = u.decodeNum(bitField, startL2, decL2, posL2)
+	case u.avrLn2 >= 64:
+		length = u.decodeNum(bitField, startL1, decL1, posL1)
+	case bitField < 0x100:
+		length = bitField
+		u.addBits(16)
+	default:
+		for length = 0; (bitField<<length)&0x8000 == 0; length++ {
+		}
+		u.addBits(length + 1)
+	}
+	u.avrLn2 += length
+	u.avrLn2 -= u.avrLn2 >> 5
+
+	bitField = u.getBits()
+	switch {
+	case u.avrPlcB > 0x28ff:
+		place = u.decodeNum(bitField, startHf2, decHf2, posHf2)
+	case u.avrPlcB > 0x6ff:
+		place = u.decodeNum(bitField, startHf1, decHf1, posHf1)
+	default:
+		place = u.decodeNum(bitField, startHf0, decHf0, posHf0)
+	}
+	u.avrPlcB += place
+	u.avrPlcB -= u.avrPlcB >> 8
+
+	var distance, newPlace uint
+	for {
+		distance = uint(u.chSetB[place&0xff])
+		newPlace = uint(u.nToPlB[distance&0xff])
+		u.nToPlB[distance&0xff]++
+		distance++
+		if distance&0xff != 0 {
+			break
+		}
+		corrHuff(&u.chSetB, &u.nToPlB)
+	}
+	u.chSetB[place&0xff] = u.chSetB[newPlace]
+	u.chSetB[newPlace] = uint16(distance)
+
+	distance = ((distance & 0xff00) | (u.getBits() >> 8)) >> 1
+	u.addBits(7)
+
+	oldAvr3 := u.avrLn3
+	if length != 1 && length != 4 {
+		if length == 0 && distance <= u.maxDist3 {
+			u.avrLn3++
+			u.avrLn3 -= u.avrLn3 >> 8
+		} else if u.avrLn3 > 0 {
+			u.avrLn3--
+		}
+	}
+	length += 3
+	if distance >= u.maxDist3 {
+		length++
+	}
+	if distance <= 256 {
+		length += 8
+	}
+	if oldAvr3 > 0xb0 || u.avrPlc >= 0x2a00 && oldAvr2 < 0x40 {
+		u.maxDist3 = 0x7f00
+	} else {
+		u.maxDist3 = 0x2001
+	}
+	u.oldDist[u.oldDistPtr] = distance
+	u.oldDistPtr = (u.oldDistPtr + 1) & 3
+	u.lastLength = length
+	u.lastDist = distance
+	u.copyString(distance, length)
+}
+
+func (u *unpacker15) huffDecode() {
+	var place int
+	bitField := u.getBits()
+	switch {
+	case u.avrPlc > 0x75ff:
+		place = int(u.decodeNum(bitField, startHf4, decHf4, posHf4))
+	case u.avrPlc > 0x5dff:
+		place = int(u.decodeNum(bitField, startHf3, decHf3, posHf3))
+	case u.avrPlc > 0x35ff:
+		place = int(u.decodeNum(bitField, startHf2, decHf2, posHf2))
+	case u.avrPlc > 0x0dff:
+		place = int(u.decodeNum(bitField, startHf1, decHf1, posHf1))
+	default:
+		place = int(u.decodeNum(bitField, startHf0, decHf0, posHf0))
+	}
+	place &= 0xff
+	if u.stMode {
+		if place == 0 && bitField > 0xfff {
+			place = 0x100
+		}
+		if place--; place == -1 {
+			bitField = u.getBits()
+			u.addBits(1)
+			if bitField&0x8000 != 0 {
+				u.numHuf = 0
+				u.stMode = false
+				return
+			}
+			length := uint(3)
+			if bitField&0x4000 != 0 {
+				length = 4
+			}
+			u.addBits(1)
+			distance := u.decodeNum(u.getBits(), startHf2, decHf2, posHf2)
+			distance = (distance << 5) | (u.getBits() >> 11)
+			u.addBits(5)
+			u.copyString(distance, length)
+			return
+		}
+	} else {
+		if u.numHuf >= 16 && u.flagsCnt == 0 {
+			u.stMode = true
+		}
+		u.numHuf++
+	}
+	u.avrPlc += uint(place)
+	u.avrPlc -= u.avrPlc >> 8
+	u.nhfb += 16
+	if u.nhfb > 0xff {
+		u.nhfb = 0x90
+		u.nlzb >>= 1
+	}
+
+	u.putByte(byte(u.chSet[place] >> 8))
+	u.size--
+
+	var cur, newPlace uint
+	for {
+		cur = uint(u.chSet[place])
+		newPlace = uint(u.nToPl[cur&0xff])
+		u.nToPl[cur&0xff]++
+		cur++
+		if cur&0xff <= 0xa1 {
+			break
+		}
+		corrHuff(&u.chSet, &u.nToPl)
+	}
+	u.chSet[place] = u.chSet[newPlace]
+	u.chSet[newPlace] = uint16(cur)
+}
+
+func (u *unpacker15) getFlagsBuf() {
+	place := u.decodeNum(u.getBits(), startHf2, decHf2, posHf2)
+	if place >= uint(len(u.chSetC)) {
+		return
+	}
+	var flags, newPlace uint
+	for {
+		flags = uint(u.chSetC[place])
+		u.flagBuf = flags >> 8
+		newPlace = uint(u.nToPlC[flags&0xff])
+		u.nToPlC[flags&0xff]++
+		flags++
+		if flags&0xff != 0 {
+			break
+		}
+		corrHuff(&u.chSetC, &u.nToPlC)
+	}
+	u.chSetC[place] = u.chSetC[newPlace]
+	u.chSetC[newPlace] = uint16(flags)
+}
+
+func (u *unpacker15) initHuff() {
+	for i := 0; i < 256; i++ {
+		u.chSet[i] = uint16(i << 8)
+		u.chSetB[i] = uint16(i << 8)
+		u.chSetA[i] = uint16(i)
+		u.chSetC[i] = uint16(((^i + 1) & 0xff) << 8)
+	}
+	corrHuff(&u.chSetB, &u.nToPlB)
+}
+
+func corrHuff(charSet *[256]uint16, numToPlace *[256]byte) {
+	k := 0
+	for i := 7; i >= 0; i-- {
+		for j := 0; j < 32; j, k = j+1, k+1 {
+			charSet[k] = charSet[k]&^0xff | uint16(i)
+		}
+	}
+	*numToPlace = [256]byte{}
+	for i := 6; i >= 0; i-- {
+		numToPlace[i] = byte((7 - i) * 32)
+	}
+}
@@ -0,0 +1,211 @@
+package rescene
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ArchiveSet is one RAR archive of an SRR: its volumes ordered by volume
+// number and the files packed in them.
+type ArchiveSet struct {
+	Root        string
+	Volumes     []*RarFile
+	PackedFiles []*PackedFile
+}
+
+// VolumeStyle is a RAR volume naming scheme.
+type VolumeStyle int
+
+const (
+	// VolumeOld names volumes name.rar, name.r00 ... name.r99, name.s00 ...
+	// up to name.z99.
+	VolumeOld VolumeStyle = iota + 1
+	// VolumeNumbered names volumes name.001, name.002...
+	VolumeNumbered
+	// VolumePart names volumes name.part1.rar, name.part2.rar... with the
+	// number padded to the width needed by the last volume.
+	VolumePart
+)
+
+// VolumeScheme is how the volumes of a set are named: the style, the width
+// of the volume number for the numbered and part styles, and whether the
+// extension is in upper case.
+type VolumeScheme struct {
+	Style  VolumeStyle
+	Digits int
+	Upper  bool
+}
+
+var (
+	reVolPart = regexp.MustCompile(`(?i)^(.*)\.part([0-9]+)\.rar$`)
+	reVolOld  = regexp.MustCompile(`(?i)^(.*)\.(rar|[r-z][0-9]{2})$`)
+	reVolNum  = regexp.MustCompile(`^(.*)\.([0-9]{3,})$`)
+)
+
+// ParseVolumeName splits the name of a RAR volume into the root name of its
+// set, with its case kept, the naming scheme and the position of the volume
+// in the set, 0 being the first volume. ok is false when the name follows no
+// known scheme.
+func ParseVolumeName(path string) (root string, scheme VolumeScheme, index int, ok bool) {
+	if m := reVolPart.FindStringSubmatch(path); m != nil {
+		// name.part0.rar is not a part name: it is read as name.part0 + .rar
+		if n, err := strconv.Atoi(m[2]); err == nil && n > 0 {
+			ext := path[len(path)-len(".rar"):]
+			scheme = VolumeScheme{Style: VolumePart, Digits: len(m[2]), Upper: ext == ".RAR"}
+			return m[1], scheme, n - 1, true
+		}
+	}
+	if m := reVolOld.FindStringSubmatch(path); m != nil {
+		scheme = VolumeScheme{Style: VolumeOld, Upper: m[2][0] < 'a'}
+		if strings.EqualFold(m[2], "rar") {
+			return m[1], scheme, 0, true
+		}
+		n, _ := strconv.Atoi(m[2][1:])
+		return m[1], scheme, int(m[2][0]|0x20-'r')*100 + n + 1, true
+	}
+	if m := reVolNum.FindStringSubmatch(path); m != nil {
+		n, err := strconv.Atoi(m[2])
+		if err != nil || n == 0 {
+			return "", VolumeScheme{}, 0, false
+		}
+		return m[1], VolumeScheme{Style: VolumeNumbered, Digits: len(m[2])}, n - 1, true
+	}
+	return "", VolumeScheme{}, 0, false
+}
+
+// VolumeName returns the name of the volume at index in the set of the
+// given root name, or "" when the scheme has no name for it.
+func (s VolumeScheme) VolumeName(root string, index int) string {
+	if index < 0 {
+		return ""
+	}
+	var ext string
+	switch s.Style {
+	case VolumeOld:
+		switch {
+		case index == 0:
+			ext = ".rar"
+		case index <= ('z'-'r'+1)*100:
+			ext = fmt.Sprintf(".%c%02d", 'r'+(index-1)/100, (index-1)%100)
+		default:
+			return ""
+		}
+	case VolumeNumbered:
+		ext = fmt.Sprintf(".%0*d", s.Digits, index+1)
+	case VolumePart:
+		ext = fmt.Sprintf(".part%0*d.rar", s.Digits, index+1)
+	default:
+		return ""
+	}
+	if s.Upper {
+		ext = strings.ToUpper(ext)
+	}
+	return root + ext
+}
+
+// volumeNumber returns the position of a RAR volume in its set, or -1 when
+// the name does not follow a known naming scheme.
+func volumeNumber(path string) int {
+	if _, _, n, ok := ParseVolumeName(path); ok {
+		return n
+	}
+	return -1
+}
+
+// setKey tells to which archive set a volume belongs: sets are grouped by
+// root name, case ignored.
+func setKey(path string) string {
+	root := RarRootName(path)
+	if root == "" {
+		root = path
+	}
+	return strings.ToLower(root)
+}
+
+// ArchiveSets groups the RAR volumes of the SRR by root name. Sets are
+// returned in the order their first volume appears in RarFiles.
+func (f *SrrFile) ArchiveSets() []*ArchiveSet {
+	sets := make([]*ArchiveSet, 0)
+	byRoot := make(map[string]*ArchiveSet)
+	for _, v := range f.RarFiles {
+		key := setKey(v.Path)
+		set, ok := byRoot[key]
+		if !ok {
+			root := RarRootName(v.Path)
+			if root == "" {
+				root = v.Path
+			}
+			set = &ArchiveSet{
+				Root:        root,
+				Volumes:     make([]*RarFile, 0),
+				PackedFiles: make([]*PackedFile, 0),
+			}
+			byRoot[key] = set
+			sets = append(sets, set)
+		}
+		set.Volumes = append(set.Volumes, v)
+	}
+
+	for _, set := range sets {
+		sort.SliceStable(set.Volumes, func(i, j int) bool {
+			a := volumeNumber(set.Volumes[i].Path)
+			b := volumeNumber(set.Volumes[j].Path)
+			if a == b {
+				return set.Volumes[i].Path < set.Volumes[j].Path
+			}
+			return a < b
+		})
+		seen := make(map[*PackedFile]bool)
+		for _, v := range set.Volumes {
+			for _, p := range v.PackedFiles {
+				if !seen[p] {
+					seen[p] = true
+					set.PackedFiles = append(set.PackedFiles, p)
+				}
+			}
+		}
+	}
+	return sets
+}
+
+// Check makes sure the first volume of the set, and only that one, carries
+// the MHD_FIRSTVOLUME flag. Archives made before RAR 3.0 have no such flag
+// and are only checked for it when one of their volumes carries it.
+func (s *ArchiveSet) Check() error {
+	if len(s.Volumes) == 0 {
+		return ErrNoData
+	}
+	if s.isOld() {
+		return nil
+	}
+	if !s.Volumes[0].IsFirst {
+		return ErrFirstVolume
+	}
+	for _, v := range s.Volumes[1:] {
+		if v.IsFirst {
+			return ErrFirstVolume
+		}
+	}
+	return nil
+}
+
+// isOld reports whether the set was made by RAR 1.5 to 2.x: no volume is
+// flagged as the first one and the files need an unpack version below 2.9.
+func (s *ArchiveSet) isOld() bool {
+	old := false
+	for _, v := range s.Volumes {
+		if v.IsFirst {
+			return false
+		}
+		for _, h := range v.FileHeads {
+			if h.UnpackVersion >= 29 {
+				return false
+			}
+			old = true
+		}
+	}
+	return old
+}
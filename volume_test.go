@@ -0,0 +1,140 @@
+package rescene
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseVolumeName(t *testing.T) {
+	tests := []struct {
+		path   string
+		root   string
+		scheme VolumeScheme
+		index  int
+		ok     bool
+	}{
+		{"group-movie.rar", "group-movie", VolumeScheme{Style: VolumeOld}, 0, true},
+		{"group-movie.r00", "group-movie", VolumeScheme{Style: VolumeOld}, 1, true},
+		{"group-movie.r99", "group-movie", VolumeScheme{Style: VolumeOld}, 100, true},
+		{"group-movie.s00", "group-movie", VolumeScheme{Style: VolumeOld}, 101, true},
+		{"group-movie.z99", "group-movie", VolumeScheme{Style: VolumeOld}, 900, true},
+		{"Group.Movie.RAR", "Group.Movie", VolumeScheme{Style: VolumeOld, Upper: true}, 0, true},
+		{"Group.Movie.R05", "Group.Movie", VolumeScheme{Style: VolumeOld, Upper: true}, 6, true},
+		{"grp-movie2010.rar", "grp-movie2010", VolumeScheme{Style: VolumeOld}, 0, true},
+		{"grp-movie2010.r00", "grp-movie2010", VolumeScheme{Style: VolumeOld}, 1, true},
+		{"movie.part1.rar", "movie", VolumeScheme{Style: VolumePart, Digits: 1}, 0, true},
+		{"movie.part01.rar", "movie", VolumeScheme{Style: VolumePart, Digits: 2}, 0, true},
+		{"movie.part012.rar", "movie", VolumeScheme{Style: VolumePart, Digits: 3}, 11, true},
+		{"Movie.PART2.RAR", "Movie", VolumeScheme{Style: VolumePart, Digits: 1, Upper: true}, 1, true},
+		{"movie.part0.rar", "movie.part0", VolumeScheme{Style: VolumeOld}, 0, true},
+		{"movie.avi.001", "movie.avi", VolumeScheme{Style: VolumeNumbered, Digits: 3}, 0, true},
+		{"movie.avi.012", "movie.avi", VolumeScheme{Style: VolumeNumbered, Digits: 3}, 11, true},
+		{"movie.0010", "movie", VolumeScheme{Style: VolumeNumbered, Digits: 4}, 9, true},
+		{"CD1/Movie.r01", "CD1/Movie", VolumeScheme{Style: VolumeOld}, 2, true},
+		{"movie.000", "", VolumeScheme{}, 0, false},
+		{"movie.01", "", VolumeScheme{}, 0, false},
+		{"movie.sfv", "", VolumeScheme{}, 0, false},
+		{"movie.rar.bak", "", VolumeScheme{}, 0, false},
+		{"movie.q00", "", VolumeScheme{}, 0, false},
+	}
+	for _, tt := range tests {
+		root, scheme, index, ok := ParseVolumeName(tt.path)
+		if root != tt.root || scheme != tt.scheme || index != tt.index || ok != tt.ok {
+			t.Errorf("ParseVolumeName(%q) = %q, %+v, %d, %v; want %q, %+v, %d, %v",
+				tt.path, root, scheme, index, ok, tt.root, tt.scheme, tt.index, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if name := scheme.VolumeName(root, index); name != tt.path {
+			t.Errorf("VolumeName(%q, %d) = %q, want %q", root, index, name, tt.path)
+		}
+		if r := RarRootName(tt.path); r != root {
+			t.Errorf("RarRootName(%q) = %q, want %q", tt.path, r, root)
+		}
+	}
+}
+
+func TestVolumeName(t *testing.T) {
+	tests := []struct {
+		scheme VolumeScheme
+		index  int
+		name   string
+	}{
+		{VolumeScheme{Style: VolumeOld}, 0, "x.rar"},
+		{VolumeScheme{Style: VolumeOld}, 1, "x.r00"},
+		{VolumeScheme{Style: VolumeOld}, 101, "x.s00"},
+		{VolumeScheme{Style: VolumeOld}, 901, ""},
+		{VolumeScheme{Style: VolumeOld, Upper: true}, 3, "x.R02"},
+		{VolumeScheme{Style: VolumePart, Digits: 2}, 9, "x.part10.rar"},
+		{VolumeScheme{Style: VolumePart, Digits: 1}, 9, "x.part10.rar"},
+		{VolumeScheme{Style: VolumePart, Digits: 3, Upper: true}, 0, "x.PART001.RAR"},
+		{VolumeScheme{Style: VolumeNumbered, Digits: 3}, 0, "x.001"},
+		{VolumeScheme{Style: VolumeNumbered, Digits: 3}, -1, ""},
+		{VolumeScheme{}, 0, ""},
+	}
+	for _, tt := range tests {
+		if name := tt.scheme.VolumeName("x", tt.index); name != tt.name {
+			t.Errorf("%+v.VolumeName(%d) = %q, want %q", tt.scheme, tt.index, name, tt.name)
+		}
+	}
+}
+
+func TestArchiveSets(t *testing.T) {
+	f := &SrrFile{}
+	for _, p := range []string{
+		"movie.part10.rar", "grp-movie2010.r00", "movie.part2.rar", "grp-movie2010.rar",
+		"Movie.part1.rar", "movie.part11.rar", "grp-movie2010.r01", "movie.nfo",
+	} {
+		f.RarFiles = append(f.RarFiles, &RarFile{Path: p})
+	}
+	want := []struct {
+		root    string
+		volumes []string
+	}{
+		{"movie", []string{"Movie.part1.rar", "movie.part2.rar", "movie.part10.rar", "movie.part11.rar"}},
+		{"grp-movie2010", []string{"grp-movie2010.rar", "grp-movie2010.r00", "grp-movie2010.r01"}},
+		{"movie.nfo", []string{"movie.nfo"}},
+	}
+	sets := f.ArchiveSets()
+	if len(sets) != len(want) {
+		t.Fatalf("got %d sets, want %d", len(sets), len(want))
+	}
+	for i, w := range want {
+		got := make([]string, len(sets[i].Volumes))
+		for j, v := range sets[i].Volumes {
+			got[j] = v.Path
+		}
+		if sets[i].Root != w.root || fmt.Sprint(got) != fmt.Sprint(w.volumes) {
+			t.Errorf("set %d: %s %v, want %s %v", i, sets[i].Root, got, w.root, w.volumes)
+		}
+	}
+}
+
+func TestArchiveSetsUnmarshal(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{"movie.mkv": testData(3500, 1)}
+	volumes := rarSplit(t, dir, "grp-movie2010", 1000, files, "movie.mkv")
+	f := srrOf(t, dir, volumes, CreateOptions{})
+	// Unmarshal sorts the volumes by path, putting .rar after .r00
+	if f.RarFiles[0].Path == volumes[0] {
+		t.Fatalf("RarFiles %s... are in volume order", f.RarFiles[0].Path)
+	}
+
+	sets := f.ArchiveSets()
+	if len(sets) != 1 || len(sets[0].Volumes) != len(volumes) {
+		t.Fatalf("got %d sets, want one of %d volumes", len(sets), len(volumes))
+	}
+	for i, v := range sets[0].Volumes {
+		if v.Path != volumes[i] {
+			t.Errorf("volume %d is %s, want %s", i, v.Path, volumes[i])
+		}
+	}
+	if len(sets[0].PackedFiles) != 1 || sets[0].PackedFiles[0].Path != "movie.mkv" {
+		t.Errorf("packed files %+v", sets[0].PackedFiles)
+	}
+	if err := sets[0].Check(); err != nil {
+		t.Errorf("Check() = %v", err)
+	}
+}
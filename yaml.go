@@ -0,0 +1,136 @@
+package rescene
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// yamlNode keeps a decoded JSON value with the key order of its objects.
+type yamlNode struct {
+	keys   []string
+	values []*yamlNode
+	object bool
+	array  bool
+	scalar []byte
+}
+
+func decodeYAMLNode(dec *json.Decoder) (*yamlNode, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	n := &yamlNode{}
+	switch t := tok.(type) {
+	case json.Delim:
+		n.object = t == '{'
+		n.array = t == '['
+		for dec.More() {
+			if n.object {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, key.(string))
+			}
+			v, err := decodeYAMLNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.values = append(n.values, v)
+		}
+		if _, err = dec.Token(); err != nil {
+			return nil, err
+		}
+	case nil:
+		n.scalar = []byte("null")
+	case json.Number:
+		n.scalar = []byte(t.String())
+	default:
+		if n.scalar, err = json.Marshal(t); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+func (n *yamlNode) inline() []byte {
+	switch {
+	case n.object && len(n.values) == 0:
+		return []byte("{}")
+	case n.array && len(n.values) == 0:
+		return []byte("[]")
+	case n.object || n.array:
+		return nil
+	default:
+		return n.scalar
+	}
+}
+
+func yamlKey(k string) []byte {
+	plain := k != ""
+	for i, c := range k {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			plain = false
+			break
+		}
+	}
+	switch strings.ToLower(k) {
+	case "y", "n", "yes", "no", "on", "off", "true", "false", "null":
+		plain = false
+	}
+	if plain {
+		return []byte(k)
+	}
+	b, _ := json.Marshal(k)
+	return b
+}
+
+func (n *yamlNode) write(buf *bytes.Buffer, indent int) {
+	pad := strings.Repeat("  ", indent)
+	for i, v := range n.values {
+		if n.object {
+			buf.WriteString(pad)
+			buf.Write(yamlKey(n.keys[i]))
+			buf.WriteString(":")
+		} else if v.object && len(v.values) > 0 {
+			// "- " takes the place of the indentation of the first key
+			var item bytes.Buffer
+			v.write(&item, indent+1)
+			buf.WriteString(pad)
+			buf.WriteString("- ")
+			buf.Write(item.Bytes()[len(pad)+2:])
+			continue
+		} else {
+			buf.WriteString(pad)
+			buf.WriteString("-")
+		}
+		if s := v.inline(); s != nil {
+			buf.WriteString(" ")
+			buf.Write(s)
+			buf.WriteString("\n")
+			continue
+		}
+		buf.WriteString("\n")
+		v.write(buf, indent+1)
+	}
+}
+
+// jsonToYAML converts a JSON document to block style YAML. Strings are
+// written double quoted, which YAML reads with the same escapes as JSON.
+func jsonToYAML(b []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	n, err := decodeYAMLNode(dec)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if s := n.inline(); s != nil {
+		buf.Write(s)
+		buf.WriteString("\n")
+	} else {
+		n.write(&buf, 0)
+	}
+	return buf.Bytes(), nil
+}